@@ -20,8 +20,8 @@ import (
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/mcp"
 	"github.com/amarbel-llc/lux/internal/server"
-	"github.com/amarbel-llc/lux/internal/subprocess"
 	"github.com/amarbel-llc/lux/internal/tools"
+	"github.com/amarbel-llc/lux/internal/trace"
 	luxtransport "github.com/amarbel-llc/lux/internal/transport"
 )
 
@@ -53,6 +53,8 @@ func buildApp() *command.App {
 		},
 	})
 
+	app.MergeWithPrefix(buildCacheApp(), "cache")
+
 	// Hidden command for artifact generation during nix build
 	app.AddCommand(&command.Command{
 		Name:   "_generate",
@@ -114,21 +116,105 @@ With --force, overwrites existing files.`,
 			Short: "Start the LSP server",
 			Long:  "Start the Lux LSP server, reading from stdin and writing to stdout.",
 		},
+		Params: []command.Param{
+			traceFileParam,
+		},
 		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			var p struct {
+				TraceFile string `json:"trace-file"`
+			}
+			if err := json.Unmarshal(args, &p); err != nil {
+				return fmt.Errorf("invalid arguments: %w", err)
+			}
+
 			cfg, err := config.Load()
 			if err != nil {
 				return fmt.Errorf("loading config: %w", err)
 			}
 
+			rec, err := openTrace(p.TraceFile)
+			if err != nil {
+				return err
+			}
+			defer rec.Close()
+
 			srv, err := server.New(cfg)
 			if err != nil {
 				return fmt.Errorf("creating server: %w", err)
 			}
+			srv.SetTracer(rec)
 
 			return srv.Run(ctx)
 		},
 	})
 
+	app.AddCommand(&command.Command{
+		Name: "replay",
+		Description: command.Description{
+			Short: "Replay a recorded trace against an LSP",
+			Long:  "Start an LSP and send it the messages lux sent it in a trace recorded with --trace-file, printing the new exchange as JSON lines.",
+		},
+		Params: []command.Param{
+			{Name: "file", Type: command.String, Description: "Trace file recorded with --trace-file", Required: true},
+			{Name: "lsp", Type: command.String, Description: "LSP to replay (required if the trace contains several)"},
+			{Name: "dir", Type: command.String, Description: "Working directory for the LSP", Default: "."},
+			{Name: "timeout", Type: command.String, Description: "How long to wait for each response", Default: "30s"},
+		},
+		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			var p struct {
+				File    string `json:"file"`
+				LSP     string `json:"lsp"`
+				Dir     string `json:"dir"`
+				Timeout string `json:"timeout"`
+			}
+			if err := json.Unmarshal(args, &p); err != nil {
+				return fmt.Errorf("invalid arguments: %w", err)
+			}
+
+			return runReplay(ctx, p.File, p.LSP, p.Dir, p.Timeout)
+		},
+	})
+
+	app.AddCommand(&command.Command{
+		Name: "lock",
+		Description: command.Description{
+			Short: "Pin server and formatter builds in lux.lock",
+			Long: `Resolve the flakes of all configured LSPs, runtime dependencies and formatters
+and record their locked revision, narHash and store path in lux.lock next to
+the config. Lux builds pinned flakes from the lock instead of re-resolving them.
+
+Without --update, existing entries are kept and only missing ones are added.
+With --update, every entry is re-resolved, or only those of the named LSP or
+formatter.`,
+		},
+		Params: []command.Param{
+			{Name: "update", Type: command.Bool, Description: "Re-resolve existing entries"},
+			{Name: "name", Type: command.String, Description: "Only update the entries of this LSP or formatter"},
+		},
+		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			var p struct {
+				Update bool   `json:"update"`
+				Name   string `json:"name"`
+			}
+			if err := json.Unmarshal(args, &p); err != nil {
+				return fmt.Errorf("invalid arguments: %w", err)
+			}
+
+			return runLock(ctx, p.Update, p.Name)
+		},
+	})
+
+	app.AddCommand(&command.Command{
+		Name: "gc",
+		Description: command.Description{
+			Short: "Remove GC roots of unconfigured flakes",
+			Long:  "Remove the nix GC roots lux registered for flakes that no LSP, runtime dependency or formatter in the global config uses any more and that have not been used for 30 days, so nix-collect-garbage can reclaim them. The grace period keeps roots that only project configs need.",
+		},
+		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			return runGC()
+		},
+	})
+
 	app.AddCommand(&command.Command{
 		Name: "add",
 		Description: command.Description{
@@ -208,7 +294,7 @@ With --formatter, adds a formatter to formatters.toml:
 			fmt.Fprintln(w, "Filetype\tExtensions\tLSP\tFormatters\tMode")
 			for _, ft := range filetypes {
 				exts := strings.Join(ft.Extensions, ", ")
-				lsp := ft.LSP
+				lsp := strings.Join(ft.LSPNames(), ", ")
 				if lsp == "" {
 					lsp = "-"
 				}
@@ -313,6 +399,40 @@ With --formatter, adds a formatter to formatters.toml:
 		},
 	})
 
+	app.AddCommand(&command.Command{
+		Name: "logs",
+		Description: command.Description{
+			Short: "Show the log of an LSP",
+			Long:  "Print the recent stderr, window messages and lifecycle events of an LSP held by the running Lux server. With --follow, keep printing new entries.",
+		},
+		Params: []command.Param{
+			{Name: "follow", Short: 'f', Type: command.Bool, Description: "Keep printing new entries"},
+			{Name: "name", Type: command.String, Description: "LSP name", Required: true},
+		},
+		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			var p struct {
+				Follow bool   `json:"follow"`
+				Name   string `json:"name"`
+			}
+			if err := json.Unmarshal(args, &p); err != nil {
+				return fmt.Errorf("invalid arguments: %w", err)
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			client, err := control.NewClient(cfg.SocketPath())
+			if err != nil {
+				return fmt.Errorf("connecting to server: %w", err)
+			}
+			defer client.Close()
+
+			return client.Logs(os.Stdout, p.Name, p.Follow)
+		},
+	})
+
 	app.AddCommand(&command.Command{
 		Name: "warmup",
 		Description: command.Description{
@@ -416,7 +536,7 @@ With --formatter, adds a formatter to formatters.toml:
 				return fmt.Errorf("reading file: %w", err)
 			}
 
-			executor := subprocess.NewNixExecutor()
+			executor := server.NewExecutor()
 
 			var result *formatter.Result
 			switch match.Mode {
@@ -458,17 +578,34 @@ func buildMCPTransportApp() *command.App {
 			Short: "MCP over stdio",
 			Long:  "Run MCP server reading from stdin and writing to stdout.",
 		},
+		Params: []command.Param{
+			traceFileParam,
+		},
 		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			var p struct {
+				TraceFile string `json:"trace-file"`
+			}
+			if err := json.Unmarshal(args, &p); err != nil {
+				return fmt.Errorf("invalid arguments: %w", err)
+			}
+
 			cfg, err := config.Load()
 			if err != nil {
 				return fmt.Errorf("loading config: %w", err)
 			}
 
+			rec, err := openTrace(p.TraceFile)
+			if err != nil {
+				return err
+			}
+			defer rec.Close()
+
 			t := transport.NewStdio(os.Stdin, os.Stdout)
-			srv, err := mcp.New(cfg, t)
+			srv, err := mcp.New(cfg, rec.TapTransport(t))
 			if err != nil {
 				return fmt.Errorf("creating MCP server: %w", err)
 			}
+			srv.SetTracer(rec)
 
 			return srv.Run(ctx)
 		},
@@ -482,10 +619,12 @@ func buildMCPTransportApp() *command.App {
 		},
 		Params: []command.Param{
 			{Name: "addr", Short: 'a', Type: command.String, Description: "Address to listen on", Default: ":8080"},
+			traceFileParam,
 		},
 		RunCLI: func(ctx context.Context, args json.RawMessage) error {
 			var p struct {
-				Addr string `json:"addr"`
+				Addr      string `json:"addr"`
+				TraceFile string `json:"trace-file"`
 			}
 			if err := json.Unmarshal(args, &p); err != nil {
 				return fmt.Errorf("invalid arguments: %w", err)
@@ -501,11 +640,18 @@ func buildMCPTransportApp() *command.App {
 				return fmt.Errorf("loading config: %w", err)
 			}
 
+			rec, err := openTrace(p.TraceFile)
+			if err != nil {
+				return err
+			}
+			defer rec.Close()
+
 			t := luxtransport.NewSSE(addr)
-			srv, err := mcp.New(cfg, t)
+			srv, err := mcp.New(cfg, rec.TapTransport(t))
 			if err != nil {
 				return fmt.Errorf("creating MCP server: %w", err)
 			}
+			srv.SetTracer(rec)
 
 			t.SetDocumentLifecycle(srv.DocumentManager())
 
@@ -528,10 +674,12 @@ func buildMCPTransportApp() *command.App {
 		},
 		Params: []command.Param{
 			{Name: "addr", Short: 'a', Type: command.String, Description: "Address to listen on", Default: ":8081"},
+			traceFileParam,
 		},
 		RunCLI: func(ctx context.Context, args json.RawMessage) error {
 			var p struct {
-				Addr string `json:"addr"`
+				Addr      string `json:"addr"`
+				TraceFile string `json:"trace-file"`
 			}
 			if err := json.Unmarshal(args, &p); err != nil {
 				return fmt.Errorf("invalid arguments: %w", err)
@@ -547,11 +695,18 @@ func buildMCPTransportApp() *command.App {
 				return fmt.Errorf("loading config: %w", err)
 			}
 
+			rec, err := openTrace(p.TraceFile)
+			if err != nil {
+				return err
+			}
+			defer rec.Close()
+
 			t := luxtransport.NewStreamableHTTP(addr)
-			srv, err := mcp.New(cfg, t)
+			srv, err := mcp.New(cfg, rec.TapTransport(t))
 			if err != nil {
 				return fmt.Errorf("creating MCP server: %w", err)
 			}
+			srv.SetTracer(rec)
 
 			go func() {
 				if err := t.Start(ctx); err != nil {
@@ -567,6 +722,21 @@ func buildMCPTransportApp() *command.App {
 	return mcpApp
 }
 
+var traceFileParam = command.Param{
+	Name:        "trace-file",
+	Type:        command.String,
+	Description: "Record all JSON-RPC traffic to this file as JSON lines",
+}
+
+// openTrace creates the trace recorder for --trace-file. It returns nil,
+// which records nothing, when no file was given.
+func openTrace(path string) (*trace.Recorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return trace.Create(path)
+}
+
 func addFiletypeConfig(name string, extensions, languageIDs []string, lsp string, formatters []string, formatterMode string) error {
 	if len(extensions) == 0 && len(languageIDs) == 0 {
 		return fmt.Errorf("at least one of --extensions or --language-ids is required for --filetype")
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/command"
+	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+func buildCacheApp() *command.App {
+	cacheApp := command.NewApp("cache", "Build cache")
+
+	cacheApp.AddCommand(&command.Command{
+		Name: "list",
+		Description: command.Description{
+			Short: "List cached builds",
+			Long:  "List the flake builds lux has cached, with the lock they were built from and when a server last used them.",
+		},
+		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			return runCacheList()
+		},
+	})
+
+	cacheApp.AddCommand(&command.Command{
+		Name: "clear",
+		Description: command.Description{
+			Short: "Forget cached builds",
+			Long:  "Remove all entries from the build cache, or only those of one flake. Store paths are left for nix to collect.",
+		},
+		Params: []command.Param{
+			{Name: "flake", Type: command.String, Description: "Only clear entries for this flake reference"},
+		},
+		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			var p struct {
+				Flake string `json:"flake"`
+			}
+			if err := json.Unmarshal(args, &p); err != nil {
+				return fmt.Errorf("invalid arguments: %w", err)
+			}
+			return subprocess.NewBuildCache(config.BuildCachePath()).Clear(p.Flake)
+		},
+	})
+
+	cacheApp.AddCommand(&command.Command{
+		Name: "refresh",
+		Description: command.Description{
+			Short: "Rebuild configured flakes",
+			Long:  "Re-resolve the locks of all configured LSP, runtime dependency and formatter flakes and build them, replacing their cache entries.",
+		},
+		RunCLI: func(ctx context.Context, args json.RawMessage) error {
+			return runCacheRefresh(ctx)
+		},
+	})
+
+	return cacheApp
+}
+
+func runCacheList() error {
+	entries := subprocess.NewBuildCache(config.BuildCachePath()).Entries()
+	if len(entries) == 0 {
+		fmt.Println("Build cache is empty")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Flake\tBinary\tLock\tStore path\tBuilt\tUsed")
+	for _, e := range entries {
+		binary := e.Binary
+		if binary == "" {
+			binary = "-"
+		}
+		lock := e.NarHash
+		if e.Revision != "" {
+			lock = e.Revision
+		}
+		if len(lock) > 19 {
+			lock = lock[:19]
+		}
+		storePath := e.StorePath
+		if _, err := os.Stat(storePath); err != nil {
+			storePath += " (missing)"
+		}
+		used := "-"
+		if !e.UsedAt.IsZero() {
+			used = e.UsedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Flake, binary, lock, storePath, e.BuiltAt.Format(time.DateTime), used)
+	}
+	return w.Flush()
+}
+
+// runCacheRefresh drops the cache entries of every configured flake and
+// builds them again, so moved inputs are picked up without a lux restart.
+func runCacheRefresh(ctx context.Context) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	fmtCfg, err := config.LoadMergedFormatters()
+	if err != nil {
+		return fmt.Errorf("loading formatter config: %w", err)
+	}
+
+	type target struct {
+		flake, binary string
+		storeOnly     bool
+	}
+	var targets []target
+	for _, l := range cfg.LSPs {
+		if l.Flake != "" {
+			targets = append(targets, target{flake: l.Flake, binary: l.Binary})
+		}
+		for _, dep := range l.RuntimeDeps {
+			targets = append(targets, target{flake: dep, storeOnly: true})
+		}
+	}
+	for _, f := range fmtCfg.Formatters {
+		if f.Flake != "" && !f.Disabled {
+			targets = append(targets, target{flake: f.Flake, binary: f.Binary})
+		}
+		for _, dep := range f.RuntimeDeps {
+			targets = append(targets, target{flake: dep, storeOnly: true})
+		}
+	}
+
+	executor := server.NewExecutor()
+	cache := executor.BuildCache()
+	for _, t := range targets {
+		if err := cache.Clear(t.flake); err != nil {
+			return err
+		}
+	}
+
+	ctx = subprocess.PrebuildContext(ctx)
+	var failed int
+	for _, t := range targets {
+		var path string
+		if t.storeOnly {
+			path, err = executor.BuildStorePath(ctx, t.flake)
+		} else {
+			path, err = executor.Build(ctx, t.flake, t.binary)
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", t.flake, err)
+			continue
+		}
+		fmt.Printf("%s\t%s\n", t.flake, path)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d builds failed", failed, len(targets))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// gcGracePeriod is how long gc keeps a root after its last use when the
+// global config does not name its flake. Project configs can add servers
+// and formatters that gc cannot see, so their roots survive until they go
+// unused for this long.
+const gcGracePeriod = 30 * 24 * time.Hour
+
+// runGC removes the GC roots of flakes that are no longer configured and
+// have not been used within the grace period.
+func runGC() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	fmtCfg, err := config.LoadMergedFormatters()
+	if err != nil {
+		return fmt.Errorf("loading formatter config: %w", err)
+	}
+
+	configured := gcFlakes(cfg, fmtCfg)
+	lastUsed := make(map[string]time.Time)
+	for _, entry := range subprocess.NewBuildCache(config.BuildCachePath()).Entries() {
+		for _, t := range []time.Time{entry.BuiltAt, entry.UsedAt} {
+			if t.After(lastUsed[entry.Flake]) {
+				lastUsed[entry.Flake] = t
+			}
+		}
+	}
+
+	roots := subprocess.NewGCRoots(config.GCRootsDir())
+	list, err := roots.List()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-gcGracePeriod)
+	var removed int
+	for _, root := range list {
+		if configured[root.Flake] {
+			continue
+		}
+		if info, err := os.Lstat(root.Link); err == nil && info.ModTime().After(lastUsed[root.Flake]) {
+			lastUsed[root.Flake] = info.ModTime()
+		}
+		if lastUsed[root.Flake].After(cutoff) {
+			continue
+		}
+		if err := roots.Remove(root.Flake); err != nil {
+			return err
+		}
+		removed++
+		fmt.Printf("removed\t%s\t%s\n", root.Flake, root.StorePath)
+	}
+
+	fmt.Printf("%d of %d roots removed\n", removed, len(list))
+	return nil
+}
+
+// gcFlakes returns every flake the config names, including those of
+// disabled formatters, which a project config may enable again.
+func gcFlakes(cfg *config.Config, fmtCfg *config.FormatterConfig) map[string]bool {
+	flakes := make(map[string]bool)
+	for _, l := range cfg.LSPs {
+		flakes[l.Flake] = true
+		for _, dep := range l.RuntimeDeps {
+			flakes[dep] = true
+		}
+	}
+	for _, f := range fmtCfg.Formatters {
+		flakes[f.Flake] = true
+		for _, dep := range f.RuntimeDeps {
+			flakes[dep] = true
+		}
+	}
+	return flakes
+}
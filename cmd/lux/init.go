@@ -80,6 +80,7 @@ func defaultConfigFiles(configDir, filetypeDir string) map[string]string {
 const defaultLSPsConfig = `[[lsp]]
 name = "gopls"
 flake = "nixpkgs#gopls"
+runtime_deps = ["nixpkgs#go"]
 
 [[lsp]]
 name = "pyright"
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// flakeTarget is a flake and the LSPs and formatters that use it.
+type flakeTarget struct {
+	flake string
+	names []string
+}
+
+func (t flakeTarget) usedBy(name string) bool {
+	for _, n := range t.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runLock writes lux.lock for the configured flakes. Entries are only
+// re-resolved when update is set, and then only those of name if given.
+func runLock(ctx context.Context, update bool, name string) error {
+	if name != "" && !update {
+		return fmt.Errorf("a name can only be given with --update")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	fmtCfg, err := config.LoadMergedFormatters()
+	if err != nil {
+		return fmt.Errorf("loading formatter config: %w", err)
+	}
+
+	targets := configuredFlakes(cfg, fmtCfg)
+	if name != "" && !hasFlakeTarget(targets, name) {
+		return fmt.Errorf("unknown LSP or formatter: %s", name)
+	}
+
+	path := config.LockPath()
+	lock, err := config.LoadLockFrom(path)
+	if err != nil {
+		return err
+	}
+
+	// Resolve against the flakes as they are now, not the existing pins.
+	executor := subprocess.NewNixExecutor()
+	ctx = subprocess.PrebuildContext(ctx)
+
+	keep := make(map[string]bool)
+	var failed int
+	for _, t := range targets {
+		keep[t.flake] = true
+
+		refresh := update && (name == "" || t.usedBy(name))
+		if _, ok := lock.Find(t.flake); ok && !refresh {
+			continue
+		}
+
+		pin, err := executor.Resolve(ctx, t.flake)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", t.flake, err)
+			continue
+		}
+
+		lock.Set(config.LockEntry{
+			Name:      t.names[0],
+			Flake:     t.flake,
+			URL:       pin.URL,
+			Revision:  pin.Revision,
+			NarHash:   pin.NarHash,
+			StorePath: pin.StorePath,
+		})
+		fmt.Printf("%s\t%s\t%s\n", t.names[0], t.flake, pin.StorePath)
+	}
+
+	lock.Retain(keep)
+	if err := config.SaveLockTo(path, lock); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d flakes could not be locked", failed)
+	}
+	return nil
+}
+
+// configuredFlakes lists every flake lux builds, in config order.
+func configuredFlakes(cfg *config.Config, fmtCfg *config.FormatterConfig) []flakeTarget {
+	index := make(map[string]int)
+	var targets []flakeTarget
+	add := func(name, flake string) {
+		if flake == "" {
+			return
+		}
+		if i, ok := index[flake]; ok {
+			if !targets[i].usedBy(name) {
+				targets[i].names = append(targets[i].names, name)
+			}
+			return
+		}
+		index[flake] = len(targets)
+		targets = append(targets, flakeTarget{flake: flake, names: []string{name}})
+	}
+
+	for _, l := range cfg.LSPs {
+		add(l.Name, l.Flake)
+		for _, dep := range l.RuntimeDeps {
+			add(l.Name, dep)
+		}
+	}
+	for _, f := range fmtCfg.Formatters {
+		if f.Disabled {
+			continue
+		}
+		add(f.Name, f.Flake)
+		for _, dep := range f.RuntimeDeps {
+			add(f.Name, dep)
+		}
+	}
+	return targets
+}
+
+func hasFlakeTarget(targets []flakeTarget, name string) bool {
+	for _, t := range targets {
+		if t.usedBy(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,11 +4,25 @@ import (
 	"context"
 	"fmt"
 	"os"
+
+	"github.com/amarbel-llc/lux/internal/subprocess"
 )
 
 var version = "dev"
 
 func main() {
+	// Servers with resource limits are started through lux itself; see
+	// subprocess.ExecLimitsCommand. This runs before the CLI so the server's
+	// own arguments are passed through untouched.
+	if len(os.Args) > 1 && os.Args[1] == subprocess.ExecLimitsCommand {
+		err := subprocess.ExecUnderLimits(os.Args[2:])
+		fmt.Fprintf(os.Stderr, "[lux] %v\n", err)
+		os.Exit(126)
+	}
+	if self, err := os.Executable(); err == nil {
+		subprocess.SetLimitsLauncher(self)
+	}
+
 	app := buildApp()
 	if err := app.RunCLI(context.Background(), os.Args[1:], nil); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
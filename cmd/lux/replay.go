@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/config"
+	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/trace"
+)
+
+func runReplay(ctx context.Context, path, lspName, dir, timeout string) error {
+	wait, err := time.ParseDuration(timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening trace: %w", err)
+	}
+	entries, err := trace.ReadEntries(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if lspName == "" {
+		names := make(map[string]bool)
+		for _, peer := range trace.ServerPeers(entries) {
+			name, _, _ := strings.Cut(peer, "@")
+			names[name] = true
+		}
+		if len(names) != 1 {
+			return fmt.Errorf("trace contains %d LSPs, choose one with --lsp", len(names))
+		}
+		for name := range names {
+			lspName = name
+		}
+	}
+
+	msgs := trace.ServerMessages(entries, lspName)
+	if len(msgs) == 0 {
+		return fmt.Errorf("trace has no messages for %s", lspName)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	l := cfg.FindLSP(lspName)
+	if l == nil {
+		return fmt.Errorf("unknown LSP: %s", lspName)
+	}
+
+	nix := server.NewExecutor()
+	var executor subprocess.Executor = nix
+	source := l.Flake
+	if l.Command != "" {
+		executor, source = subprocess.NewCommandExecutor(), l.Command
+	}
+
+	binPath, err := executor.Build(ctx, source, l.Binary)
+	if err != nil {
+		return fmt.Errorf("building %s: %w", lspName, err)
+	}
+
+	env, err := subprocess.WithRuntimeDeps(ctx, nix, l.RuntimeDeps, l.Env)
+	if err != nil {
+		return fmt.Errorf("building runtime deps for %s: %w", lspName, err)
+	}
+
+	proc, err := executor.Execute(ctx, binPath, l.Args, env, dir)
+	if err != nil {
+		return fmt.Errorf("executing %s: %w", lspName, err)
+	}
+	defer func() {
+		proc.Kill()
+		proc.Wait()
+	}()
+	go subprocess.NewStderrLogger(lspName, os.Stderr).Run(proc.Stderr)
+
+	fmt.Fprintf(os.Stderr, "[lux] replaying %d messages to %s\n", len(msgs), lspName)
+	return trace.Replay(ctx, msgs, proc.Stdout, proc.Stdin, trace.NewRecorder(os.Stdout), wait)
+}
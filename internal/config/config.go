@@ -3,35 +3,76 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
-	Socket string `toml:"socket"`
-	LSPs   []LSP  `toml:"lsp"`
+	Socket   string `toml:"socket"`
+	Prebuild string `toml:"prebuild,omitempty"`
+	LSPs     []LSP  `toml:"lsp"`
 }
 
 type LSP struct {
-	Name         string              `toml:"name"`
-	Flake        string              `toml:"flake"`
-	Binary       string              `toml:"binary,omitempty"`
-	Args         []string            `toml:"args"`
-	Env          map[string]string   `toml:"env,omitempty"`
-	InitOptions  map[string]any      `toml:"init_options,omitempty"`
-	Settings     map[string]any      `toml:"settings,omitempty"`
-	SettingsKey  string              `toml:"settings_key,omitempty"`
+	Name            string              `toml:"name"`
+	Flake           string              `toml:"flake,omitempty"`
+	Command         string              `toml:"command,omitempty"`
+	Binary          string              `toml:"binary,omitempty"`
+	Args            []string            `toml:"args"`
+	Env             map[string]string   `toml:"env,omitempty"`
+	RuntimeDeps     []string            `toml:"runtime_deps,omitempty"`
+	InitOptions     map[string]any      `toml:"init_options,omitempty"`
+	Settings        map[string]any      `toml:"settings,omitempty"`
+	SettingsKey     string              `toml:"settings_key,omitempty"`
 	Capabilities    *CapabilityOverride `toml:"capabilities,omitempty"`
 	WaitForReady    *bool               `toml:"wait_for_ready,omitempty"`
 	ReadyTimeout    string              `toml:"ready_timeout,omitempty"`
 	ActivityTimeout string              `toml:"activity_timeout,omitempty"`
 	EagerStart      *bool               `toml:"eager_start,omitempty"`
+	InstanceScope   string              `toml:"instance_scope,omitempty"`
+	Environment     string              `toml:"environment,omitempty"`
+	IdleTimeout     string              `toml:"idle_timeout,omitempty"`
+	MaxMemory       string              `toml:"max_memory,omitempty"`
+	HangTimeout     string              `toml:"hang_timeout,omitempty"`
+	ProbeInterval   string              `toml:"probe_interval,omitempty"`
+	PathMap         map[string]string   `toml:"path_map,omitempty"`
+	Transport       string              `toml:"transport,omitempty"`
+	Address         string              `toml:"address,omitempty"`
+	Nice            int                 `toml:"nice,omitempty"`
+	MaxAddressSpace string              `toml:"max_address_space,omitempty"`
+	MaxOpenFiles    int                 `toml:"max_open_files,omitempty"`
 }
 
+const (
+	InstanceScopeShared  = "shared"
+	InstanceScopeProject = "project"
+)
+
+const (
+	PrebuildAll          = "all"
+	PrebuildUsedRecently = "used-recently"
+	PrebuildNone         = "none"
+)
+
+const (
+	TransportStdio  = "stdio"
+	TransportTCP    = "tcp"
+	TransportSocket = "socket"
+)
+
+const (
+	EnvironmentInherit  = "inherit"
+	EnvironmentDevShell = "devshell"
+	EnvironmentDirenv   = "direnv"
+)
+
 type CapabilityOverride struct {
 	Disable []string `toml:"disable,omitempty"`
 	Enable  []string `toml:"enable,omitempty"`
@@ -82,6 +123,17 @@ func CapabilitiesDir() string {
 	return filepath.Join(dataDir(), "capabilities")
 }
 
+// BuildCachePath is where resolved flake store paths are kept across runs.
+func BuildCachePath() string {
+	return filepath.Join(dataDir(), "build-cache.json")
+}
+
+// GCRootsDir holds the indirect nix GC roots that keep the store paths of
+// servers and formatters alive.
+func GCRootsDir() string {
+	return filepath.Join(dataDir(), "gcroots")
+}
+
 func (c *Config) SocketPath() string {
 	if c.Socket != "" {
 		return c.Socket
@@ -115,19 +167,97 @@ func LoadFrom(path string) (*Config, error) {
 }
 
 func (c *Config) Validate() error {
+	switch c.Prebuild {
+	case "", PrebuildAll, PrebuildUsedRecently, PrebuildNone:
+	default:
+		return fmt.Errorf("invalid prebuild %q (expected %q, %q or %q)", c.Prebuild, PrebuildAll, PrebuildUsedRecently, PrebuildNone)
+	}
+
 	names := make(map[string]bool)
 	for i, lsp := range c.LSPs {
 		if lsp.Name == "" {
 			return fmt.Errorf("lsp[%d]: name is required", i)
 		}
-		if lsp.Flake == "" {
-			return fmt.Errorf("lsp[%d] (%s): flake is required", i, lsp.Name)
+		if lsp.Flake == "" && lsp.Command == "" && lsp.Address == "" {
+			return fmt.Errorf("lsp[%d] (%s): flake or command is required", i, lsp.Name)
+		}
+		if lsp.Flake != "" && lsp.Command != "" {
+			return fmt.Errorf("lsp[%d] (%s): flake and command are mutually exclusive", i, lsp.Name)
+		}
+		if lsp.Command != "" {
+			if strings.ContainsRune(lsp.Command, '/') && !filepath.IsAbs(lsp.Command) {
+				return fmt.Errorf("lsp[%d] (%s): command must be a name on PATH or an absolute path, got %q", i, lsp.Name, lsp.Command)
+			}
+			if lsp.Binary != "" {
+				return fmt.Errorf("lsp[%d] (%s): binary only applies to flake", i, lsp.Name)
+			}
 		}
 		if names[lsp.Name] {
 			return fmt.Errorf("lsp[%d]: duplicate name %q", i, lsp.Name)
 		}
 		names[lsp.Name] = true
 
+		switch lsp.InstanceScope {
+		case "", InstanceScopeShared, InstanceScopeProject:
+		default:
+			return fmt.Errorf("lsp[%d] (%s): invalid instance_scope %q (expected %q or %q)", i, lsp.Name, lsp.InstanceScope, InstanceScopeShared, InstanceScopeProject)
+		}
+
+		if err := validateEnvironment(lsp.Environment); err != nil {
+			return fmt.Errorf("lsp[%d] (%s): %w", i, lsp.Name, err)
+		}
+
+		if err := lsp.validateTransport(); err != nil {
+			return fmt.Errorf("lsp[%d] (%s): %w", i, lsp.Name, err)
+		}
+
+		if lsp.IdleTimeout != "" {
+			if _, err := time.ParseDuration(lsp.IdleTimeout); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid idle_timeout: %w", i, lsp.Name, err)
+			}
+		}
+
+		if lsp.MaxMemory != "" {
+			if _, err := ParseByteSize(lsp.MaxMemory); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid max_memory: %w", i, lsp.Name, err)
+			}
+		}
+
+		if lsp.HangTimeout != "" {
+			if _, err := time.ParseDuration(lsp.HangTimeout); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid hang_timeout: %w", i, lsp.Name, err)
+			}
+		}
+
+		if lsp.ProbeInterval != "" {
+			if _, err := time.ParseDuration(lsp.ProbeInterval); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid probe_interval: %w", i, lsp.Name, err)
+			}
+			if lsp.HangTimeoutDuration() <= 0 {
+				return fmt.Errorf("lsp[%d] (%s): probe_interval needs hang_timeout", i, lsp.Name)
+			}
+		}
+
+		if lsp.Nice < -20 || lsp.Nice > 19 {
+			return fmt.Errorf("lsp[%d] (%s): nice must be between -20 and 19, got %d", i, lsp.Name, lsp.Nice)
+		}
+
+		if lsp.MaxAddressSpace != "" {
+			if _, err := ParseByteSize(lsp.MaxAddressSpace); err != nil {
+				return fmt.Errorf("lsp[%d] (%s): invalid max_address_space: %w", i, lsp.Name, err)
+			}
+		}
+
+		if lsp.MaxOpenFiles < 0 {
+			return fmt.Errorf("lsp[%d] (%s): max_open_files must not be negative", i, lsp.Name)
+		}
+
+		for host, sandbox := range lsp.PathMap {
+			if !filepath.IsAbs(host) || !filepath.IsAbs(sandbox) {
+				return fmt.Errorf("lsp[%d] (%s): path_map entries must be absolute paths, got %q = %q", i, lsp.Name, host, sandbox)
+			}
+		}
+
 		// Validate environment variable names
 		for k := range lsp.Env {
 			if !isValidEnvVarName(k) {
@@ -161,6 +291,14 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// PrebuildPolicy returns which LSPs are built in the background at startup.
+func (c *Config) PrebuildPolicy() string {
+	if c.Prebuild == "" {
+		return PrebuildAll
+	}
+	return c.Prebuild
+}
+
 func (l *LSP) SettingsWireKey() string {
 	if l.SettingsKey != "" {
 		return l.SettingsKey
@@ -204,6 +342,162 @@ func (l *LSP) ActivityTimeoutDuration() time.Duration {
 	return d
 }
 
+// IsProjectScoped reports whether the LSP runs one instance per project root.
+func (l *LSP) IsProjectScoped() bool {
+	return l.InstanceScope == InstanceScopeProject
+}
+
+// IdleTimeoutDuration returns how long the LSP may sit without requests or
+// open documents before it is stopped. Zero means it is never stopped.
+func (l *LSP) IdleTimeoutDuration() time.Duration {
+	if l.IdleTimeout == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(l.IdleTimeout)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// UsesDevShell reports whether the server runs in the project flake's
+// devShell environment.
+func (l *LSP) UsesDevShell() bool {
+	return l.Environment == EnvironmentDevShell
+}
+
+// UsesDirenv reports whether the server runs with the variables direnv
+// exports for the project.
+func (l *LSP) UsesDirenv() bool {
+	return l.Environment == EnvironmentDirenv
+}
+
+// validateTransport checks that a network transport either attaches to a
+// valid address or launches the server with its placeholder filled in.
+func (l *LSP) validateTransport() error {
+	var placeholder string
+	switch l.Transport {
+	case "", TransportStdio:
+		if l.Address != "" {
+			return fmt.Errorf("address needs transport %q or %q", TransportTCP, TransportSocket)
+		}
+		return nil
+	case TransportTCP:
+		placeholder = "{port}"
+	case TransportSocket:
+		placeholder = "{socket}"
+	default:
+		return fmt.Errorf("invalid transport %q (expected %q, %q or %q)", l.Transport, TransportStdio, TransportTCP, TransportSocket)
+	}
+
+	if l.Address != "" {
+		if l.Flake != "" || l.Command != "" {
+			return fmt.Errorf("address attaches to a running server and cannot be combined with flake or command")
+		}
+		if l.Transport == TransportTCP {
+			if _, _, err := net.SplitHostPort(l.Address); err != nil {
+				return fmt.Errorf("invalid tcp address %q: %w", l.Address, err)
+			}
+		} else if !filepath.IsAbs(l.Address) {
+			return fmt.Errorf("socket address must be an absolute path, got %q", l.Address)
+		}
+		return nil
+	}
+
+	for _, arg := range l.Args {
+		if strings.Contains(arg, placeholder) {
+			return nil
+		}
+	}
+	for _, v := range l.Env {
+		if strings.Contains(v, placeholder) {
+			return nil
+		}
+	}
+	return fmt.Errorf("transport %q needs %s in args or env, or an address to attach to", l.Transport, placeholder)
+}
+
+func validateEnvironment(env string) error {
+	switch env {
+	case "", EnvironmentInherit, EnvironmentDevShell, EnvironmentDirenv:
+		return nil
+	default:
+		return fmt.Errorf("invalid environment %q (expected %q, %q or %q)", env, EnvironmentInherit, EnvironmentDevShell, EnvironmentDirenv)
+	}
+}
+
+// HangTimeoutDuration returns how long a request may wait for its response
+// before the LSP is considered hung. Zero disables the check.
+func (l *LSP) HangTimeoutDuration() time.Duration {
+	d, err := time.ParseDuration(l.HangTimeout)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// ProbeIntervalDuration returns how often an otherwise quiet LSP is probed.
+// Zero means it is not probed.
+func (l *LSP) ProbeIntervalDuration() time.Duration {
+	d, err := time.ParseDuration(l.ProbeInterval)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// MaxMemoryBytes returns the RSS above which the LSP is restarted. Zero means
+// no limit.
+func (l *LSP) MaxMemoryBytes() int64 {
+	n, err := ParseByteSize(l.MaxMemory)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// MaxAddressSpaceBytes returns the virtual memory limit of the LSP process.
+// Zero means no limit.
+func (l *LSP) MaxAddressSpaceBytes() int64 {
+	n, err := ParseByteSize(l.MaxAddressSpace)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// ParseByteSize parses sizes such as "512M", "2GiB" or "1073741824".
+// Suffixes are binary multiples; a trailing "B" or "iB" is optional.
+func ParseByteSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	num := strings.TrimRight(s, "KMGTiBkmgtb ")
+	unit := strings.ToUpper(strings.TrimSpace(s[len(num):]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+
+	n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	switch unit {
+	case "":
+	case "K":
+		n <<= 10
+	case "M":
+		n <<= 20
+	case "G":
+		n <<= 30
+	case "T":
+		n <<= 40
+	default:
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	return n, nil
+}
+
 func (c *Config) FindLSP(name string) *LSP {
 	for i := range c.LSPs {
 		if c.LSPs[i].Name == name {
@@ -264,44 +558,44 @@ func isValidEnvVarName(name string) bool {
 }
 
 var knownCapabilities = map[string]bool{
-	"hover":                       true,
-	"hoverProvider":               true,
-	"completion":                  true,
-	"completionProvider":          true,
-	"definition":                  true,
-	"definitionProvider":          true,
-	"typeDefinition":              true,
-	"typeDefinitionProvider":      true,
-	"implementation":              true,
-	"implementationProvider":      true,
-	"references":                  true,
-	"referencesProvider":          true,
-	"documentHighlight":           true,
-	"documentHighlightProvider":   true,
-	"documentSymbol":              true,
-	"documentSymbolProvider":      true,
-	"codeAction":                  true,
-	"codeActionProvider":          true,
-	"codeLens":                    true,
-	"codeLensProvider":            true,
-	"documentFormatting":          true,
-	"documentFormattingProvider":  true,
-	"documentRangeFormatting":     true,
+	"hover":                           true,
+	"hoverProvider":                   true,
+	"completion":                      true,
+	"completionProvider":              true,
+	"definition":                      true,
+	"definitionProvider":              true,
+	"typeDefinition":                  true,
+	"typeDefinitionProvider":          true,
+	"implementation":                  true,
+	"implementationProvider":          true,
+	"references":                      true,
+	"referencesProvider":              true,
+	"documentHighlight":               true,
+	"documentHighlightProvider":       true,
+	"documentSymbol":                  true,
+	"documentSymbolProvider":          true,
+	"codeAction":                      true,
+	"codeActionProvider":              true,
+	"codeLens":                        true,
+	"codeLensProvider":                true,
+	"documentFormatting":              true,
+	"documentFormattingProvider":      true,
+	"documentRangeFormatting":         true,
 	"documentRangeFormattingProvider": true,
-	"rename":                      true,
-	"renameProvider":              true,
-	"foldingRange":                true,
-	"foldingRangeProvider":        true,
-	"selectionRange":              true,
-	"selectionRangeProvider":      true,
-	"semanticTokens":              true,
-	"semanticTokensProvider":      true,
-	"inlayHint":                   true,
-	"inlayHintProvider":           true,
-	"diagnostic":                  true,
-	"diagnosticProvider":          true,
-	"workspaceSymbol":             true,
-	"workspaceSymbolProvider":     true,
+	"rename":                          true,
+	"renameProvider":                  true,
+	"foldingRange":                    true,
+	"foldingRangeProvider":            true,
+	"selectionRange":                  true,
+	"selectionRangeProvider":          true,
+	"semanticTokens":                  true,
+	"semanticTokensProvider":          true,
+	"inlayHint":                       true,
+	"inlayHintProvider":               true,
+	"diagnostic":                      true,
+	"diagnosticProvider":              true,
+	"workspaceSymbol":                 true,
+	"workspaceSymbolProvider":         true,
 }
 
 func isKnownCapability(name string) bool {
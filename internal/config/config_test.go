@@ -268,6 +268,84 @@ func TestLSP_SettingsValidation(t *testing.T) {
 	}
 }
 
+func TestLSP_InstanceScopeValidation(t *testing.T) {
+	tests := []struct {
+		scope   string
+		wantErr bool
+	}{
+		{"", false},
+		{InstanceScopeShared, false},
+		{InstanceScopeProject, false},
+		{"per-file", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			cfg := &Config{
+				LSPs: []LSP{{Name: "test", Flake: "nixpkgs#test", InstanceScope: tt.scope}},
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.LSPs[0].IsProjectScoped() != (tt.scope == InstanceScopeProject) {
+				t.Errorf("IsProjectScoped() = %v for scope %q", cfg.LSPs[0].IsProjectScoped(), tt.scope)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1048576", 1 << 20, false},
+		{"512M", 512 << 20, false},
+		{"512MB", 512 << 20, false},
+		{"2GiB", 2 << 30, false},
+		{"4 g", 4 << 30, false},
+		{"1.5G", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLSP_ResourceLimitsValidation(t *testing.T) {
+	valid := &Config{LSPs: []LSP{{Name: "ra", Flake: "nixpkgs#ra", IdleTimeout: "15m", MaxMemory: "4G"}}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid limits, got %v", err)
+	}
+	if got := valid.LSPs[0].IdleTimeoutDuration(); got != 15*time.Minute {
+		t.Errorf("IdleTimeoutDuration() = %v", got)
+	}
+	if got := valid.LSPs[0].MaxMemoryBytes(); got != 4<<30 {
+		t.Errorf("MaxMemoryBytes() = %d", got)
+	}
+
+	for _, l := range []LSP{
+		{Name: "ra", Flake: "nixpkgs#ra", IdleTimeout: "soon"},
+		{Name: "ra", Flake: "nixpkgs#ra", MaxMemory: "4Q"},
+	} {
+		cfg := &Config{LSPs: []LSP{l}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for %+v", l)
+		}
+	}
+}
+
 func TestLSP_SettingsWireKey(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -486,3 +564,168 @@ func TestLSP_ShouldWaitForReady(t *testing.T) {
 		})
 	}
 }
+
+func TestLSP_PathMapValidation(t *testing.T) {
+	valid := &Config{LSPs: []LSP{{Name: "ra", Flake: "nixpkgs#ra", PathMap: map[string]string{"/home/me/src": "/workspace"}}}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid path_map, got %v", err)
+	}
+
+	invalid := &Config{LSPs: []LSP{{Name: "ra", Flake: "nixpkgs#ra", PathMap: map[string]string{"src": "/workspace"}}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected error for relative path_map entry")
+	}
+}
+
+func TestLSP_RuntimeDeps_TOML(t *testing.T) {
+	input := `
+name = "gopls"
+flake = "nixpkgs#gopls"
+extensions = ["go"]
+runtime_deps = ["nixpkgs#go"]
+`
+	var lsp LSP
+	if err := toml.Unmarshal([]byte(input), &lsp); err != nil {
+		t.Fatalf("failed to parse TOML: %v", err)
+	}
+
+	if len(lsp.RuntimeDeps) != 1 || lsp.RuntimeDeps[0] != "nixpkgs#go" {
+		t.Errorf("expected runtime_deps [nixpkgs#go], got %v", lsp.RuntimeDeps)
+	}
+}
+
+func TestLSP_CommandValidation(t *testing.T) {
+	for _, l := range []LSP{
+		{Name: "gopls", Command: "gopls"},
+		{Name: "gopls", Command: "/usr/local/bin/gopls"},
+	} {
+		cfg := &Config{LSPs: []LSP{l}}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", l, err)
+		}
+	}
+
+	for _, l := range []LSP{
+		{Name: "gopls"},
+		{Name: "gopls", Flake: "nixpkgs#gopls", Command: "gopls"},
+		{Name: "gopls", Command: "bin/gopls"},
+		{Name: "gopls", Command: "gopls", Binary: "gopls"},
+	} {
+		cfg := &Config{LSPs: []LSP{l}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for %+v", l)
+		}
+	}
+}
+
+func TestLSP_TransportValidation(t *testing.T) {
+	for _, l := range []LSP{
+		{Name: "a", Flake: "nixpkgs#a", Transport: "stdio"},
+		{Name: "a", Flake: "nixpkgs#a", Transport: "tcp", Args: []string{"--port", "{port}"}},
+		{Name: "a", Command: "a", Transport: "socket", Env: map[string]string{"A_SOCKET": "{socket}"}},
+		{Name: "a", Transport: "tcp", Address: "127.0.0.1:6005"},
+		{Name: "a", Transport: "socket", Address: "/run/a.sock"},
+	} {
+		cfg := &Config{LSPs: []LSP{l}}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", l, err)
+		}
+	}
+
+	for _, l := range []LSP{
+		{Name: "a", Flake: "nixpkgs#a", Transport: "pipe"},
+		{Name: "a", Flake: "nixpkgs#a", Transport: "tcp"},
+		{Name: "a", Flake: "nixpkgs#a", Transport: "socket", Args: []string{"{port}"}},
+		{Name: "a", Flake: "nixpkgs#a", Address: "127.0.0.1:6005"},
+		{Name: "a", Flake: "nixpkgs#a", Transport: "tcp", Address: "127.0.0.1:6005"},
+		{Name: "a", Transport: "tcp", Address: "6005"},
+		{Name: "a", Transport: "socket", Address: "a.sock"},
+	} {
+		cfg := &Config{LSPs: []LSP{l}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for %+v", l)
+		}
+	}
+}
+
+func TestLSP_EnvironmentValidation(t *testing.T) {
+	valid := &Config{LSPs: []LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Environment: "devshell"}}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected devshell environment to be valid, got %v", err)
+	}
+	if !valid.LSPs[0].UsesDevShell() {
+		t.Error("expected UsesDevShell() to be true")
+	}
+
+	direnv := &Config{LSPs: []LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Environment: "direnv"}}}
+	if err := direnv.Validate(); err != nil || !direnv.LSPs[0].UsesDirenv() {
+		t.Errorf("expected direnv environment to be valid, got %v", err)
+	}
+
+	invalid := &Config{LSPs: []LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Environment: "shell"}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected error for unknown environment")
+	}
+}
+
+func TestConfig_PrebuildPolicy(t *testing.T) {
+	cfg := &Config{}
+	if got := cfg.PrebuildPolicy(); got != PrebuildAll {
+		t.Errorf("default PrebuildPolicy() = %q", got)
+	}
+
+	cfg.Prebuild = "used-recently"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected used-recently to be valid, got %v", err)
+	}
+
+	cfg.Prebuild = "sometimes"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for unknown prebuild policy")
+	}
+}
+
+func TestLSP_ResourceLimitValidation(t *testing.T) {
+	valid := &Config{LSPs: []LSP{{Name: "gopls", Flake: "nixpkgs#gopls", Nice: 10, MaxAddressSpace: "8G", MaxOpenFiles: 4096}}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected limits to be valid, got %v", err)
+	}
+	if got := valid.LSPs[0].MaxAddressSpaceBytes(); got != 8<<30 {
+		t.Errorf("MaxAddressSpaceBytes() = %d", got)
+	}
+
+	for _, l := range []LSP{
+		{Name: "gopls", Flake: "nixpkgs#gopls", Nice: 20},
+		{Name: "gopls", Flake: "nixpkgs#gopls", MaxAddressSpace: "lots"},
+		{Name: "gopls", Flake: "nixpkgs#gopls", MaxOpenFiles: -1},
+	} {
+		cfg := &Config{LSPs: []LSP{l}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for %+v", l)
+		}
+	}
+}
+
+func TestLSP_WatchdogValidation(t *testing.T) {
+	valid := &Config{LSPs: []LSP{{Name: "gopls", Flake: "nixpkgs#gopls", HangTimeout: "1m", ProbeInterval: "30s"}}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected watchdog settings to be valid, got %v", err)
+	}
+	if got := valid.LSPs[0].HangTimeoutDuration(); got != time.Minute {
+		t.Errorf("HangTimeoutDuration() = %v", got)
+	}
+	if got := valid.LSPs[0].ProbeIntervalDuration(); got != 30*time.Second {
+		t.Errorf("ProbeIntervalDuration() = %v", got)
+	}
+
+	for _, l := range []LSP{
+		{Name: "gopls", Flake: "nixpkgs#gopls", HangTimeout: "soon"},
+		{Name: "gopls", Flake: "nixpkgs#gopls", HangTimeout: "1m", ProbeInterval: "often"},
+		{Name: "gopls", Flake: "nixpkgs#gopls", ProbeInterval: "30s"},
+	} {
+		cfg := &Config{LSPs: []LSP{l}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for %+v", l)
+		}
+	}
+}
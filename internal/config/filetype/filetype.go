@@ -16,6 +16,7 @@ type Config struct {
 	Patterns      []string `toml:"patterns"`
 	LanguageIDs   []string `toml:"language_ids"`
 	LSP           string   `toml:"lsp"`
+	LSPs          []string `toml:"lsps,omitempty"`
 	Formatters    []string `toml:"formatters"`
 	FormatterMode string   `toml:"formatter_mode"`
 	LSPFormat     string   `toml:"lsp_format"`
@@ -37,6 +38,21 @@ func LocalDir() string {
 	return filepath.Join(".lux", "filetype")
 }
 
+// LSPNames returns every LSP attached to this filetype. The primary lsp comes
+// first, followed by the additional lsps in the order they were declared.
+func (c *Config) LSPNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range append([]string{c.LSP}, c.LSPs...) {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
 func (c *Config) EffectiveFormatterMode() string {
 	if c.FormatterMode == "" {
 		return "chain"
@@ -202,8 +218,10 @@ func Validate(configs []*Config, lsps, formatters map[string]bool) error {
 			return fmt.Errorf("filetype/%s.toml: at least one of extensions, patterns, or language_ids is required", cfg.Name)
 		}
 
-		if cfg.LSP != "" && !lsps[cfg.LSP] {
-			return fmt.Errorf("filetype/%s.toml: lsp %q not found in lsps.toml", cfg.Name, cfg.LSP)
+		for _, name := range cfg.LSPNames() {
+			if !lsps[name] {
+				return fmt.Errorf("filetype/%s.toml: lsp %q not found in lsps.toml", cfg.Name, name)
+			}
 		}
 
 		for _, f := range cfg.Formatters {
@@ -13,6 +13,7 @@ extensions = ["go"]
 patterns = ["go.mod", "go.sum"]
 language_ids = ["go"]
 lsp = "gopls"
+lsps = ["golangci-lint"]
 formatters = ["golines"]
 formatter_mode = "chain"
 lsp_format = "fallback"
@@ -40,6 +41,9 @@ lsp_format = "fallback"
 	if cfg.LSP != "gopls" {
 		t.Errorf("lsp = %q, want %q", cfg.LSP, "gopls")
 	}
+	if len(cfg.LSPs) != 1 || cfg.LSPs[0] != "golangci-lint" {
+		t.Errorf("lsps = %v, want [golangci-lint]", cfg.LSPs)
+	}
 	if len(cfg.Formatters) != 1 || cfg.Formatters[0] != "golines" {
 		t.Errorf("formatters = %v, want [golines]", cfg.Formatters)
 	}
@@ -148,6 +152,42 @@ func TestValidate_InvalidLSPFormat(t *testing.T) {
 	}
 }
 
+func TestValidate_UnknownAdditionalLSP(t *testing.T) {
+	configs := []*Config{{Name: "go", Extensions: []string{"go"}, LSP: "gopls", LSPs: []string{"unknown"}}}
+	err := Validate(configs, map[string]bool{"gopls": true}, nil)
+	if err == nil {
+		t.Fatal("expected error for unknown additional LSP")
+	}
+}
+
+func TestLSPNames(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{"none", Config{}, nil},
+		{"primary only", Config{LSP: "gopls"}, []string{"gopls"}},
+		{"additional only", Config{LSPs: []string{"eslint", "tailwind"}}, []string{"eslint", "tailwind"}},
+		{"primary first", Config{LSP: "tsserver", LSPs: []string{"eslint", "tailwind"}}, []string{"tsserver", "eslint", "tailwind"}},
+		{"deduplicated", Config{LSP: "gopls", LSPs: []string{"gopls", "golangci"}}, []string{"gopls", "golangci"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cfg.LSPNames()
+			if len(got) != len(tt.want) {
+				t.Fatalf("LSPNames() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("LSPNames()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
 func TestValidate_EmptyLSP(t *testing.T) {
 	configs := []*Config{{Name: "go", Extensions: []string{"go"}, Formatters: []string{"golines"}}}
 	err := Validate(configs, nil, map[string]bool{"golines": true})
@@ -20,14 +20,16 @@ type FormatterConfig struct {
 }
 
 type Formatter struct {
-	Name       string            `toml:"name"`
-	Flake      string            `toml:"flake"`
-	Binary     string            `toml:"binary,omitempty"`
-	Path       string            `toml:"path"`
-	Args       []string          `toml:"args"`
-	Env        map[string]string `toml:"env"`
-	Mode       FormatterMode     `toml:"mode"`
-	Disabled   bool              `toml:"disabled"`
+	Name        string            `toml:"name"`
+	Flake       string            `toml:"flake"`
+	Binary      string            `toml:"binary,omitempty"`
+	Path        string            `toml:"path"`
+	Args        []string          `toml:"args"`
+	Env         map[string]string `toml:"env"`
+	RuntimeDeps []string          `toml:"runtime_deps,omitempty"`
+	Environment string            `toml:"environment,omitempty"`
+	Mode        FormatterMode     `toml:"mode"`
+	Disabled    bool              `toml:"disabled"`
 }
 
 func FormatterConfigPath() string {
@@ -124,6 +126,10 @@ func (cfg *FormatterConfig) Validate() error {
 			return fmt.Errorf("formatter[%d] (%s): flake and path are mutually exclusive", i, f.Name)
 		}
 
+		if err := validateEnvironment(f.Environment); err != nil {
+			return fmt.Errorf("formatter[%d] (%s): %w", i, f.Name, err)
+		}
+
 		if f.Mode != "" && f.Mode != FormatterModeStdin && f.Mode != FormatterModeFilepath {
 			return fmt.Errorf("formatter[%d] (%s): invalid mode %q (must be %q or %q)", i, f.Name, f.Mode, FormatterModeStdin, FormatterModeFilepath)
 		}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Lock pins the flakes of servers, runtime dependencies and formatters to
+// the exact revision and store path they resolved to, so everyone sharing
+// a config runs the same builds. It is written by `lux lock`.
+type Lock struct {
+	Entries []LockEntry `toml:"entry"`
+}
+
+// LockEntry is the resolved form of one flake reference. Name is the
+// server or formatter the flake belongs to; a flake shared by several of
+// them is recorded once.
+type LockEntry struct {
+	Name      string `toml:"name"`
+	Flake     string `toml:"flake"`
+	URL       string `toml:"url"`
+	Revision  string `toml:"revision,omitempty"`
+	NarHash   string `toml:"nar_hash"`
+	StorePath string `toml:"store_path"`
+}
+
+// LockPath is lux.lock next to the config.
+func LockPath() string {
+	return filepath.Join(configDir(), "lux.lock")
+}
+
+// LoadLockFrom reads a lock file. A missing file is an empty lock.
+func LoadLockFrom(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Lock{}, nil
+		}
+		return nil, fmt.Errorf("reading lock file: %w", err)
+	}
+
+	var lock Lock
+	if err := toml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("parsing lock file: %w", err)
+	}
+
+	for i, e := range lock.Entries {
+		if e.Flake == "" || e.URL == "" || e.StorePath == "" {
+			return nil, fmt.Errorf("lock entry %d: flake, url and store_path are required", i+1)
+		}
+	}
+
+	return &lock, nil
+}
+
+// SaveLockTo writes lock to path, sorted so diffs stay small.
+func SaveLockTo(path string, lock *Lock) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+
+	sort.Slice(lock.Entries, func(i, j int) bool {
+		if lock.Entries[i].Name != lock.Entries[j].Name {
+			return lock.Entries[i].Name < lock.Entries[j].Name
+		}
+		return lock.Entries[i].Flake < lock.Entries[j].Flake
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by `lux lock`. Refresh with `lux lock --update`.\n\n")
+	if err := toml.NewEncoder(&buf).Encode(lock); err != nil {
+		return fmt.Errorf("encoding lock file: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing lock file: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Find returns the entry pinning flake.
+func (l *Lock) Find(flake string) (LockEntry, bool) {
+	for _, e := range l.Entries {
+		if e.Flake == flake {
+			return e, true
+		}
+	}
+	return LockEntry{}, false
+}
+
+// Set adds entry, replacing any entry for the same flake.
+func (l *Lock) Set(entry LockEntry) {
+	for i, e := range l.Entries {
+		if e.Flake == entry.Flake {
+			l.Entries[i] = entry
+			return
+		}
+	}
+	l.Entries = append(l.Entries, entry)
+}
+
+// Retain drops the entries whose flake is not in flakes.
+func (l *Lock) Retain(flakes map[string]bool) {
+	kept := l.Entries[:0]
+	for _, e := range l.Entries {
+		if flakes[e.Flake] {
+			kept = append(kept, e)
+		}
+	}
+	l.Entries = kept
+}
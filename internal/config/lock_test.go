@@ -0,0 +1,36 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLock_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lux.lock")
+
+	lock, err := LoadLockFrom(path)
+	if err != nil || len(lock.Entries) != 0 {
+		t.Fatalf("missing lock file should load empty, got %+v, %v", lock, err)
+	}
+
+	lock.Set(LockEntry{Name: "gopls", Flake: "nixpkgs#gopls", URL: "github:NixOS/nixpkgs/abc", NarHash: "sha256-a", StorePath: "/nix/store/a-gopls"})
+	lock.Set(LockEntry{Name: "gopls", Flake: "nixpkgs#go", URL: "github:NixOS/nixpkgs/abc", NarHash: "sha256-a", StorePath: "/nix/store/a-go"})
+	lock.Set(LockEntry{Name: "gopls", Flake: "nixpkgs#gopls", URL: "github:NixOS/nixpkgs/def", NarHash: "sha256-b", StorePath: "/nix/store/b-gopls"})
+	lock.Retain(map[string]bool{"nixpkgs#gopls": true})
+
+	if err := SaveLockTo(path, lock); err != nil {
+		t.Fatalf("SaveLockTo: %v", err)
+	}
+
+	loaded, err := LoadLockFrom(path)
+	if err != nil {
+		t.Fatalf("LoadLockFrom: %v", err)
+	}
+	if len(loaded.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %+v", loaded.Entries)
+	}
+	entry, ok := loaded.Find("nixpkgs#gopls")
+	if !ok || entry.StorePath != "/nix/store/b-gopls" || entry.NarHash != "sha256-b" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
@@ -54,14 +54,18 @@ func loadProjectConfig(projectRoot string) (*Config, error) {
 // Strategy: LSPs by name are deeply merged, new LSPs are added
 func mergeConfigs(global, project *Config) *Config {
 	merged := &Config{
-		Socket: global.Socket,
-		LSPs:   make([]LSP, 0, len(global.LSPs)+len(project.LSPs)),
+		Socket:   global.Socket,
+		Prebuild: global.Prebuild,
+		LSPs:     make([]LSP, 0, len(global.LSPs)+len(project.LSPs)),
 	}
 
 	// Use project socket if specified
 	if project.Socket != "" {
 		merged.Socket = project.Socket
 	}
+	if project.Prebuild != "" {
+		merged.Prebuild = project.Prebuild
+	}
 
 	// Build map of project LSPs by name
 	projectMap := make(map[string]LSP)
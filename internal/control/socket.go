@@ -83,6 +83,11 @@ func (s *Server) handleConn(conn net.Conn) {
 			continue
 		}
 
+		if parts := strings.Fields(line); len(parts) == 3 && parts[0] == "logs" && parts[2] == "follow" {
+			s.followLogs(conn, reader, parts[1])
+			return
+		}
+
 		response := s.handleCommand(line)
 		conn.Write([]byte(response + "\n"))
 	}
@@ -117,6 +122,11 @@ func (s *Server) handleCommand(line string) string {
 			return `{"error": "warmup requires directory path"}`
 		}
 		return s.handleWarmup(args[0])
+	case "logs":
+		if len(args) < 1 {
+			return `{"error": "logs requires LSP name"}`
+		}
+		return s.handleLogs(args[0])
 	default:
 		return fmt.Sprintf(`{"error": "unknown command: %s"}`, cmd)
 	}
@@ -134,13 +144,8 @@ func (s *Server) handleStatus() string {
 }
 
 func (s *Server) handleList() string {
-	statuses := s.pool.Status()
-	var names []string
-	for _, st := range statuses {
-		names = append(names, st.Name)
-	}
 	data, err := json.Marshal(map[string]any{
-		"lsps": names,
+		"lsps": s.pool.Names(),
 	})
 	if err != nil {
 		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
@@ -172,6 +177,53 @@ func (s *Server) handleWarmup(dir string) string {
 	return `{"ok": true}`
 }
 
+func (s *Server) handleLogs(name string) string {
+	entries, err := s.pool.Logs(name)
+	if err != nil {
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
+	}
+	data, err := json.Marshal(map[string]any{
+		"entries": entries,
+	})
+	if err != nil {
+		return fmt.Sprintf(`{"error": "%s"}`, err.Error())
+	}
+	return string(data)
+}
+
+// followLogs answers `logs <name> follow` with the buffered entries and then
+// streams one {"entry": ...} line per new entry until the client hangs up.
+func (s *Server) followLogs(conn net.Conn, reader *bufio.Reader, name string) {
+	backlog, entries, stop, err := s.pool.FollowLogs(name)
+	if err != nil {
+		fmt.Fprintf(conn, "{\"error\": \"%s\"}\n", err.Error())
+		return
+	}
+	defer stop()
+
+	enc := json.NewEncoder(conn)
+	if err := enc.Encode(map[string]any{"entries": backlog}); err != nil {
+		return
+	}
+
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, reader)
+		close(gone)
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case e := <-entries:
+			if err := enc.Encode(map[string]any{"entry": e}); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func (s *Server) Close() error {
 	s.mu.Lock()
 	s.closed = true
@@ -246,7 +298,23 @@ func (c *Client) Status(w io.Writer) error {
 		}
 		name := lsp["name"].(string)
 		state := lsp["state"].(string)
-		fmt.Fprintf(w, "%-20s %s\n", name, state)
+		line := fmt.Sprintf("%-20s %-10s", name, state)
+		if root, ok := lsp["project_root"].(string); ok && root != "" {
+			line += " " + root
+		}
+		if direnv, ok := lsp["direnv"].(string); ok && direnv != "" {
+			line += " direnv:" + direnv
+		}
+		if rooted, _ := lsp["rooted"].(bool); rooted {
+			line += " rooted"
+		}
+		if rss, ok := lsp["rss"].(float64); ok && rss > 0 {
+			line += fmt.Sprintf(" rss:%dMiB", int64(rss)>>20)
+		}
+		if cpu, ok := lsp["cpu_percent"].(float64); ok && cpu > 0 {
+			line += fmt.Sprintf(" cpu:%.1f%%", cpu)
+		}
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
 	}
 
 	return nil
@@ -266,3 +334,64 @@ func (c *Client) Warmup(dir string) error {
 	_, err := c.sendCommand("warmup " + dir)
 	return err
 }
+
+// Logs prints the buffered log of an LSP. With follow it keeps printing new
+// entries until the connection ends.
+func (c *Client) Logs(w io.Writer, name string, follow bool) error {
+	cmd := "logs " + name
+	if follow {
+		cmd += " follow"
+	}
+	if _, err := c.conn.Write([]byte(cmd + "\n")); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(c.conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	var backlog struct {
+		Entries []subprocess.LogEntry `json:"entries"`
+		Error   string                `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(line), &backlog); err != nil {
+		return err
+	}
+	if backlog.Error != "" {
+		return fmt.Errorf("%s", backlog.Error)
+	}
+	for _, e := range backlog.Entries {
+		printLogEntry(w, e)
+	}
+
+	if !follow {
+		return nil
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var msg struct {
+			Entry subprocess.LogEntry `json:"entry"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return err
+		}
+		printLogEntry(w, msg.Entry)
+	}
+}
+
+func printLogEntry(w io.Writer, e subprocess.LogEntry) {
+	source := string(e.Source)
+	if e.Level != "" {
+		source += "/" + e.Level
+	}
+	fmt.Fprintf(w, "%s [%s] %s: %s\n", e.Time.Local().Format("15:04:05.000"), e.Instance, source, e.Text)
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/amarbel-llc/lux/internal/config"
@@ -33,14 +34,39 @@ func Format(ctx context.Context, f *config.Formatter, filePath string, content [
 		return nil, fmt.Errorf("resolving formatter %s: %w", f.Name, err)
 	}
 
+	env := f.Env
+	if f.Environment == config.EnvironmentDevShell {
+		shell, err := subprocess.DevShellEnv(ctx, executor, filepath.Dir(filePath))
+		if err != nil {
+			return nil, fmt.Errorf("resolving formatter %s: %w", f.Name, err)
+		}
+		env = subprocess.WithDevShell(shell, env)
+	}
+	if f.Environment == config.EnvironmentDirenv {
+		root, err := config.FindProjectRoot(filePath)
+		if err != nil {
+			root = filepath.Dir(filePath)
+		}
+		vars, _, err := subprocess.DirenvEnv(ctx, executor, root)
+		if err != nil {
+			return nil, fmt.Errorf("resolving formatter %s: %w", f.Name, err)
+		}
+		env = subprocess.WithDirenv(vars, env)
+	}
+
+	env, err = subprocess.WithRuntimeDeps(ctx, executor, f.RuntimeDeps, env)
+	if err != nil {
+		return nil, fmt.Errorf("resolving formatter %s: %w", f.Name, err)
+	}
+
 	args := SubstituteArgs(f.Args, filePath)
 
 	mode := f.EffectiveMode()
 	switch mode {
 	case config.FormatterModeStdin:
-		return formatStdin(ctx, binPath, args, f.Env, content)
+		return formatStdin(ctx, binPath, args, env, content)
 	case config.FormatterModeFilepath:
-		return formatFilepath(ctx, binPath, args, f.Env, filePath, content)
+		return formatFilepath(ctx, binPath, args, env, filePath, content)
 	default:
 		return nil, fmt.Errorf("unknown formatter mode: %s", mode)
 	}
@@ -46,7 +46,7 @@ func MergeCapabilities(caps ...ServerCapabilities) ServerCapabilities {
 			merged.DocumentSymbolProvider = mergeBoolOrOptions(merged.DocumentSymbolProvider, c.DocumentSymbolProvider)
 		}
 		if c.CodeActionProvider != nil {
-			merged.CodeActionProvider = mergeBoolOrOptions(merged.CodeActionProvider, c.CodeActionProvider)
+			merged.CodeActionProvider = mergeCodeActionProvider(merged.CodeActionProvider, c.CodeActionProvider)
 		}
 		if c.CodeLensProvider != nil {
 			merged.CodeLensProvider = mergeCodeLensOptions(merged.CodeLensProvider, c.CodeLensProvider)
@@ -119,6 +119,32 @@ func mergeBoolOrOptions(a, b any) any {
 	return a
 }
 
+// mergeCodeActionProvider merges like mergeBoolOrOptions but advertises
+// resolveProvider when either side does, since resolve requests are routed
+// back to the server that produced the action.
+func mergeCodeActionProvider(a, b any) any {
+	merged := mergeBoolOrOptions(a, b)
+	if !codeActionResolvable(a) && !codeActionResolvable(b) {
+		return merged
+	}
+
+	opts := map[string]any{}
+	for _, provider := range []any{b, merged} {
+		if m, ok := provider.(map[string]any); ok {
+			for k, v := range m {
+				opts[k] = v
+			}
+		}
+	}
+	opts["resolveProvider"] = true
+	return opts
+}
+
+func codeActionResolvable(provider any) bool {
+	opts, ok := provider.(map[string]any)
+	return ok && opts["resolveProvider"] == true
+}
+
 func mergeCompletionOptions(a, b *CompletionOptions) *CompletionOptions {
 	if a == nil {
 		return b
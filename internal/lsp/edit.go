@@ -0,0 +1,95 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// WorkspaceEdit is a set of changes to several documents. Servers send
+// either Changes or, when the client supports it, DocumentChanges.
+type WorkspaceEdit struct {
+	Changes         map[DocumentURI][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []DocumentChange           `json:"documentChanges,omitempty"`
+}
+
+// DocumentChange is one entry of WorkspaceEdit.DocumentChanges: a
+// TextDocumentEdit when Kind is empty, otherwise a CreateFile, RenameFile
+// or DeleteFile operation.
+type DocumentChange struct {
+	// TextDocumentEdit
+	TextDocument *OptionalVersionedTextDocumentIdentifier `json:"textDocument,omitempty"`
+	Edits        []TextEdit                               `json:"edits,omitempty"`
+
+	// File operations
+	Kind    string             `json:"kind,omitempty"`
+	URI     DocumentURI        `json:"uri,omitempty"`
+	OldURI  DocumentURI        `json:"oldUri,omitempty"`
+	NewURI  DocumentURI        `json:"newUri,omitempty"`
+	Options *FileChangeOptions `json:"options,omitempty"`
+}
+
+const (
+	FileChangeCreate = "create"
+	FileChangeRename = "rename"
+	FileChangeDelete = "delete"
+)
+
+// ApplyWorkspaceEditParams is the payload of a workspace/applyEdit request
+// sent by a server, typically while it executes a command.
+type ApplyWorkspaceEditParams struct {
+	Label string        `json:"label,omitempty"`
+	Edit  WorkspaceEdit `json:"edit"`
+}
+
+type ApplyWorkspaceEditResult struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+// OptionalVersionedTextDocumentIdentifier names the version of a document
+// an edit was computed against; a nil Version means the content on disk.
+type OptionalVersionedTextDocumentIdentifier struct {
+	URI     DocumentURI `json:"uri"`
+	Version *int        `json:"version"`
+}
+
+// FileChangeOptions are the options of create, rename and delete
+// operations. Each operation only uses the fields that apply to it.
+type FileChangeOptions struct {
+	Overwrite         bool `json:"overwrite,omitempty"`
+	IgnoreIfExists    bool `json:"ignoreIfExists,omitempty"`
+	Recursive         bool `json:"recursive,omitempty"`
+	IgnoreIfNotExists bool `json:"ignoreIfNotExists,omitempty"`
+}
+
+// ApplyTextEdits applies edits that were all computed against text. Edits
+// starting at the same position are applied in the order given; overlapping
+// edits are an error.
+func ApplyTextEdits(text string, edits []TextEdit) (string, error) {
+	type span struct {
+		start, end int
+		newText    string
+	}
+	spans := make([]span, len(edits))
+	for i, edit := range edits {
+		start, end := OffsetAt(text, edit.Range.Start), OffsetAt(text, edit.Range.End)
+		if end < start {
+			return "", fmt.Errorf("edit %d ends before it starts", i+1)
+		}
+		spans[i] = span{start: start, end: end, newText: edit.NewText}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var out []byte
+	pos := 0
+	for _, s := range spans {
+		if s.start < pos {
+			return "", fmt.Errorf("overlapping edits at offset %d", s.start)
+		}
+		out = append(out, text[pos:s.start]...)
+		out = append(out, s.newText...)
+		pos = s.end
+	}
+	out = append(out, text[pos:]...)
+	return string(out), nil
+}
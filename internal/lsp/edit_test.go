@@ -0,0 +1,61 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyTextEdits(t *testing.T) {
+	text := "package main\n\nfunc main() {}\n"
+
+	got, err := ApplyTextEdits(text, []TextEdit{
+		{Range: Range{Start: Position{Line: 2, Character: 5}, End: Position{Line: 2, Character: 9}}, NewText: "run"},
+		{Range: Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 0}}, NewText: "// a\n"},
+		{Range: Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 0}}, NewText: "// b\n"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyTextEdits: %v", err)
+	}
+
+	want := "package main\n// a\n// b\n\nfunc run() {}\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestApplyTextEdits_Overlap(t *testing.T) {
+	_, err := ApplyTextEdits("abcdef", []TextEdit{
+		{Range: Range{Start: Position{Character: 0}, End: Position{Character: 3}}, NewText: "x"},
+		{Range: Range{Start: Position{Character: 2}, End: Position{Character: 4}}, NewText: "y"},
+	})
+	if err == nil {
+		t.Error("overlapping edits should fail")
+	}
+}
+
+func TestWorkspaceEdit_DocumentChanges(t *testing.T) {
+	raw := `{"documentChanges": [
+		{"textDocument": {"uri": "file:///a.go", "version": 3}, "edits": [{"range": {"start": {"line": 0, "character": 0}, "end": {"line": 0, "character": 1}}, "newText": "b"}]},
+		{"kind": "rename", "oldUri": "file:///a.go", "newUri": "file:///b.go", "options": {"overwrite": true}},
+		{"kind": "delete", "uri": "file:///c.go"}
+	]}`
+
+	var edit WorkspaceEdit
+	if err := json.Unmarshal([]byte(raw), &edit); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(edit.DocumentChanges) != 3 {
+		t.Fatalf("got %d document changes, want 3", len(edit.DocumentChanges))
+	}
+
+	first := edit.DocumentChanges[0]
+	if first.Kind != "" || first.TextDocument == nil || first.TextDocument.Version == nil || *first.TextDocument.Version != 3 {
+		t.Errorf("text document edit = %+v", first)
+	}
+	if r := edit.DocumentChanges[1]; r.Kind != FileChangeRename || r.NewURI != "file:///b.go" || r.Options == nil || !r.Options.Overwrite {
+		t.Errorf("rename = %+v", r)
+	}
+	if d := edit.DocumentChanges[2]; d.Kind != FileChangeDelete || d.URI != "file:///c.go" {
+		t.Errorf("delete = %+v", d)
+	}
+}
@@ -0,0 +1,431 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// SupportsMethod reports whether the server advertised a provider for method.
+// Methods without a corresponding capability are assumed to be supported.
+func (c *ServerCapabilities) SupportsMethod(method string) bool {
+	switch method {
+	case MethodTextDocumentCompletion:
+		return c.CompletionProvider != nil
+	case MethodTextDocumentHover:
+		return providerEnabled(c.HoverProvider)
+	case MethodTextDocumentSignatureHelp:
+		return c.SignatureHelpProvider != nil
+	case MethodTextDocumentDeclaration:
+		return providerEnabled(c.DeclarationProvider)
+	case MethodTextDocumentDefinition:
+		return providerEnabled(c.DefinitionProvider)
+	case MethodTextDocumentTypeDefinition:
+		return providerEnabled(c.TypeDefinitionProvider)
+	case MethodTextDocumentImplementation:
+		return providerEnabled(c.ImplementationProvider)
+	case MethodTextDocumentReferences:
+		return providerEnabled(c.ReferencesProvider)
+	case MethodTextDocumentDocumentHighlight:
+		return providerEnabled(c.DocumentHighlightProvider)
+	case MethodTextDocumentDocumentSymbol:
+		return providerEnabled(c.DocumentSymbolProvider)
+	case MethodTextDocumentCodeAction:
+		return providerEnabled(c.CodeActionProvider)
+	case MethodCodeActionResolve:
+		return codeActionResolvable(c.CodeActionProvider)
+	case MethodTextDocumentCodeLens:
+		return c.CodeLensProvider != nil
+	case MethodTextDocumentDocumentLink:
+		return c.DocumentLinkProvider != nil
+	case MethodTextDocumentDocumentColor, MethodTextDocumentColorPresentation:
+		return providerEnabled(c.ColorProvider)
+	case MethodTextDocumentFormatting:
+		return providerEnabled(c.DocumentFormattingProvider)
+	case MethodTextDocumentRangeFormatting:
+		return providerEnabled(c.DocumentRangeFormattingProvider)
+	case MethodTextDocumentOnTypeFormatting:
+		return c.DocumentOnTypeFormattingProvider != nil
+	case MethodTextDocumentRename, MethodTextDocumentPrepareRename:
+		return providerEnabled(c.RenameProvider)
+	case MethodTextDocumentFoldingRange:
+		return providerEnabled(c.FoldingRangeProvider)
+	case MethodTextDocumentSelectionRange:
+		return providerEnabled(c.SelectionRangeProvider)
+	case MethodTextDocumentSemanticTokensFull, MethodTextDocumentSemanticTokensDelta, MethodTextDocumentSemanticTokensRange:
+		return providerEnabled(c.SemanticTokensProvider)
+	case MethodTextDocumentInlayHint:
+		return providerEnabled(c.InlayHintProvider)
+	case MethodTextDocumentDiagnostic, MethodWorkspaceDiagnostic:
+		return providerEnabled(c.DiagnosticProvider)
+	case MethodWorkspaceSymbol:
+		return providerEnabled(c.WorkspaceSymbolProvider)
+	case MethodWorkspaceExecuteCommand:
+		return c.ExecuteCommandProvider != nil
+	default:
+		return true
+	}
+}
+
+func providerEnabled(v any) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
+
+// IsMergeableMethod reports whether responses for method from several servers
+// can be combined into one. Everything else is answered by a single server.
+func IsMergeableMethod(method string) bool {
+	switch method {
+	case MethodTextDocumentDeclaration,
+		MethodTextDocumentDefinition,
+		MethodTextDocumentTypeDefinition,
+		MethodTextDocumentImplementation,
+		MethodTextDocumentReferences,
+		MethodTextDocumentCompletion,
+		MethodTextDocumentCodeAction,
+		MethodTextDocumentDocumentHighlight,
+		MethodTextDocumentDocumentSymbol,
+		MethodTextDocumentCodeLens,
+		MethodTextDocumentInlayHint,
+		MethodTextDocumentDocumentLink,
+		MethodTextDocumentFoldingRange,
+		MethodWorkspaceSymbol,
+		MethodWorkspaceDiagnostic:
+		return true
+	default:
+		return false
+	}
+}
+
+// MergeResults combines the raw responses several servers returned for the
+// same request. Location results are deduplicated, completions are joined
+// into one list, code actions are unioned by title and kind, workspace
+// diagnostic reports are joined, and other mergeable array results are
+// concatenated. For methods that cannot be merged the first non-null result
+// wins.
+func MergeResults(method string, results []json.RawMessage) json.RawMessage {
+	var nonNull []json.RawMessage
+	for _, r := range results {
+		if !isNullResult(r) {
+			nonNull = append(nonNull, r)
+		}
+	}
+
+	if len(nonNull) == 0 {
+		if len(results) > 0 {
+			return results[0]
+		}
+		return json.RawMessage("null")
+	}
+	if len(nonNull) == 1 || !IsMergeableMethod(method) {
+		return nonNull[0]
+	}
+
+	switch method {
+	case MethodTextDocumentDeclaration,
+		MethodTextDocumentDefinition,
+		MethodTextDocumentTypeDefinition,
+		MethodTextDocumentImplementation,
+		MethodTextDocumentReferences:
+		return mergeLocations(nonNull)
+	case MethodTextDocumentCompletion:
+		return mergeCompletions(nonNull)
+	case MethodTextDocumentCodeAction:
+		return mergeArrays(nonNull, codeActionKey)
+	case MethodWorkspaceDiagnostic:
+		return mergeWorkspaceDiagnostics(nonNull)
+	default:
+		return mergeArrays(nonNull, rawKey)
+	}
+}
+
+func isNullResult(r json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(r)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+// splitResult returns the elements of an array result, or the result itself
+// wrapped in a slice when it is a single object.
+func splitResult(r json.RawMessage) []json.RawMessage {
+	trimmed := bytes.TrimSpace(r)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil
+		}
+		return items
+	}
+	return []json.RawMessage{trimmed}
+}
+
+type locationOrLink struct {
+	URI                  DocumentURI `json:"uri"`
+	Range                *Range      `json:"range"`
+	TargetURI            DocumentURI `json:"targetUri"`
+	TargetRange          *Range      `json:"targetRange"`
+	TargetSelectionRange *Range      `json:"targetSelectionRange"`
+}
+
+func (l locationOrLink) isLink() bool {
+	return l.TargetURI != ""
+}
+
+// location returns the plain Location this item points at. Links are reduced
+// to their target selection range.
+func (l locationOrLink) location() Location {
+	if !l.isLink() {
+		loc := Location{URI: l.URI}
+		if l.Range != nil {
+			loc.Range = *l.Range
+		}
+		return loc
+	}
+	loc := Location{URI: l.TargetURI}
+	switch {
+	case l.TargetSelectionRange != nil:
+		loc.Range = *l.TargetSelectionRange
+	case l.TargetRange != nil:
+		loc.Range = *l.TargetRange
+	}
+	return loc
+}
+
+// mergeLocations joins Location, Location[] and LocationLink[] results. When
+// every server answered with links the links are kept; otherwise everything
+// is normalized to Location so the client receives a homogeneous array.
+func mergeLocations(results []json.RawMessage) json.RawMessage {
+	var raws []json.RawMessage
+	var items []locationOrLink
+	allLinks := true
+
+	for _, r := range results {
+		for _, raw := range splitResult(r) {
+			var item locationOrLink
+			if err := json.Unmarshal(raw, &item); err != nil {
+				continue
+			}
+			if !item.isLink() {
+				allLinks = false
+			}
+			raws = append(raws, raw)
+			items = append(items, item)
+		}
+	}
+
+	seen := make(map[Location]bool)
+	merged := make([]any, 0, len(items))
+	for i, item := range items {
+		loc := item.location()
+		if seen[loc] {
+			continue
+		}
+		seen[loc] = true
+		if allLinks {
+			merged = append(merged, raws[i])
+		} else {
+			merged = append(merged, loc)
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return results[0]
+	}
+	return data
+}
+
+type completionListResult struct {
+	IsIncomplete bool              `json:"isIncomplete"`
+	ItemDefaults json.RawMessage   `json:"itemDefaults,omitempty"`
+	Items        []json.RawMessage `json:"items"`
+}
+
+// mergeCompletions concatenates CompletionItem[] and CompletionList results.
+// If any server returned a list the merged result is a list that is
+// incomplete whenever one of its inputs was. Each list's itemDefaults are
+// folded into its own items first, since the merged list has none.
+func mergeCompletions(results []json.RawMessage) json.RawMessage {
+	var merged completionListResult
+	anyList := false
+
+	for _, r := range results {
+		trimmed := bytes.TrimSpace(r)
+		if len(trimmed) > 0 && trimmed[0] == '{' {
+			var list completionListResult
+			if err := json.Unmarshal(trimmed, &list); err != nil {
+				continue
+			}
+			anyList = true
+			merged.IsIncomplete = merged.IsIncomplete || list.IsIncomplete
+			merged.Items = append(merged.Items, applyItemDefaults(list.ItemDefaults, list.Items)...)
+			continue
+		}
+		merged.Items = append(merged.Items, splitResult(trimmed)...)
+	}
+
+	merged.Items = dedupeRaw(merged.Items, rawKey)
+	if merged.Items == nil {
+		merged.Items = []json.RawMessage{}
+	}
+
+	var data []byte
+	var err error
+	if anyList {
+		data, err = json.Marshal(merged)
+	} else {
+		data, err = json.Marshal(merged.Items)
+	}
+	if err != nil {
+		return results[0]
+	}
+	return data
+}
+
+// applyItemDefaults sets the CompletionList itemDefaults on every item that
+// does not override them, as a client would when reading the list.
+func applyItemDefaults(defaults json.RawMessage, items []json.RawMessage) []json.RawMessage {
+	var fields map[string]json.RawMessage
+	if len(defaults) == 0 || json.Unmarshal(defaults, &fields) != nil || len(fields) == 0 {
+		return items
+	}
+
+	out := make([]json.RawMessage, len(items))
+	for i, raw := range items {
+		out[i] = raw
+		var item map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &item); err != nil {
+			continue
+		}
+
+		for _, key := range []string{"commitCharacters", "insertTextFormat", "insertTextMode", "data"} {
+			if value, ok := fields[key]; ok {
+				if _, set := item[key]; !set {
+					item[key] = value
+				}
+			}
+		}
+
+		if editRange, ok := fields["editRange"]; ok {
+			if _, set := item["textEdit"]; !set {
+				if textEdit := defaultTextEdit(editRange, item); textEdit != nil {
+					item["textEdit"] = textEdit
+				}
+			}
+		}
+		delete(item, "textEditText")
+
+		if encoded, err := json.Marshal(item); err == nil {
+			out[i] = encoded
+		}
+	}
+	return out
+}
+
+// defaultTextEdit builds the textEdit an item gets from a default editRange,
+// which is either a Range or an {insert, replace} pair.
+func defaultTextEdit(editRange json.RawMessage, item map[string]json.RawMessage) json.RawMessage {
+	newText, ok := item["textEditText"]
+	if !ok {
+		newText = item["label"]
+	}
+
+	var ranges struct {
+		Insert  *Range `json:"insert"`
+		Replace *Range `json:"replace"`
+	}
+	var edit map[string]any
+	if err := json.Unmarshal(editRange, &ranges); err == nil && ranges.Insert != nil && ranges.Replace != nil {
+		edit = map[string]any{"insert": ranges.Insert, "replace": ranges.Replace, "newText": newText}
+	} else {
+		var r Range
+		if err := json.Unmarshal(editRange, &r); err != nil {
+			return nil
+		}
+		edit = map[string]any{"range": r, "newText": newText}
+	}
+
+	encoded, err := json.Marshal(edit)
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// mergeWorkspaceDiagnostics joins the per-document reports of several
+// WorkspaceDiagnosticReport results.
+func mergeWorkspaceDiagnostics(results []json.RawMessage) json.RawMessage {
+	merged := struct {
+		Items []json.RawMessage `json:"items"`
+	}{Items: []json.RawMessage{}}
+
+	for _, r := range results {
+		var report struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(r, &report); err != nil {
+			continue
+		}
+		merged.Items = append(merged.Items, report.Items...)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return results[0]
+	}
+	return data
+}
+
+func mergeArrays(results []json.RawMessage, key func(json.RawMessage) string) json.RawMessage {
+	var items []json.RawMessage
+	for _, r := range results {
+		items = append(items, splitResult(r)...)
+	}
+
+	items = dedupeRaw(items, key)
+	if items == nil {
+		items = []json.RawMessage{}
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return results[0]
+	}
+	return data
+}
+
+func dedupeRaw(items []json.RawMessage, key func(json.RawMessage) string) []json.RawMessage {
+	seen := make(map[string]bool)
+	var result []json.RawMessage
+	for _, item := range items {
+		k := key(item)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		result = append(result, item)
+	}
+	return result
+}
+
+func rawKey(item json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, item); err != nil {
+		return string(item)
+	}
+	return buf.String()
+}
+
+func codeActionKey(item json.RawMessage) string {
+	var action struct {
+		Title string `json:"title"`
+		Kind  string `json:"kind"`
+	}
+	if err := json.Unmarshal(item, &action); err != nil || action.Title == "" {
+		return rawKey(item)
+	}
+	return action.Kind + "\x00" + action.Title
+}
@@ -0,0 +1,219 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergeResults_Locations(t *testing.T) {
+	a := json.RawMessage(`[{"uri":"file:///a.ts","range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}}}]`)
+	b := json.RawMessage(`{"uri":"file:///a.ts","range":{"start":{"line":1,"character":0},"end":{"line":1,"character":3}}}`)
+	c := json.RawMessage(`[{"targetUri":"file:///b.ts","targetRange":{"start":{"line":0,"character":0},"end":{"line":9,"character":0}},"targetSelectionRange":{"start":{"line":2,"character":4},"end":{"line":2,"character":8}}}]`)
+
+	merged := MergeResults(MethodTextDocumentDefinition, []json.RawMessage{a, json.RawMessage("null"), b, c})
+
+	var locs []Location
+	if err := json.Unmarshal(merged, &locs); err != nil {
+		t.Fatalf("unmarshal merged: %v (%s)", err, merged)
+	}
+	if len(locs) != 2 {
+		t.Fatalf("expected 2 locations after dedupe, got %d: %s", len(locs), merged)
+	}
+	if locs[1].URI != "file:///b.ts" || locs[1].Range.Start.Line != 2 {
+		t.Errorf("link not normalized to target selection range: %+v", locs[1])
+	}
+}
+
+func TestMergeResults_LocationLinksKept(t *testing.T) {
+	a := json.RawMessage(`[{"targetUri":"file:///a.ts","targetRange":{"start":{"line":0,"character":0},"end":{"line":1,"character":0}},"targetSelectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":1}}}]`)
+	b := json.RawMessage(`[{"targetUri":"file:///b.ts","targetRange":{"start":{"line":0,"character":0},"end":{"line":1,"character":0}},"targetSelectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":1}}}]`)
+
+	merged := MergeResults(MethodTextDocumentDefinition, []json.RawMessage{a, b})
+
+	var links []map[string]any
+	if err := json.Unmarshal(merged, &links); err != nil {
+		t.Fatalf("unmarshal merged: %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("expected 2 links, got %d", len(links))
+	}
+	if _, ok := links[0]["targetUri"]; !ok {
+		t.Errorf("expected links to be preserved, got %s", merged)
+	}
+}
+
+func TestMergeResults_Completion(t *testing.T) {
+	list := json.RawMessage(`{"isIncomplete":true,"items":[{"label":"foo"}]}`)
+	arr := json.RawMessage(`[{"label":"bar"},{"label":"foo"}]`)
+
+	merged := MergeResults(MethodTextDocumentCompletion, []json.RawMessage{arr, list})
+
+	var result struct {
+		IsIncomplete bool `json:"isIncomplete"`
+		Items        []struct {
+			Label string `json:"label"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(merged, &result); err != nil {
+		t.Fatalf("unmarshal merged: %v (%s)", err, merged)
+	}
+	if !result.IsIncomplete {
+		t.Error("expected isIncomplete to be carried over")
+	}
+	if len(result.Items) != 2 {
+		t.Errorf("expected 2 items, got %d: %s", len(result.Items), merged)
+	}
+}
+
+func TestMergeResults_CompletionItemDefaults(t *testing.T) {
+	editRange := `{"start":{"line":1,"character":0},"end":{"line":1,"character":2}}`
+	gopls := TagResolveData(MethodTextDocumentCompletion, "gopls", json.RawMessage(
+		`{"isIncomplete":false,"itemDefaults":{"editRange":`+editRange+`,"insertTextFormat":2,"data":{"d":1}},"items":[{"label":"fmt"},{"label":"os","textEditText":"os.","insertTextFormat":1}]}`))
+	other := TagResolveData(MethodTextDocumentCompletion, "other", json.RawMessage(
+		`{"isIncomplete":false,"items":[{"label":"plain"}]}`))
+
+	merged := MergeResults(MethodTextDocumentCompletion, []json.RawMessage{gopls, other})
+
+	var result struct {
+		ItemDefaults json.RawMessage `json:"itemDefaults"`
+		Items        []struct {
+			Label            string          `json:"label"`
+			InsertTextFormat int             `json:"insertTextFormat"`
+			TextEdit         *TextEdit       `json:"textEdit"`
+			Data             json.RawMessage `json:"data"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(merged, &result); err != nil {
+		t.Fatalf("unmarshal merged: %v (%s)", err, merged)
+	}
+	if len(result.ItemDefaults) != 0 || len(result.Items) != 3 {
+		t.Fatalf("got %s", merged)
+	}
+
+	fmtItem, osItem, plain := result.Items[0], result.Items[1], result.Items[2]
+	if fmtItem.InsertTextFormat != 2 || fmtItem.TextEdit == nil || fmtItem.TextEdit.NewText != "fmt" || fmtItem.TextEdit.Range.End.Character != 2 {
+		t.Errorf("fmt item did not get the defaults: %+v", fmtItem)
+	}
+	if osItem.InsertTextFormat != 1 || osItem.TextEdit == nil || osItem.TextEdit.NewText != "os." {
+		t.Errorf("os item overrides were lost: %+v", osItem)
+	}
+
+	for want, data := range map[string]json.RawMessage{"gopls": fmtItem.Data, "other": plain.Data} {
+		server, _, ok := UntagResolveParams(json.RawMessage(`{"data":` + string(data) + `}`))
+		if !ok || server != want {
+			t.Errorf("item data %s resolves to %q, want %q", data, server, want)
+		}
+	}
+}
+
+func TestMergeResults_CompletionArrays(t *testing.T) {
+	merged := MergeResults(MethodTextDocumentCompletion, []json.RawMessage{
+		json.RawMessage(`[{"label":"a"}]`),
+		json.RawMessage(`[{"label":"b"}]`),
+	})
+
+	var items []map[string]any
+	if err := json.Unmarshal(merged, &items); err != nil {
+		t.Fatalf("expected array result, got %s", merged)
+	}
+	if len(items) != 2 {
+		t.Errorf("expected 2 items, got %d", len(items))
+	}
+}
+
+func TestMergeResults_CodeActions(t *testing.T) {
+	a := json.RawMessage(`[{"title":"Organize imports","kind":"source.organizeImports"},{"title":"Fix lint","kind":"quickfix"}]`)
+	b := json.RawMessage(`[{"title":"Organize imports","kind":"source.organizeImports","edit":{}},{"title":"Extract","kind":"refactor.extract"}]`)
+
+	merged := MergeResults(MethodTextDocumentCodeAction, []json.RawMessage{a, b})
+
+	var actions []map[string]any
+	if err := json.Unmarshal(merged, &actions); err != nil {
+		t.Fatalf("unmarshal merged: %v", err)
+	}
+	if len(actions) != 3 {
+		t.Errorf("expected 3 actions, got %d: %s", len(actions), merged)
+	}
+}
+
+func TestMergeResults_NonMergeable(t *testing.T) {
+	merged := MergeResults(MethodTextDocumentHover, []json.RawMessage{
+		json.RawMessage("null"),
+		json.RawMessage(`{"contents":"second"}`),
+		json.RawMessage(`{"contents":"third"}`),
+	})
+	if string(merged) != `{"contents":"second"}` {
+		t.Errorf("expected first non-null result, got %s", merged)
+	}
+
+	merged = MergeResults(MethodTextDocumentHover, []json.RawMessage{json.RawMessage("null")})
+	if string(merged) != "null" {
+		t.Errorf("expected null, got %s", merged)
+	}
+}
+
+func TestServerCapabilities_SupportsMethod(t *testing.T) {
+	caps := ServerCapabilities{
+		DefinitionProvider: true,
+		ReferencesProvider: false,
+		CodeActionProvider: map[string]any{"codeActionKinds": []any{"quickfix"}},
+	}
+
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{MethodTextDocumentDefinition, true},
+		{MethodTextDocumentReferences, false},
+		{MethodTextDocumentCodeAction, true},
+		{MethodCodeActionResolve, false},
+		{MethodTextDocumentCompletion, false},
+		{MethodTextDocumentHover, false},
+		{"custom/method", true},
+	}
+
+	for _, tt := range tests {
+		if got := caps.SupportsMethod(tt.method); got != tt.want {
+			t.Errorf("SupportsMethod(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestMergeCapabilities_ResolveProviders(t *testing.T) {
+	plain := ServerCapabilities{
+		CompletionProvider: &CompletionOptions{TriggerCharacters: []string{"."}},
+		CodeActionProvider: true,
+	}
+	if merged := MergeCapabilities(plain, plain); merged.CompletionProvider.ResolveProvider || codeActionResolvable(merged.CodeActionProvider) {
+		t.Errorf("resolve should not be advertised when no server supports it: %+v", merged)
+	}
+
+	resolving := ServerCapabilities{
+		CompletionProvider: &CompletionOptions{ResolveProvider: true},
+		CodeActionProvider: map[string]any{"resolveProvider": true},
+	}
+	merged := MergeCapabilities(plain, resolving)
+	if !merged.CompletionProvider.ResolveProvider {
+		t.Error("expected completion resolve to be advertised")
+	}
+	if !merged.SupportsMethod(MethodCodeActionResolve) {
+		t.Errorf("expected code action resolve to be advertised, got %#v", merged.CodeActionProvider)
+	}
+}
+
+func TestMergeResults_WorkspaceDiagnostics(t *testing.T) {
+	merged := MergeResults(MethodWorkspaceDiagnostic, []json.RawMessage{
+		json.RawMessage(`{"items":[{"kind":"full","uri":"file:///a.go","items":[]}]}`),
+		json.RawMessage(`{"items":[{"kind":"full","uri":"file:///b.go","items":[]}]}`),
+	})
+
+	var report struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal(merged, &report); err != nil {
+		t.Fatalf("unmarshal merged: %v", err)
+	}
+	if len(report.Items) != 2 {
+		t.Errorf("expected 2 document reports, got %d: %s", len(report.Items), merged)
+	}
+}
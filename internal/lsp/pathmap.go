@@ -0,0 +1,129 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// PathMap rewrites file paths and file:// URIs between the filesystem lux
+// sees and the one a sandboxed server sees. Every string value and object
+// key in a payload is checked, which covers URIs in requests, responses and
+// notifications as well as rootUri, workspaceFolders and the URI-keyed
+// changes of a WorkspaceEdit. Document text is left alone.
+type PathMap struct {
+	pairs []pathPair
+}
+
+type pathPair struct {
+	host   string
+	server string
+}
+
+// NewPathMap builds a PathMap from host path prefixes to server path
+// prefixes.
+func NewPathMap(hostToServer map[string]string) *PathMap {
+	pm := &PathMap{}
+	for host, server := range hostToServer {
+		pm.pairs = append(pm.pairs, pathPair{
+			host:   strings.TrimSuffix(host, "/"),
+			server: strings.TrimSuffix(server, "/"),
+		})
+	}
+	return pm
+}
+
+// ToServer rewrites host paths in raw to the server's view.
+func (pm *PathMap) ToServer(raw json.RawMessage) json.RawMessage {
+	return pm.rewrite(raw, func(p pathPair) (string, string) { return p.host, p.server })
+}
+
+// FromServer rewrites server paths in raw back to the host's view.
+func (pm *PathMap) FromServer(raw json.RawMessage) json.RawMessage {
+	return pm.rewrite(raw, func(p pathPair) (string, string) { return p.server, p.host })
+}
+
+type mapping struct {
+	from string
+	to   string
+}
+
+// ordered returns the mappings in one direction, longest prefix first so
+// nested mounts win over their parents.
+func (pm *PathMap) ordered(dir func(pathPair) (string, string)) []mapping {
+	maps := make([]mapping, 0, len(pm.pairs))
+	for _, p := range pm.pairs {
+		from, to := dir(p)
+		maps = append(maps, mapping{from: from, to: to})
+	}
+	sort.Slice(maps, func(i, j int) bool { return len(maps[i].from) > len(maps[j].from) })
+	return maps
+}
+
+func (pm *PathMap) rewrite(raw json.RawMessage, dir func(pathPair) (string, string)) json.RawMessage {
+	maps := pm.ordered(dir)
+
+	mentioned := false
+	for _, m := range maps {
+		if bytes.Contains(raw, []byte(m.from)) {
+			mentioned = true
+			break
+		}
+	}
+	if !mentioned {
+		return raw
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return raw
+	}
+
+	encoded, err := json.Marshal(rewriteValue(v, "", maps))
+	if err != nil {
+		return raw
+	}
+	return encoded
+}
+
+func rewriteValue(v any, key string, maps []mapping) any {
+	switch val := v.(type) {
+	case string:
+		if key == "text" || key == "newText" {
+			return val
+		}
+		return mapString(val, maps)
+	case []any:
+		for i, elem := range val {
+			val[i] = rewriteValue(elem, "", maps)
+		}
+		return val
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, elem := range val {
+			out[mapString(k, maps)] = rewriteValue(elem, k, maps)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func mapString(s string, maps []mapping) string {
+	const scheme = "file://"
+	prefix := ""
+	path := s
+	if strings.HasPrefix(s, scheme) {
+		prefix, path = scheme, s[len(scheme):]
+	}
+
+	for _, m := range maps {
+		if path == m.from || strings.HasPrefix(path, m.from+"/") {
+			return prefix + m.to + path[len(m.from):]
+		}
+	}
+	return s
+}
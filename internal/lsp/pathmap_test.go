@@ -0,0 +1,89 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decode(t *testing.T, raw json.RawMessage) map[string]any {
+	t.Helper()
+	var v map[string]any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		t.Fatalf("unmarshal %s: %v", raw, err)
+	}
+	return v
+}
+
+func TestPathMap_InitializeParams(t *testing.T) {
+	pm := NewPathMap(map[string]string{"/home/me/src": "/workspace"})
+
+	raw := json.RawMessage(`{"processId":1,"rootUri":"file:///home/me/src/proj","rootPath":"/home/me/src/proj","workspaceFolders":[{"uri":"file:///home/me/src/proj","name":"proj"}]}`)
+	got := decode(t, pm.ToServer(raw))
+
+	if got["rootUri"] != "file:///workspace/proj" {
+		t.Errorf("rootUri = %v", got["rootUri"])
+	}
+	if got["rootPath"] != "/workspace/proj" {
+		t.Errorf("rootPath = %v", got["rootPath"])
+	}
+	folder := got["workspaceFolders"].([]any)[0].(map[string]any)
+	if folder["uri"] != "file:///workspace/proj" || folder["name"] != "proj" {
+		t.Errorf("workspace folder = %v", folder)
+	}
+	if got["processId"] != float64(1) {
+		t.Errorf("processId = %v", got["processId"])
+	}
+}
+
+func TestPathMap_WorkspaceEditFromServer(t *testing.T) {
+	pm := NewPathMap(map[string]string{"/home/me/src": "/workspace"})
+
+	raw := json.RawMessage(`{"changes":{"file:///workspace/a.go":[{"range":{},"newText":"/workspace/keep"}]},"documentChanges":[{"textDocument":{"uri":"file:///workspace/b.go","version":2},"edits":[]}]}`)
+	got := decode(t, pm.FromServer(raw))
+
+	changes := got["changes"].(map[string]any)
+	edits, ok := changes["file:///home/me/src/a.go"].([]any)
+	if !ok {
+		t.Fatalf("changes key not rewritten: %v", changes)
+	}
+	if text := edits[0].(map[string]any)["newText"]; text != "/workspace/keep" {
+		t.Errorf("newText should be untouched, got %v", text)
+	}
+
+	doc := got["documentChanges"].([]any)[0].(map[string]any)["textDocument"].(map[string]any)
+	if doc["uri"] != "file:///home/me/src/b.go" {
+		t.Errorf("documentChanges uri = %v", doc["uri"])
+	}
+}
+
+func TestPathMap_LongestPrefixAndBoundaries(t *testing.T) {
+	pm := NewPathMap(map[string]string{
+		"/home/me":          "/sandbox",
+		"/home/me/src/":     "/workspace",
+		"/home/me/srcother": "/elsewhere",
+	})
+
+	raw := json.RawMessage(`{"a":"file:///home/me/src/x.go","b":"/home/me/notes","c":"/home/mesa/x","d":"file:///home/me/src"}`)
+	got := decode(t, pm.ToServer(raw))
+
+	want := map[string]string{
+		"a": "file:///workspace/x.go",
+		"b": "/sandbox/notes",
+		"c": "/home/mesa/x",
+		"d": "file:///workspace",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %s", k, got[k], v)
+		}
+	}
+}
+
+func TestPathMap_UnrelatedPayloadUnchanged(t *testing.T) {
+	pm := NewPathMap(map[string]string{"/home/me/src": "/workspace"})
+
+	raw := json.RawMessage(`{"textDocument":{"uri":"file:///tmp/x.go"},"position":{"line":1,"character":2}}`)
+	if got := pm.ToServer(raw); string(got) != string(raw) {
+		t.Errorf("expected payload unchanged, got %s", got)
+	}
+}
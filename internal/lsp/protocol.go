@@ -20,6 +20,7 @@ const (
 	MethodTextDocumentCompletion          = "textDocument/completion"
 	MethodTextDocumentHover               = "textDocument/hover"
 	MethodTextDocumentSignatureHelp       = "textDocument/signatureHelp"
+	MethodTextDocumentDeclaration         = "textDocument/declaration"
 	MethodTextDocumentDefinition          = "textDocument/definition"
 	MethodTextDocumentTypeDefinition      = "textDocument/typeDefinition"
 	MethodTextDocumentImplementation      = "textDocument/implementation"
@@ -43,6 +44,7 @@ const (
 	MethodTextDocumentSemanticTokensRange = "textDocument/semanticTokens/range"
 	MethodTextDocumentInlayHint           = "textDocument/inlayHint"
 	MethodTextDocumentDiagnostic          = "textDocument/diagnostic"
+	MethodTextDocumentPublishDiagnostics  = "textDocument/publishDiagnostics"
 
 	MethodWorkspaceSymbol                 = "workspace/symbol"
 	MethodWorkspaceExecuteCommand         = "workspace/executeCommand"
@@ -54,6 +56,12 @@ const (
 	MethodWorkspaceWorkspaceFolders       = "workspace/workspaceFolders"
 	MethodWorkspaceDiagnostic             = "workspace/diagnostic"
 
+	MethodCompletionItemResolve = "completionItem/resolve"
+	MethodCodeActionResolve     = "codeAction/resolve"
+	MethodCodeLensResolve       = "codeLens/resolve"
+	MethodInlayHintResolve      = "inlayHint/resolve"
+	MethodDocumentLinkResolve   = "documentLink/resolve"
+
 	MethodWindowShowMessage            = "window/showMessage"
 	MethodWindowShowMessageRequest     = "window/showMessageRequest"
 	MethodWindowLogMessage             = "window/logMessage"
@@ -104,7 +112,8 @@ type WorkspaceClientCapabilities struct {
 }
 
 type WorkspaceEditClientCaps struct {
-	DocumentChanges bool `json:"documentChanges,omitempty"`
+	DocumentChanges    bool     `json:"documentChanges,omitempty"`
+	ResourceOperations []string `json:"resourceOperations,omitempty"`
 }
 
 type DidChangeConfigurationCaps struct {
@@ -195,7 +204,15 @@ type DocumentSymbolClientCaps struct {
 }
 
 type CodeActionClientCaps struct {
-	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	DynamicRegistration bool                      `json:"dynamicRegistration,omitempty"`
+	DataSupport         bool                      `json:"dataSupport,omitempty"`
+	ResolveSupport      *CodeActionResolveSupport `json:"resolveSupport,omitempty"`
+}
+
+// CodeActionResolveSupport lists the code action properties a client can
+// fill in lazily through codeAction/resolve.
+type CodeActionResolveSupport struct {
+	Properties []string `json:"properties"`
 }
 
 type CodeLensClientCaps struct {
@@ -513,6 +530,18 @@ type TextEdit struct {
 	NewText string `json:"newText"`
 }
 
+// Command is a command a server can run through workspace/executeCommand.
+type Command struct {
+	Title     string            `json:"title"`
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
 // WorkDoneProgressCreateParams is sent by the server to create a progress token.
 type WorkDoneProgressCreateParams struct {
 	Token any `json:"token"` // string | number
@@ -523,3 +552,31 @@ type ProgressParams struct {
 	Token any             `json:"token"` // string | number
 	Value json.RawMessage `json:"value"`
 }
+
+// MessageParams is the payload of window/logMessage and window/showMessage.
+type MessageParams struct {
+	Type    MessageType `json:"type"`
+	Message string      `json:"message"`
+}
+
+type MessageType int
+
+const (
+	MessageTypeError   MessageType = 1
+	MessageTypeWarning MessageType = 2
+	MessageTypeInfo    MessageType = 3
+	MessageTypeLog     MessageType = 4
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeError:
+		return "error"
+	case MessageTypeWarning:
+		return "warning"
+	case MessageTypeInfo:
+		return "info"
+	default:
+		return "log"
+	}
+}
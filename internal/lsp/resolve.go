@@ -0,0 +1,176 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// resolveTag replaces the data field of items lux forwards to the client so a
+// later */resolve request can be routed back to the server that produced the
+// item. The server's own data is kept alongside and restored before the
+// resolve request is forwarded.
+type resolveTag struct {
+	Server string          `json:"luxServer"`
+	Data   json.RawMessage `json:"luxData,omitempty"`
+}
+
+// IsResolveMethod reports whether method resolves an item produced by an
+// earlier request.
+func IsResolveMethod(method string) bool {
+	switch method {
+	case MethodCompletionItemResolve,
+		MethodCodeActionResolve,
+		MethodCodeLensResolve,
+		MethodInlayHintResolve,
+		MethodDocumentLinkResolve:
+		return true
+	default:
+		return false
+	}
+}
+
+// producesResolvableItems reports whether the result of method contains items
+// the client may send back through a resolve request.
+func producesResolvableItems(method string) bool {
+	switch method {
+	case MethodTextDocumentCompletion,
+		MethodTextDocumentCodeAction,
+		MethodTextDocumentCodeLens,
+		MethodTextDocumentInlayHint,
+		MethodTextDocumentDocumentLink:
+		return true
+	default:
+		return IsResolveMethod(method)
+	}
+}
+
+// TagResolveData marks every resolvable item in a result returned by server
+// so resolve requests for it can be routed back. Results of methods without
+// resolvable items are returned unchanged.
+func TagResolveData(method, server string, result json.RawMessage) json.RawMessage {
+	if !producesResolvableItems(method) || isNullResult(result) {
+		return result
+	}
+
+	trimmed := bytes.TrimSpace(result)
+
+	if IsResolveMethod(method) {
+		return tagItem(trimmed, server)
+	}
+
+	if trimmed[0] == '[' {
+		return tagArray(trimmed, server)
+	}
+
+	// CompletionList: tag the items and any itemDefaults.data they inherit.
+	var list map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &list); err != nil {
+		return result
+	}
+
+	hasDefaultData := false
+	if defaults, ok := list["itemDefaults"]; ok {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(defaults, &fields); err == nil {
+			if data, ok := fields["data"]; ok {
+				hasDefaultData = true
+				fields["data"] = marshalTag(server, data)
+				if encoded, err := json.Marshal(fields); err == nil {
+					list["itemDefaults"] = encoded
+				}
+			}
+		}
+	}
+
+	if items, ok := list["items"]; ok {
+		if hasDefaultData {
+			list["items"] = tagArrayWhere(items, server, hasData)
+		} else {
+			list["items"] = tagArray(items, server)
+		}
+	}
+
+	encoded, err := json.Marshal(list)
+	if err != nil {
+		return result
+	}
+	return encoded
+}
+
+// UntagResolveParams extracts the server a resolve request's item came from
+// and returns the item with the server's original data restored.
+func UntagResolveParams(params json.RawMessage) (server string, untagged json.RawMessage, ok bool) {
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(params, &item); err != nil {
+		return "", nil, false
+	}
+
+	var tag resolveTag
+	if err := json.Unmarshal(item["data"], &tag); err != nil || tag.Server == "" {
+		return "", nil, false
+	}
+
+	if len(tag.Data) == 0 {
+		delete(item, "data")
+	} else {
+		item["data"] = tag.Data
+	}
+
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return "", nil, false
+	}
+	return tag.Server, encoded, true
+}
+
+func tagArray(raw json.RawMessage, server string) json.RawMessage {
+	return tagArrayWhere(raw, server, func(map[string]json.RawMessage) bool { return true })
+}
+
+func tagArrayWhere(raw json.RawMessage, server string, pred func(map[string]json.RawMessage) bool) json.RawMessage {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return raw
+	}
+
+	for i, item := range items {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(item, &fields); err != nil || !pred(fields) {
+			continue
+		}
+		items[i] = tagFields(fields, server, item)
+	}
+
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return raw
+	}
+	return encoded
+}
+
+func tagItem(raw json.RawMessage, server string) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return raw
+	}
+	return tagFields(fields, server, raw)
+}
+
+func tagFields(fields map[string]json.RawMessage, server string, fallback json.RawMessage) json.RawMessage {
+	fields["data"] = marshalTag(server, fields["data"])
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return fallback
+	}
+	return encoded
+}
+
+func marshalTag(server string, data json.RawMessage) json.RawMessage {
+	encoded, _ := json.Marshal(resolveTag{Server: server, Data: data})
+	return encoded
+}
+
+func hasData(fields map[string]json.RawMessage) bool {
+	_, ok := fields["data"]
+	return ok
+}
@@ -0,0 +1,87 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTagResolveData_RoundTrip(t *testing.T) {
+	result := json.RawMessage(`[{"title":"Fix","kind":"quickfix","data":{"id":7}},{"title":"Other"}]`)
+
+	tagged := TagResolveData(MethodTextDocumentCodeAction, "eslint", result)
+
+	var actions []json.RawMessage
+	if err := json.Unmarshal(tagged, &actions); err != nil {
+		t.Fatalf("unmarshal tagged: %v", err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 actions, got %d", len(actions))
+	}
+
+	server, untagged, ok := UntagResolveParams(actions[0])
+	if !ok {
+		t.Fatalf("expected tag on %s", actions[0])
+	}
+	if server != "eslint" {
+		t.Errorf("server = %q, want %q", server, "eslint")
+	}
+
+	var item map[string]json.RawMessage
+	json.Unmarshal(untagged, &item)
+	if string(item["data"]) != `{"id":7}` {
+		t.Errorf("data = %s, want original data restored", item["data"])
+	}
+
+	_, untagged, ok = UntagResolveParams(actions[1])
+	if !ok {
+		t.Fatalf("expected tag on item without data: %s", actions[1])
+	}
+	item = nil
+	json.Unmarshal(untagged, &item)
+	if _, present := item["data"]; present {
+		t.Errorf("expected data to be removed, got %s", untagged)
+	}
+}
+
+func TestTagResolveData_CompletionList(t *testing.T) {
+	result := json.RawMessage(`{"isIncomplete":false,"itemDefaults":{"data":{"d":1}},"items":[{"label":"a"},{"label":"b","data":{"own":true}}]}`)
+
+	tagged := TagResolveData(MethodTextDocumentCompletion, "tsserver", result)
+
+	var list struct {
+		ItemDefaults struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"itemDefaults"`
+		Items []map[string]json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(tagged, &list); err != nil {
+		t.Fatalf("unmarshal tagged: %v", err)
+	}
+
+	if _, ok := list.Items[0]["data"]; ok {
+		t.Errorf("item relying on itemDefaults should not get its own data: %s", tagged)
+	}
+
+	server, _, ok := UntagResolveParams(json.RawMessage(`{"label":"a","data":` + string(list.ItemDefaults.Data) + `}`))
+	if !ok || server != "tsserver" {
+		t.Errorf("itemDefaults.data not tagged: %s", list.ItemDefaults.Data)
+	}
+
+	item, _ := json.Marshal(list.Items[1])
+	if server, _, ok := UntagResolveParams(item); !ok || server != "tsserver" {
+		t.Errorf("item with own data not tagged: %s", item)
+	}
+}
+
+func TestTagResolveData_OtherMethods(t *testing.T) {
+	result := json.RawMessage(`{"contents":"hover","data":1}`)
+	if got := TagResolveData(MethodTextDocumentHover, "gopls", result); string(got) != string(result) {
+		t.Errorf("hover result modified: %s", got)
+	}
+}
+
+func TestUntagResolveParams_Untagged(t *testing.T) {
+	if _, _, ok := UntagResolveParams(json.RawMessage(`{"label":"x","data":{"id":1}}`)); ok {
+		t.Error("expected untagged item to be rejected")
+	}
+}
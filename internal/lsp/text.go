@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ApplyContentChanges applies didChange content changes to text in order.
+// Changes without a range replace the whole document.
+func ApplyContentChanges(text string, changes []TextDocumentContentChangeEvent) string {
+	for _, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+		start := OffsetAt(text, change.Range.Start)
+		end := OffsetAt(text, change.Range.End)
+		if end < start {
+			start, end = end, start
+		}
+		text = text[:start] + change.Text + text[end:]
+	}
+	return text
+}
+
+// OffsetAt converts an LSP position, whose character is counted in UTF-16
+// code units, to a byte offset in text. Positions past the end of a line or
+// of the text are clamped.
+func OffsetAt(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		nl := strings.IndexByte(text[offset:], '\n')
+		if nl < 0 {
+			return len(text)
+		}
+		offset += nl + 1
+	}
+
+	units := 0
+	for offset < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+	return offset
+}
+
+// PositionAt converts a byte offset in text to an LSP position, the inverse
+// of OffsetAt. Offsets past the end of the text are clamped.
+func PositionAt(text string, offset int) Position {
+	offset = min(offset, len(text))
+	line := strings.Count(text[:offset], "\n")
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+
+	units := 0
+	for _, r := range text[start:offset] {
+		units += utf16.RuneLen(r)
+	}
+	return Position{Line: line, Character: units}
+}
@@ -0,0 +1,62 @@
+package lsp
+
+import "testing"
+
+func TestApplyContentChanges(t *testing.T) {
+	text := "package main\n\nfunc main() {}\n"
+
+	got := ApplyContentChanges(text, []TextDocumentContentChangeEvent{
+		{
+			Range: &Range{Start: Position{Line: 2, Character: 5}, End: Position{Line: 2, Character: 9}},
+			Text:  "run",
+		},
+		{
+			Range: &Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 0}},
+			Text:  "// x\n",
+		},
+	})
+
+	want := "package main\n// x\n\nfunc run() {}\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := ApplyContentChanges(text, []TextDocumentContentChangeEvent{{Text: "full"}}); got != "full" {
+		t.Errorf("full replacement: got %q", got)
+	}
+}
+
+func TestOffsetAt_UTF16(t *testing.T) {
+	// "😀" is two UTF-16 code units and four bytes.
+	text := "a😀b\nc"
+
+	tests := []struct {
+		pos  Position
+		want int
+	}{
+		{Position{Line: 0, Character: 1}, 1},
+		{Position{Line: 0, Character: 3}, 5},
+		{Position{Line: 0, Character: 99}, 6},
+		{Position{Line: 1, Character: 1}, 8},
+		{Position{Line: 5, Character: 0}, 8},
+	}
+
+	for _, tt := range tests {
+		if got := OffsetAt(text, tt.pos); got != tt.want {
+			t.Errorf("OffsetAt(%+v) = %d, want %d", tt.pos, got, tt.want)
+		}
+	}
+}
+
+func TestPositionAt(t *testing.T) {
+	text := "a😀b\nc"
+
+	for _, pos := range []Position{{Line: 0, Character: 0}, {Line: 0, Character: 3}, {Line: 1, Character: 0}, {Line: 1, Character: 1}} {
+		if got := PositionAt(text, OffsetAt(text, pos)); got != pos {
+			t.Errorf("PositionAt(OffsetAt(%+v)) = %+v", pos, got)
+		}
+	}
+	if got := PositionAt(text, 99); got != (Position{Line: 1, Character: 1}) {
+		t.Errorf("PositionAt past the end = %+v", got)
+	}
+}
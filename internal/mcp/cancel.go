@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/protocol"
+	mcpserver "github.com/amarbel-llc/purse-first/libs/go-mcp/server"
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/transport"
+)
+
+// requestIDArg is where cancelTransport puts the request ID of a tools/call
+// request, so that cancelTools can tie the call's context to it.
+const requestIDArg = "_lux_request_id"
+
+const methodCancelled = "notifications/cancelled"
+
+// toolCalls maps the request IDs of tool calls in flight to the cancel
+// funcs of their contexts. A cancellation can overtake the call it names,
+// since calls are handled concurrently, so it is remembered until the call
+// starts.
+type toolCalls struct {
+	mu    sync.Mutex
+	calls map[string]*toolCall
+}
+
+type toolCall struct {
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+func newToolCalls() *toolCalls {
+	return &toolCalls{calls: make(map[string]*toolCall)}
+}
+
+// expect registers a call read from the transport.
+func (c *toolCalls) expect(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[id] = &toolCall{}
+}
+
+// start derives the context of the call with the given id, cancelled
+// already if a cancellation has arrived. The returned func must be called
+// once the call has returned.
+func (c *toolCalls) start(ctx context.Context, id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	call, ok := c.calls[id]
+	if !ok {
+		call = &toolCall{}
+		c.calls[id] = call
+	}
+	call.cancel = cancel
+	if call.cancelled {
+		cancel()
+	}
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.calls, id)
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels the call with the given id. Cancellations of calls that
+// are unknown or already finished are ignored, as MCP requires.
+func (c *toolCalls) cancel(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call, ok := c.calls[id]
+	if !ok {
+		return
+	}
+	call.cancelled = true
+	if call.cancel != nil {
+		call.cancel()
+	}
+}
+
+// cancelTransport hands the request ID of tools/call requests to
+// cancelTools and acts on notifications/cancelled, which the MCP server
+// library ignores.
+type cancelTransport struct {
+	transport.Transport
+	calls *toolCalls
+}
+
+func (t cancelTransport) Read() (*jsonrpc.Message, error) {
+	msg, err := t.Transport.Read()
+	if err != nil {
+		return msg, err
+	}
+
+	switch {
+	case msg.IsRequest() && msg.Method == protocol.MethodToolsCall:
+		id, err := json.Marshal(msg.ID)
+		if err != nil {
+			return msg, nil
+		}
+		if params, ok := injectArg(msg.Params, requestIDArg, id); ok {
+			msg.Params = params
+			t.calls.expect(msg.ID.String())
+		}
+	case msg.IsNotification() && msg.Method == methodCancelled:
+		var params struct {
+			RequestID jsonrpc.ID `json:"requestId"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			t.calls.cancel(params.RequestID.String())
+		}
+	}
+	return msg, nil
+}
+
+// cancelTools runs each tool call under a context that notifications/cancelled
+// for its request ID cancels.
+type cancelTools struct {
+	inner mcpserver.ToolProvider
+	calls *toolCalls
+}
+
+func (c cancelTools) ListTools(ctx context.Context) ([]protocol.Tool, error) {
+	return c.inner.ListTools(ctx)
+}
+
+func (c cancelTools) CallTool(ctx context.Context, name string, args json.RawMessage) (*protocol.ToolCallResult, error) {
+	raw, args, ok := extractArg(args, requestIDArg)
+	if !ok {
+		return c.inner.CallTool(ctx, name, args)
+	}
+	var id jsonrpc.ID
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return c.inner.CallTool(ctx, name, args)
+	}
+
+	ctx, done := c.calls.start(ctx, id.String())
+	defer done()
+	return c.inner.CallTool(ctx, name, args)
+}
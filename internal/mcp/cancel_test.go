@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/protocol"
+)
+
+type queueTransport struct {
+	recordingTransport
+	msgs []*jsonrpc.Message
+}
+
+func (t *queueTransport) Read() (*jsonrpc.Message, error) {
+	msg := t.msgs[0]
+	t.msgs = t.msgs[1:]
+	return msg, nil
+}
+
+type blockingTools struct {
+	args    chan json.RawMessage
+	stopped chan error
+}
+
+func (b *blockingTools) ListTools(ctx context.Context) ([]protocol.Tool, error) {
+	return nil, nil
+}
+
+func (b *blockingTools) CallTool(ctx context.Context, name string, args json.RawMessage) (*protocol.ToolCallResult, error) {
+	b.args <- args
+	<-ctx.Done()
+	b.stopped <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func toolCallAndCancel(t *testing.T, id jsonrpc.ID) (*queueTransport, *toolCalls) {
+	t.Helper()
+	call, err := jsonrpc.NewRequest(id, protocol.MethodToolsCall, map[string]any{
+		"name":      "references",
+		"arguments": map[string]any{"line": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := jsonrpc.NewNotification(methodCancelled, map[string]any{"requestId": id, "reason": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &queueTransport{msgs: []*jsonrpc.Message{call, cancelled}}, newToolCalls()
+}
+
+func readToolCall(t *testing.T, tr cancelTransport) protocol.ToolCallParams {
+	t.Helper()
+	msg, err := tr.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var call protocol.ToolCallParams
+	if err := json.Unmarshal(msg.Params, &call); err != nil {
+		t.Fatal(err)
+	}
+	return call
+}
+
+func TestCancel_NotificationCancelsToolCall(t *testing.T) {
+	queue, calls := toolCallAndCancel(t, jsonrpc.NewNumberID(7))
+	tr := cancelTransport{Transport: queue, calls: calls}
+	inner := &blockingTools{args: make(chan json.RawMessage, 1), stopped: make(chan error, 1)}
+	tools := cancelTools{inner: inner, calls: calls}
+
+	call := readToolCall(t, tr)
+	go tools.CallTool(context.Background(), call.Name, call.Arguments)
+
+	if args := <-inner.args; string(args) != `{"line":3}` {
+		t.Errorf("tool got arguments %s, want the original ones", args)
+	}
+	if _, err := tr.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-inner.stopped:
+		if err != context.Canceled {
+			t.Errorf("tool context ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifications/cancelled did not cancel the tool call")
+	}
+}
+
+func TestCancel_CancellationBeforeCallStarts(t *testing.T) {
+	queue, calls := toolCallAndCancel(t, jsonrpc.NewStringID("req-1"))
+	tr := cancelTransport{Transport: queue, calls: calls}
+	inner := &blockingTools{args: make(chan json.RawMessage, 1), stopped: make(chan error, 1)}
+	tools := cancelTools{inner: inner, calls: calls}
+
+	call := readToolCall(t, tr)
+	if _, err := tr.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	tools.CallTool(context.Background(), call.Name, call.Arguments)
+	if err := <-inner.stopped; err != context.Canceled {
+		t.Errorf("tool context ended with %v", err)
+	}
+	if len(calls.calls) != 0 {
+		t.Errorf("finished calls should be forgotten, got %d", len(calls.calls))
+	}
+}
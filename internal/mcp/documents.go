@@ -2,9 +2,12 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/server"
@@ -12,11 +15,14 @@ import (
 	"github.com/amarbel-llc/lux/internal/tools"
 )
 
+const closeUnusedInterval = 10 * time.Second
+
 type openDoc struct {
-	uri     lsp.DocumentURI
-	langID  string
-	version int
-	lspName string
+	uri      lsp.DocumentURI
+	langID   string
+	version  int
+	hash     string   // tools.ContentHash of the text last sent
+	instKeys []string // pool keys of the instances the document was opened in
 }
 
 type DocumentManager struct {
@@ -37,8 +43,8 @@ func NewDocumentManager(pool *subprocess.Pool, router *server.Router, bridge *to
 }
 
 func (dm *DocumentManager) Open(ctx context.Context, uri lsp.DocumentURI) error {
-	lspName := dm.router.RouteByURI(uri)
-	if lspName == "" {
+	lspNames := dm.router.RouteAllByURI(uri)
+	if len(lspNames) == 0 {
 		return fmt.Errorf("no LSP configured for %s", uri)
 	}
 
@@ -48,14 +54,23 @@ func (dm *DocumentManager) Open(ctx context.Context, uri lsp.DocumentURI) error
 	}
 
 	initParams := dm.bridge.DefaultInitParams(uri)
-	inst, err := dm.pool.GetOrStart(ctx, lspName, initParams)
-	if err != nil {
-		return fmt.Errorf("starting LSP %s: %w", lspName, err)
-	}
-
 	projectRoot := dm.bridge.ProjectRootForPath(uri.Path())
-	if err := inst.EnsureWorkspaceFolder(projectRoot); err != nil {
-		return fmt.Errorf("adding workspace folder: %w", err)
+
+	// The primary LSP must start; additional LSPs are best-effort.
+	var insts []*subprocess.LSPInstance
+	for i, lspName := range lspNames {
+		inst, err := dm.pool.GetOrStart(ctx, lspName, initParams)
+		if err != nil {
+			if i == 0 {
+				return fmt.Errorf("starting LSP %s: %w", lspName, err)
+			}
+			fmt.Fprintf(os.Stderr, "[lux] %s: skipping: %v\n", lspName, err)
+			continue
+		}
+		if err := inst.EnsureWorkspaceFolder(projectRoot); err != nil {
+			return fmt.Errorf("adding workspace folder: %w", err)
+		}
+		insts = append(insts, inst)
 	}
 
 	langID := dm.bridge.InferLanguageID(uri)
@@ -65,35 +80,64 @@ func (dm *DocumentManager) Open(ctx context.Context, uri lsp.DocumentURI) error
 
 	if existing, ok := dm.docs[uri]; ok {
 		existing.version++
-		return inst.Notify(lsp.MethodTextDocumentDidChange, lsp.DidChangeTextDocumentParams{
-			TextDocument: lsp.VersionedTextDocumentIdentifier{
-				TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
-				Version:                existing.version,
-			},
-			ContentChanges: []lsp.TextDocumentContentChangeEvent{
-				{Text: content},
-			},
-		})
-	}
-
-	if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
-		TextDocument: lsp.TextDocumentItem{
-			URI:        uri,
-			LanguageID: langID,
-			Version:    1,
-			Text:       content,
-		},
-	}); err != nil {
-		return fmt.Errorf("opening document: %w", err)
+		existing.hash = tools.ContentHash(content)
+		for _, inst := range insts {
+			// A server that started since the document was opened has
+			// never seen it.
+			if !slices.Contains(existing.instKeys, inst.Key) {
+				if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
+					TextDocument: lsp.TextDocumentItem{
+						URI:        uri,
+						LanguageID: existing.langID,
+						Version:    existing.version,
+						Text:       content,
+					},
+				}); err == nil {
+					existing.instKeys = append(existing.instKeys, inst.Key)
+				}
+				continue
+			}
+			if err := inst.Notify(lsp.MethodTextDocumentDidChange, lsp.DidChangeTextDocumentParams{
+				TextDocument: lsp.VersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
+					Version:                existing.version,
+				},
+				ContentChanges: []lsp.TextDocumentContentChangeEvent{
+					{Text: content},
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	dm.docs[uri] = &openDoc{
+	doc := &openDoc{
 		uri:     uri,
 		langID:  langID,
 		version: 1,
-		lspName: lspName,
+		hash:    tools.ContentHash(content),
+	}
+
+	for _, inst := range insts {
+		if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{
+				URI:        uri,
+				LanguageID: langID,
+				Version:    1,
+				Text:       content,
+			},
+		}); err != nil {
+			if len(doc.instKeys) == 0 {
+				return fmt.Errorf("opening document: %w", err)
+			}
+			continue
+		}
+		doc.instKeys = append(doc.instKeys, inst.Key)
 	}
 
+	dm.docs[uri] = doc
+
 	return nil
 }
 
@@ -107,14 +151,7 @@ func (dm *DocumentManager) Close(uri lsp.DocumentURI) error {
 	delete(dm.docs, uri)
 	dm.mu.Unlock()
 
-	inst, ok := dm.pool.Get(doc.lspName)
-	if !ok {
-		return nil
-	}
-
-	return inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
-		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
-	})
+	return dm.notifyClose(doc)
 }
 
 func (dm *DocumentManager) CloseAll() {
@@ -126,14 +163,102 @@ func (dm *DocumentManager) CloseAll() {
 	dm.docs = make(map[lsp.DocumentURI]*openDoc)
 	dm.mu.Unlock()
 
-	for uri, doc := range docs {
-		inst, ok := dm.pool.Get(doc.lspName)
+	for _, doc := range docs {
+		dm.notifyClose(doc)
+	}
+}
+
+// CloseUnused closes the documents whose servers have all gone unused for
+// their idle timeout. Agents never close the documents tool calls open, so
+// without this no server with an idle timeout would ever be stopped.
+func (dm *DocumentManager) CloseUnused() {
+	dm.mu.RLock()
+	var unused []lsp.DocumentURI
+	for uri, doc := range dm.docs {
+		if dm.unused(doc) {
+			unused = append(unused, uri)
+		}
+	}
+	dm.mu.RUnlock()
+
+	for _, uri := range unused {
+		dm.Close(uri)
+	}
+}
+
+func (dm *DocumentManager) unused(doc *openDoc) bool {
+	for _, key := range doc.instKeys {
+		if inst, ok := dm.pool.Get(key); ok && !inst.Unused() {
+			return false
+		}
+	}
+	return true
+}
+
+// closeUnusedLoop calls CloseUnused periodically until ctx is done.
+func (dm *DocumentManager) closeUnusedLoop(ctx context.Context) {
+	ticker := time.NewTicker(closeUnusedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dm.CloseUnused()
+		}
+	}
+}
+
+func (dm *DocumentManager) notifyClose(doc *openDoc) error {
+	var errs []error
+	for _, lspName := range doc.instKeys {
+		inst, ok := dm.pool.Get(lspName)
 		if !ok {
 			continue
 		}
-		inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
-			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
-		})
+		if err := inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: doc.uri},
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Replay reopens the documents that were open in inst before it was
+// restarted, reading their current content from disk.
+func (dm *DocumentManager) Replay(inst *subprocess.LSPInstance) {
+	dm.mu.RLock()
+	var docs []openDoc
+	for _, doc := range dm.docs {
+		if slices.Contains(doc.instKeys, inst.Key) {
+			docs = append(docs, *doc)
+		}
+	}
+	dm.mu.RUnlock()
+
+	for _, doc := range docs {
+		content, err := readFileContent(doc.uri)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] %s: reopening %s: %v\n", inst.Key, doc.uri, err)
+			continue
+		}
+		dm.mu.Lock()
+		if current, ok := dm.docs[doc.uri]; ok {
+			current.hash = tools.ContentHash(content)
+		}
+		dm.mu.Unlock()
+		if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{
+				URI:        doc.uri,
+				LanguageID: doc.langID,
+				Version:    doc.version,
+				Text:       content,
+			},
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] %s: reopening %s: %v\n", inst.Key, doc.uri, err)
+		}
 	}
 }
 
@@ -144,6 +269,17 @@ func (dm *DocumentManager) IsOpen(uri lsp.DocumentURI) bool {
 	return ok
 }
 
+// Snapshot implements tools.DocumentTracker.
+func (dm *DocumentManager) Snapshot(uri lsp.DocumentURI) (int, string, bool) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	doc, ok := dm.docs[uri]
+	if !ok {
+		return 0, "", false
+	}
+	return doc.version, doc.hash, true
+}
+
 // OpenURI implements transport.DocumentLifecycle.
 func (dm *DocumentManager) OpenURI(ctx context.Context, uri string) error {
 	return dm.Open(ctx, lsp.DocumentURI(uri))
@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+
+	"github.com/amarbel-llc/lux/internal/config/filetype"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/server"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/tools"
+)
+
+// docExecutor runs an in-memory LSP per Execute call, named by the flake it
+// was built from. The servers answer every request and report the document
+// notifications they receive on notes as "<flake> <method>". Builds of the
+// flakes in failing fail.
+type docExecutor struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	notes   chan string
+}
+
+func (e *docExecutor) Build(ctx context.Context, flake, binary string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failing[flake] {
+		return "", errors.New("build failed")
+	}
+	return flake, nil
+}
+
+func (e *docExecutor) BuildStorePath(ctx context.Context, flake string) (string, error) {
+	return flake, nil
+}
+
+func (e *docExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*subprocess.Process, error) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	stream := jsonrpc.NewStream(serverR, serverW)
+
+	go func() {
+		for {
+			msg, err := stream.Read()
+			if err != nil {
+				return
+			}
+			if msg.IsNotification() {
+				if strings.HasPrefix(msg.Method, "textDocument/") {
+					e.notes <- path + " " + msg.Method
+				}
+				continue
+			}
+			var result any
+			if msg.Method == lsp.MethodInitialize {
+				result = map[string]any{"capabilities": map[string]any{}}
+			}
+			resp, _ := jsonrpc.NewResponse(*msg.ID, result)
+			stream.Write(resp)
+		}
+	}()
+
+	kill := sync.OnceFunc(func() {
+		serverW.Close()
+		clientW.Close()
+	})
+	return &subprocess.Process{
+		Stdin:  clientW,
+		Stdout: clientR,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		Wait:   func() error { return nil },
+		Kill:   func() error { kill(); return nil },
+	}, nil
+}
+
+func (e *docExecutor) waitNote(t *testing.T, want string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case note := <-e.notes:
+			if note == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
+
+func TestDocumentManager_OpensInLaterServers(t *testing.T) {
+	executor := &docExecutor{failing: map[string]bool{"golangci": true}, notes: make(chan string, 64)}
+	pool := subprocess.NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(subprocess.LSPSpec{Name: "gopls", Flake: "gopls"})
+	pool.Register(subprocess.LSPSpec{Name: "golangci", Flake: "golangci"})
+	defer pool.StopAll()
+
+	router, err := server.NewRouter([]*filetype.Config{
+		{Name: "go", Extensions: []string{"go"}, LSP: "gopls", LSPs: []string{"golangci"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	dm := NewDocumentManager(pool, router, tools.NewBridge(pool, router, nil, executor, nil))
+
+	path := filepath.Join(t.TempDir(), "a.go")
+	if err := os.WriteFile(path, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := lsp.URIFromPath(path)
+
+	if err := dm.Open(context.Background(), uri); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	executor.waitNote(t, "gopls "+lsp.MethodTextDocumentDidOpen)
+
+	// The secondary server becomes available after the document is open.
+	executor.mu.Lock()
+	executor.failing["golangci"] = false
+	executor.mu.Unlock()
+
+	if err := dm.Open(context.Background(), uri); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	executor.waitNote(t, "gopls "+lsp.MethodTextDocumentDidChange)
+	executor.waitNote(t, "golangci "+lsp.MethodTextDocumentDidOpen)
+
+	if err := dm.Open(context.Background(), uri); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	executor.waitNote(t, "golangci "+lsp.MethodTextDocumentDidChange)
+}
@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/protocol"
+	mcpserver "github.com/amarbel-llc/purse-first/libs/go-mcp/server"
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/transport"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// progressTokenArg is where progressTransport puts the progress token of a
+// tools/call request. The MCP server library hands tools only their name and
+// arguments, so _meta would otherwise be lost on the way.
+const progressTokenArg = "_lux_progress_token"
+
+// progressTransport moves params._meta.progressToken of tools/call requests
+// into their arguments for progressTools.
+type progressTransport struct {
+	transport.Transport
+}
+
+func (t progressTransport) Read() (*jsonrpc.Message, error) {
+	msg, err := t.Transport.Read()
+	if err != nil || !msg.IsRequest() || msg.Method != protocol.MethodToolsCall {
+		return msg, err
+	}
+	if params, ok := liftProgressToken(msg.Params); ok {
+		msg.Params = params
+	}
+	return msg, nil
+}
+
+func liftProgressToken(raw json.RawMessage) (json.RawMessage, bool) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, false
+	}
+	var meta struct {
+		ProgressToken json.RawMessage `json:"progressToken"`
+	}
+	if m, ok := params["_meta"]; !ok || json.Unmarshal(m, &meta) != nil || len(meta.ProgressToken) == 0 {
+		return nil, false
+	}
+	return injectArg(raw, progressTokenArg, meta.ProgressToken)
+}
+
+// injectArg adds name to the arguments of the tools/call params raw.
+func injectArg(raw json.RawMessage, name string, value json.RawMessage) (json.RawMessage, bool) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, false
+	}
+
+	args := make(map[string]json.RawMessage)
+	if a, ok := params["arguments"]; ok {
+		if err := json.Unmarshal(a, &args); err != nil || args == nil {
+			return nil, false
+		}
+	}
+	args[name] = value
+
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return nil, false
+	}
+	params["arguments"] = encoded
+	out, err := json.Marshal(params)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// extractArg removes the argument injectArg added under name, returning its
+// value and the remaining arguments.
+func extractArg(args json.RawMessage, name string) (json.RawMessage, json.RawMessage, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(args, &fields); err != nil {
+		return nil, args, false
+	}
+	value, ok := fields[name]
+	if !ok {
+		return nil, args, false
+	}
+	delete(fields, name)
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return nil, args, false
+	}
+	return value, rest, true
+}
+
+// progressTools runs tool calls that carry a progress token with a
+// subprocess.ProgressFunc sending notifications/progress for that token.
+type progressTools struct {
+	inner     mcpserver.ToolProvider
+	transport transport.Transport
+}
+
+func (p progressTools) ListTools(ctx context.Context) ([]protocol.Tool, error) {
+	return p.inner.ListTools(ctx)
+}
+
+func (p progressTools) CallTool(ctx context.Context, name string, args json.RawMessage) (*protocol.ToolCallResult, error) {
+	token, args, ok := extractArg(args, progressTokenArg)
+	if !ok {
+		return p.inner.CallTool(ctx, name, args)
+	}
+
+	n := &progressNotifier{token: token, transport: p.transport}
+	defer n.close()
+	return p.inner.CallTool(subprocess.WithProgress(ctx, n.report), name, args)
+}
+
+// progressNotifier sends notifications/progress for one tool call. Servers
+// started by the call may report after it returns; those reports are
+// dropped.
+type progressNotifier struct {
+	token     json.RawMessage
+	transport transport.Transport
+
+	mu       sync.Mutex
+	progress int
+	done     bool
+}
+
+func (n *progressNotifier) report(message string, percentage *int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.done {
+		return
+	}
+
+	// progress must grow with every notification, and the reports of
+	// several servers and build steps do not share one scale, so it counts
+	// reports and the percentage travels in the message.
+	n.progress++
+	if percentage != nil {
+		message += fmt.Sprintf(" (%d%%)", *percentage)
+	}
+
+	notification, err := jsonrpc.NewNotification("notifications/progress", map[string]any{
+		"progressToken": n.token,
+		"progress":      n.progress,
+		"message":       message,
+	})
+	if err == nil {
+		n.transport.Write(notification)
+	}
+}
+
+func (n *progressNotifier) close() {
+	n.mu.Lock()
+	n.done = true
+	n.mu.Unlock()
+}
@@ -0,0 +1,106 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/protocol"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+type recordingTransport struct {
+	mu      sync.Mutex
+	written []*jsonrpc.Message
+}
+
+func (t *recordingTransport) Read() (*jsonrpc.Message, error) { select {} }
+func (t *recordingTransport) Close() error                    { return nil }
+
+func (t *recordingTransport) Write(msg *jsonrpc.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.written = append(t.written, msg)
+	return nil
+}
+
+type reportingTools struct {
+	args  json.RawMessage
+	after func()
+}
+
+func (r *reportingTools) ListTools(ctx context.Context) ([]protocol.Tool, error) {
+	return nil, nil
+}
+
+func (r *reportingTools) CallTool(ctx context.Context, name string, args json.RawMessage) (*protocol.ToolCallResult, error) {
+	r.args = args
+	pct := 40
+	subprocess.ReportProgress(ctx, "gopls: starting", nil)
+	subprocess.ReportProgress(ctx, "gopls: Loading packages", &pct)
+	r.after = func() { subprocess.ReportProgress(ctx, "late", nil) }
+	return &protocol.ToolCallResult{}, nil
+}
+
+func TestProgress_ToolCallReportsToItsToken(t *testing.T) {
+	params, ok := liftProgressToken(json.RawMessage(`{"name":"hover","arguments":{"line":3},"_meta":{"progressToken":"tok-1"}}`))
+	if !ok {
+		t.Fatal("progress token was not lifted")
+	}
+
+	var call protocol.ToolCallParams
+	if err := json.Unmarshal(params, &call); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := &recordingTransport{}
+	inner := &reportingTools{}
+	tools := progressTools{inner: inner, transport: tr}
+	if _, err := tools.CallTool(context.Background(), call.Name, call.Arguments); err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	inner.after()
+
+	if string(inner.args) != `{"line":3}` {
+		t.Errorf("tool got arguments %s, want the original ones", inner.args)
+	}
+
+	if len(tr.written) != 2 {
+		t.Fatalf("got %d notifications, want 2 (none after the call returned)", len(tr.written))
+	}
+	wantMsgs := []string{"gopls: starting", "gopls: Loading packages (40%)"}
+	for i, msg := range tr.written {
+		if msg.Method != "notifications/progress" {
+			t.Errorf("notification %d method = %s", i, msg.Method)
+		}
+		var p struct {
+			ProgressToken string `json:"progressToken"`
+			Progress      int    `json:"progress"`
+			Message       string `json:"message"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.ProgressToken != "tok-1" || p.Progress != i+1 || p.Message != wantMsgs[i] {
+			t.Errorf("notification %d = %+v", i, p)
+		}
+	}
+}
+
+func TestProgress_CallWithoutTokenIsUnchanged(t *testing.T) {
+	if _, ok := liftProgressToken(json.RawMessage(`{"name":"hover","arguments":{"line":3}}`)); ok {
+		t.Error("params without _meta should be left alone")
+	}
+
+	tr := &recordingTransport{}
+	inner := &reportingTools{}
+	tools := progressTools{inner: inner, transport: tr}
+	if _, err := tools.CallTool(context.Background(), "hover", json.RawMessage(`{"line":3}`)); err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if len(tr.written) != 0 {
+		t.Errorf("got %d notifications for a call without a progress token", len(tr.written))
+	}
+}
@@ -20,19 +20,21 @@ import (
 	"github.com/amarbel-llc/lux/pkg/filematch"
 )
 
-// resourceProvider wraps a ResourceRegistry to handle the symbols resource
-// template which uses prefix matching on URIs rather than exact lookup.
+// resourceProvider wraps a ResourceRegistry to handle the resource
+// templates, which use prefix matching on URIs rather than exact lookup.
 type resourceProvider struct {
 	registry  *mcpserver.ResourceRegistry
 	bridge    *tools.Bridge
 	diagStore *DiagnosticsStore
+	pool      *subprocess.Pool
 }
 
-func newResourceProvider(registry *mcpserver.ResourceRegistry, bridge *tools.Bridge, diagStore *DiagnosticsStore) *resourceProvider {
+func newResourceProvider(registry *mcpserver.ResourceRegistry, bridge *tools.Bridge, diagStore *DiagnosticsStore, pool *subprocess.Pool) *resourceProvider {
 	return &resourceProvider{
 		registry:  registry,
 		bridge:    bridge,
 		diagStore: diagStore,
+		pool:      pool,
 	}
 }
 
@@ -49,6 +51,10 @@ func (p *resourceProvider) ReadResource(ctx context.Context, uri string) (*proto
 		encodedURI := strings.TrimPrefix(uri, "lux://diagnostics/")
 		return readDiagnostics(p.diagStore, uri, encodedURI)
 	}
+	if strings.HasPrefix(uri, "lux://logs/") {
+		name := strings.TrimPrefix(uri, "lux://logs/")
+		return readLogs(p.pool, uri, name)
+	}
 	return p.registry.ReadResource(ctx, uri)
 }
 
@@ -68,7 +74,7 @@ func registerResources(
 
 	matcher := filematch.NewMatcherSet()
 	for _, ft := range ftConfigs {
-		if ft.LSP != "" {
+		if len(ft.LSPNames()) > 0 {
 			matcher.Add(ft.Name, ft.Extensions, ft.Patterns, ft.LanguageIDs)
 		}
 	}
@@ -128,6 +134,16 @@ func registerResources(
 		},
 		nil, // Template URIs are handled by the resourceProvider wrapper
 	)
+
+	registry.RegisterTemplate(
+		protocol.ResourceTemplate{
+			URITemplate: "lux://logs/{lsp}",
+			Name:        "LSP Logs",
+			Description: "Recent stderr output, window/logMessage and window/showMessage messages and lifecycle events (starts, crashes, restarts) of a language server. Use when an LSP fails or returns unexpected results.",
+			MimeType:    "application/json",
+		},
+		nil, // Template URIs are handled by the resourceProvider wrapper
+	)
 }
 
 type statusResponse struct {
@@ -138,16 +154,32 @@ type statusResponse struct {
 
 type lspStatus struct {
 	Name       string   `json:"name"`
-	Flake      string   `json:"flake"`
+	Flake      string   `json:"flake,omitempty"`
+	Command    string   `json:"command,omitempty"`
+	Address    string   `json:"address,omitempty"`
 	Extensions []string `json:"extensions,omitempty"`
 	Patterns   []string `json:"patterns,omitempty"`
 	State      string   `json:"state"`
+
+	// Projects lists the per-project instances of an LSP with
+	// instance_scope = "project".
+	Projects []projectStatus `json:"projects,omitempty"`
+}
+
+type projectStatus struct {
+	Root  string `json:"root"`
+	State string `json:"state"`
 }
 
 func readStatus(pool *subprocess.Pool, cfg *config.Config, ftConfigs []*filetype.Config) (*protocol.ResourceReadResult, error) {
 	statuses := pool.Status()
 	statusMap := make(map[string]string)
+	projectMap := make(map[string][]projectStatus)
 	for _, s := range statuses {
+		if s.ProjectRoot != "" {
+			projectMap[s.Name] = append(projectMap[s.Name], projectStatus{Root: s.ProjectRoot, State: s.State})
+			continue
+		}
 		statusMap[s.Name] = s.State
 	}
 
@@ -156,9 +188,9 @@ func readStatus(pool *subprocess.Pool, cfg *config.Config, ftConfigs []*filetype
 	lspPatterns := make(map[string][]string)
 	var allExts, allLangs []string
 	for _, ft := range ftConfigs {
-		if ft.LSP != "" {
-			lspExts[ft.LSP] = append(lspExts[ft.LSP], ft.Extensions...)
-			lspPatterns[ft.LSP] = append(lspPatterns[ft.LSP], ft.Patterns...)
+		for _, name := range ft.LSPNames() {
+			lspExts[name] = append(lspExts[name], ft.Extensions...)
+			lspPatterns[name] = append(lspPatterns[name], ft.Patterns...)
 		}
 		allExts = append(allExts, ft.Extensions...)
 		allLangs = append(allLangs, ft.LanguageIDs...)
@@ -174,9 +206,12 @@ func readStatus(pool *subprocess.Pool, cfg *config.Config, ftConfigs []*filetype
 		lsps = append(lsps, lspStatus{
 			Name:       l.Name,
 			Flake:      l.Flake,
+			Command:    l.Command,
+			Address:    l.Address,
 			Extensions: lspExts[l.Name],
 			Patterns:   lspPatterns[l.Name],
 			State:      state,
+			Projects:   projectMap[l.Name],
 		})
 	}
 
@@ -206,6 +241,7 @@ type languagesResponse map[string]languageInfo
 
 type languageInfo struct {
 	LSP        string   `json:"lsp"`
+	LSPs       []string `json:"lsps,omitempty"`
 	Extensions []string `json:"extensions,omitempty"`
 	Patterns   []string `json:"patterns,omitempty"`
 }
@@ -216,6 +252,7 @@ func readLanguages(ftConfigs []*filetype.Config) (*protocol.ResourceReadResult,
 	for _, ft := range ftConfigs {
 		resp[ft.Name] = languageInfo{
 			LSP:        ft.LSP,
+			LSPs:       ft.LSPs,
 			Extensions: ft.Extensions,
 			Patterns:   ft.Patterns,
 		}
@@ -368,3 +405,33 @@ func readDiagnostics(diagStore *DiagnosticsStore, resourceURI, encodedFileURI st
 		},
 	}, nil
 }
+
+type logsResponse struct {
+	LSP     string                `json:"lsp"`
+	Entries []subprocess.LogEntry `json:"entries"`
+}
+
+func readLogs(pool *subprocess.Pool, resourceURI, name string) (*protocol.ResourceReadResult, error) {
+	entries, err := pool.Logs(name)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []subprocess.LogEntry{}
+	}
+
+	data, err := json.MarshalIndent(logsResponse{LSP: name, Entries: entries}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.ResourceReadResult{
+		Contents: []protocol.ResourceContent{
+			{
+				URI:      resourceURI,
+				MimeType: "application/json",
+				Text:     string(data),
+			},
+		},
+	}, nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/amarbel-llc/lux/internal/server"
 	"github.com/amarbel-llc/lux/internal/subprocess"
 	"github.com/amarbel-llc/lux/internal/tools"
+	"github.com/amarbel-llc/lux/internal/trace"
 	"github.com/amarbel-llc/lux/internal/warmup"
 )
 
@@ -24,6 +25,7 @@ type Server struct {
 	inner     *mcpserver.Server
 	pool      *subprocess.Pool
 	docMgr    *DocumentManager
+	bridge    *tools.Bridge
 	diagStore *DiagnosticsStore
 	transport transport.Transport
 }
@@ -40,8 +42,10 @@ func New(cfg *config.Config, t transport.Transport) (*Server, error) {
 		return nil, fmt.Errorf("creating router: %w", err)
 	}
 
-	executor := subprocess.NewNixExecutor()
+	executor := server.NewExecutor()
 
+	calls := newToolCalls()
+	t = cancelTransport{Transport: progressTransport{t}, calls: calls}
 	s := &Server{
 		transport: t,
 		diagStore: NewDiagnosticsStore(),
@@ -52,14 +56,7 @@ func New(cfg *config.Config, t transport.Transport) (*Server, error) {
 	})
 
 	for _, l := range cfg.LSPs {
-		var capOverrides *subprocess.CapabilityOverride
-		if l.Capabilities != nil {
-			capOverrides = &subprocess.CapabilityOverride{
-				Disable: l.Capabilities.Disable,
-				Enable:  l.Capabilities.Enable,
-			}
-		}
-		s.pool.Register(l.Name, l.Flake, l.Binary, l.Args, l.Env, l.InitOptions, l.Settings, l.SettingsWireKey(), capOverrides, l.ShouldWaitForReady(), l.ReadyTimeoutDuration(), l.ActivityTimeoutDuration())
+		s.pool.Register(server.LSPSpec(l))
 	}
 
 	var fmtRouter *formatter.Router
@@ -91,8 +88,10 @@ func New(cfg *config.Config, t transport.Transport) (*Server, error) {
 			t.Write(notification)
 		}
 	})
+	s.bridge = bridge
 	s.docMgr = NewDocumentManager(s.pool, router, bridge)
 	bridge.SetDocumentManager(s.docMgr)
+	s.pool.OnRestart(s.docMgr.Replay)
 
 	app := command.NewApp("lux", "MCP server exposing LSP capabilities as tools")
 	app.Version = "0.1.0"
@@ -111,8 +110,8 @@ func New(cfg *config.Config, t transport.Transport) (*Server, error) {
 	inner, err := mcpserver.New(t, mcpserver.Options{
 		ServerName:    app.Name,
 		ServerVersion: app.Version,
-		Tools:         toolRegistry,
-		Resources:     newResourceProvider(resourceRegistry, bridge, s.diagStore),
+		Tools:         cancelTools{inner: progressTools{inner: toolRegistry, transport: t}, calls: calls},
+		Resources:     newResourceProvider(resourceRegistry, bridge, s.diagStore, s.pool),
 		Prompts:       promptRegistry,
 	})
 	if err != nil {
@@ -131,6 +130,12 @@ func (s *Server) Run(ctx context.Context) error {
 		s.docMgr.CloseAll()
 		s.pool.StopAll()
 	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.pool.Supervise(ctx)
+	go s.docMgr.closeUnusedLoop(ctx)
+
 	return s.inner.Run(ctx)
 }
 
@@ -138,6 +143,12 @@ func (s *Server) Close() {
 	s.inner.Close()
 }
 
+// SetTracer records language server traffic to rec. Client traffic is
+// recorded by wrapping the transport with rec.TapTransport before New.
+func (s *Server) SetTracer(rec *trace.Recorder) {
+	s.pool.SetTracer(rec)
+}
+
 func (s *Server) DocumentManager() *DocumentManager {
 	return s.docMgr
 }
@@ -155,6 +166,16 @@ func (s *Server) lspNotificationHandler(lspName string) jsonrpc.Handler {
 			return jsonrpc.NewResponse(*msg.ID, nil)
 		}
 
+		// Answer workspace edit requests; the bridge applies them only while
+		// execute_code_action runs a command.
+		if msg.IsRequest() && msg.Method == lsp.MethodWorkspaceApplyEdit {
+			var params lsp.ApplyWorkspaceEditParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, err.Error(), nil)
+			}
+			return jsonrpc.NewResponse(*msg.ID, s.bridge.ApplyEdit(ctx, lspName, params))
+		}
+
 		// Intercept $/progress notifications — update tracker, log to stderr
 		if msg.IsNotification() && msg.Method == lsp.MethodProgress {
 			if inst, ok := s.pool.Get(lspName); ok && inst.Progress != nil {
@@ -178,7 +199,7 @@ func (s *Server) lspNotificationHandler(lspName string) jsonrpc.Handler {
 			return nil, nil
 		}
 
-		if msg.Method == "textDocument/publishDiagnostics" && msg.Params != nil {
+		if msg.Method == lsp.MethodTextDocumentPublishDiagnostics && msg.Params != nil {
 			var params lsp.PublishDiagnosticsParams
 			if err := json.Unmarshal(msg.Params, &params); err != nil {
 				return nil, nil
@@ -72,6 +72,7 @@ func TestMCPToolsList(t *testing.T) {
 		"format",
 		"document_symbols",
 		"code_action",
+		"execute_code_action",
 		"rename",
 		"workspace_symbols",
 		"diagnostics",
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// DiagnosticsAggregator keeps the diagnostics each LSP last published for a
+// URI so the client can be sent a single merged publish per URI. Without it
+// the last server to publish for a file would overwrite everyone else.
+type DiagnosticsAggregator struct {
+	entries map[lsp.DocumentURI]map[string][]lsp.Diagnostic
+	mu      sync.Mutex
+}
+
+func NewDiagnosticsAggregator() *DiagnosticsAggregator {
+	return &DiagnosticsAggregator{
+		entries: make(map[lsp.DocumentURI]map[string][]lsp.Diagnostic),
+	}
+}
+
+// Update records the diagnostics lspName published and returns the merged
+// publish for the URI. Diagnostics without a source are attributed to
+// lspName.
+func (a *DiagnosticsAggregator) Update(lspName string, params lsp.PublishDiagnosticsParams) lsp.PublishDiagnosticsParams {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	byServer, ok := a.entries[params.URI]
+	if !ok {
+		byServer = make(map[string][]lsp.Diagnostic)
+		a.entries[params.URI] = byServer
+	}
+
+	if len(params.Diagnostics) == 0 {
+		delete(byServer, lspName)
+	} else {
+		diags := make([]lsp.Diagnostic, len(params.Diagnostics))
+		for i, d := range params.Diagnostics {
+			if d.Source == "" {
+				d.Source = lspName
+			}
+			diags[i] = d
+		}
+		byServer[lspName] = diags
+	}
+
+	merged := lsp.PublishDiagnosticsParams{
+		URI:         params.URI,
+		Version:     params.Version,
+		Diagnostics: a.mergedLocked(params.URI),
+	}
+
+	if len(byServer) == 0 {
+		delete(a.entries, params.URI)
+	}
+
+	return merged
+}
+
+// Clear drops what lspName published for the URIs under root, or for every
+// URI when root is empty, and returns the merged publish for each URI that
+// changed. It is called when a server stops, since it will not withdraw its
+// diagnostics itself.
+func (a *DiagnosticsAggregator) Clear(lspName, root string) []lsp.PublishDiagnosticsParams {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cleared []lsp.PublishDiagnosticsParams
+	for uri, byServer := range a.entries {
+		if _, ok := byServer[lspName]; !ok || !underRoot(uri.Path(), root) {
+			continue
+		}
+		delete(byServer, lspName)
+		cleared = append(cleared, lsp.PublishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: a.mergedLocked(uri),
+		})
+		if len(byServer) == 0 {
+			delete(a.entries, uri)
+		}
+	}
+
+	sort.Slice(cleared, func(i, j int) bool { return cleared[i].URI < cleared[j].URI })
+	return cleared
+}
+
+func underRoot(path, root string) bool {
+	return root == "" || path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/")
+}
+
+func (a *DiagnosticsAggregator) mergedLocked(uri lsp.DocumentURI) []lsp.Diagnostic {
+	byServer := a.entries[uri]
+
+	names := make([]string, 0, len(byServer))
+	for name := range byServer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	merged := []lsp.Diagnostic{}
+	for _, name := range names {
+		merged = append(merged, byServer[name]...)
+	}
+	return merged
+}
+
+// clearDiagnostics withdraws what a stopped instance published. Project
+// instances share their LSP's name, so only the URIs under their root are
+// cleared.
+func (s *Server) clearDiagnostics(inst *subprocess.LSPInstance) {
+	for _, params := range s.diagnostics.Clear(inst.Name, inst.ProjectRoot) {
+		if s.clientConn != nil {
+			s.clientConn.Notify(lsp.MethodTextDocumentPublishDiagnostics, params)
+		}
+	}
+}
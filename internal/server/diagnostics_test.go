@@ -0,0 +1,94 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestDiagnosticsAggregator_MergesServers(t *testing.T) {
+	agg := NewDiagnosticsAggregator()
+	uri := lsp.DocumentURI("file:///src/app.ts")
+
+	agg.Update("tsserver", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []lsp.Diagnostic{{Message: "type error"}},
+	})
+	merged := agg.Update("eslint", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []lsp.Diagnostic{{Message: "no-unused-vars", Source: "eslint-plugin"}},
+	})
+
+	if len(merged.Diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(merged.Diagnostics))
+	}
+
+	sources := map[string]string{}
+	for _, d := range merged.Diagnostics {
+		sources[d.Message] = d.Source
+	}
+	if sources["type error"] != "tsserver" {
+		t.Errorf("source = %q, want %q", sources["type error"], "tsserver")
+	}
+	if sources["no-unused-vars"] != "eslint-plugin" {
+		t.Errorf("existing source overwritten: %q", sources["no-unused-vars"])
+	}
+}
+
+func TestDiagnosticsAggregator_ReplacesPerServer(t *testing.T) {
+	agg := NewDiagnosticsAggregator()
+	uri := lsp.DocumentURI("file:///src/main.go")
+
+	agg.Update("gopls", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []lsp.Diagnostic{{Message: "a"}, {Message: "b"}},
+	})
+	agg.Update("golangci", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []lsp.Diagnostic{{Message: "lint"}},
+	})
+	merged := agg.Update("gopls", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []lsp.Diagnostic{{Message: "c"}},
+	})
+
+	if len(merged.Diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(merged.Diagnostics))
+	}
+
+	merged = agg.Update("golangci", lsp.PublishDiagnosticsParams{URI: uri})
+	if len(merged.Diagnostics) != 1 || merged.Diagnostics[0].Message != "c" {
+		t.Errorf("expected only gopls diagnostic to remain, got %+v", merged.Diagnostics)
+	}
+
+	merged = agg.Update("gopls", lsp.PublishDiagnosticsParams{URI: uri})
+	if merged.Diagnostics == nil || len(merged.Diagnostics) != 0 {
+		t.Errorf("expected empty non-nil diagnostics, got %#v", merged.Diagnostics)
+	}
+}
+
+func TestDiagnosticsAggregator_Clear(t *testing.T) {
+	agg := NewDiagnosticsAggregator()
+	a := lsp.URIFromPath("/src/a/main.rs")
+	b := lsp.URIFromPath("/src/b/main.rs")
+
+	agg.Update("rust-analyzer", lsp.PublishDiagnosticsParams{URI: a, Diagnostics: []lsp.Diagnostic{{Message: "a"}}})
+	agg.Update("rust-analyzer", lsp.PublishDiagnosticsParams{URI: b, Diagnostics: []lsp.Diagnostic{{Message: "b"}}})
+	agg.Update("clippy", lsp.PublishDiagnosticsParams{URI: a, Diagnostics: []lsp.Diagnostic{{Message: "lint"}}})
+
+	cleared := agg.Clear("rust-analyzer", "/src/a")
+	if len(cleared) != 1 || cleared[0].URI != a {
+		t.Fatalf("expected only %s to be republished, got %+v", a, cleared)
+	}
+	if len(cleared[0].Diagnostics) != 1 || cleared[0].Diagnostics[0].Message != "lint" {
+		t.Errorf("expected the other server's diagnostic to remain, got %+v", cleared[0].Diagnostics)
+	}
+
+	cleared = agg.Clear("rust-analyzer", "")
+	if len(cleared) != 1 || cleared[0].URI != b || len(cleared[0].Diagnostics) != 0 {
+		t.Errorf("expected %s to be republished empty, got %+v", b, cleared)
+	}
+	if cleared := agg.Clear("rust-analyzer", ""); len(cleared) != 0 {
+		t.Errorf("clearing twice republished %+v", cleared)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// DocumentStore mirrors the documents the client has open, so they can be
+// opened again in an LSP that was restarted.
+type DocumentStore struct {
+	docs map[lsp.DocumentURI]*lsp.TextDocumentItem
+	mu   sync.Mutex
+}
+
+func NewDocumentStore() *DocumentStore {
+	return &DocumentStore{
+		docs: make(map[lsp.DocumentURI]*lsp.TextDocumentItem),
+	}
+}
+
+// Track updates the store from a didOpen, didChange or didClose
+// notification. Other methods are ignored.
+func (ds *DocumentStore) Track(method string, params json.RawMessage) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	switch method {
+	case lsp.MethodTextDocumentDidOpen:
+		var p lsp.DidOpenTextDocumentParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			ds.docs[p.TextDocument.URI] = &p.TextDocument
+		}
+
+	case lsp.MethodTextDocumentDidChange:
+		var p lsp.DidChangeTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		doc, ok := ds.docs[p.TextDocument.URI]
+		if !ok {
+			return
+		}
+		doc.Text = lsp.ApplyContentChanges(doc.Text, p.ContentChanges)
+		doc.Version = p.TextDocument.Version
+
+	case lsp.MethodTextDocumentDidClose:
+		var p lsp.DidCloseTextDocumentParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			delete(ds.docs, p.TextDocument.URI)
+		}
+	}
+}
+
+// Snapshot returns copies of the open documents.
+func (ds *DocumentStore) Snapshot() []lsp.TextDocumentItem {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	docs := make([]lsp.TextDocumentItem, 0, len(ds.docs))
+	for _, doc := range ds.docs {
+		docs = append(docs, *doc)
+	}
+	return docs
+}
+
+// replayDocuments reopens the client's documents in a restarted LSP.
+func (s *Server) replayDocuments(inst *subprocess.LSPInstance) {
+	for _, doc := range s.documents.Snapshot() {
+		if !slices.Contains(s.router.RouteAllByURI(doc.URI), inst.Name) {
+			continue
+		}
+		if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
+			TextDocument: doc,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] %s: reopening %s: %v\n", inst.Key, doc.URI, err)
+		}
+	}
+}
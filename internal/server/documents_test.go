@@ -0,0 +1,28 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestDocumentStore_Track(t *testing.T) {
+	ds := NewDocumentStore()
+
+	ds.Track(lsp.MethodTextDocumentDidOpen, json.RawMessage(`{"textDocument":{"uri":"file:///a.go","languageId":"go","version":1,"text":"package a\n"}}`))
+	ds.Track(lsp.MethodTextDocumentDidChange, json.RawMessage(`{"textDocument":{"uri":"file:///a.go","version":2},"contentChanges":[{"range":{"start":{"line":0,"character":8},"end":{"line":0,"character":9}},"text":"b"}]}`))
+
+	docs := ds.Snapshot()
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 open document, got %d", len(docs))
+	}
+	if docs[0].Text != "package b\n" || docs[0].Version != 2 || docs[0].LanguageID != "go" {
+		t.Errorf("unexpected document after change: %+v", docs[0])
+	}
+
+	ds.Track(lsp.MethodTextDocumentDidClose, json.RawMessage(`{"textDocument":{"uri":"file:///a.go"}}`))
+	if docs := ds.Snapshot(); len(docs) != 0 {
+		t.Errorf("expected document to be closed, got %+v", docs)
+	}
+}
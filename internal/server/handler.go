@@ -3,24 +3,36 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/capabilities"
 	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/config/filetype"
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
 	"github.com/amarbel-llc/lux/internal/warmup"
 )
 
 type Handler struct {
 	server *Server
+
+	// inflight maps client request IDs to the cancel func of the context
+	// their upstream calls run under, so $/cancelRequest can reach them.
+	inflight   map[string]context.CancelFunc
+	inflightMu sync.Mutex
 }
 
 func NewHandler(s *Server) *Handler {
-	return &Handler{server: s}
+	return &Handler{
+		server:   s,
+		inflight: make(map[string]context.CancelFunc),
+	}
 }
 
 func (h *Handler) Handle(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
@@ -125,10 +137,24 @@ func (h *Handler) handleExit() {
 }
 
 func (h *Handler) handleDefault(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	if msg.Method == lsp.MethodCancelRequest {
+		h.handleCancelRequest(msg)
+		return nil, nil
+	}
+
 	if strings.HasPrefix(msg.Method, "$/") {
 		return nil, nil
 	}
 
+	// LSPs started below must outlive this request, so only the upstream
+	// call runs under the cancellable context.
+	callCtx := ctx
+	if msg.IsRequest() {
+		var cancel context.CancelFunc
+		callCtx, cancel = h.trackRequest(ctx, *msg.ID)
+		defer cancel()
+	}
+
 	if msg.Method == lsp.MethodTextDocumentDidOpen {
 		h.server.warmupOnce.Do(func() {
 			go func() {
@@ -172,13 +198,21 @@ func (h *Handler) handleDefault(ctx context.Context, msg *jsonrpc.Message) (*jso
 	}
 
 	if msg.Method == lsp.MethodTextDocumentFormatting || msg.Method == lsp.MethodTextDocumentRangeFormatting {
-		if resp, handled := h.tryExternalFormat(ctx, msg); handled {
+		if resp, handled := h.tryExternalFormat(callCtx, msg); handled {
 			return resp, nil
 		}
 	}
 
-	lspName := h.server.router.Route(msg.Method, msg.Params)
-	if lspName == "" {
+	if msg.IsRequest() && lsp.IsResolveMethod(msg.Method) {
+		return h.handleResolve(callCtx, msg)
+	}
+
+	if msg.IsRequest() && isWorkspaceRequest(msg.Method) {
+		return h.handleWorkspaceRequest(callCtx, msg)
+	}
+
+	lspNames := h.server.router.RouteAll(msg.Method, msg.Params)
+	if len(lspNames) == 0 {
 		if msg.IsRequest() {
 			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound,
 				"no LSP configured for this file type", nil)
@@ -190,32 +224,118 @@ func (h *Handler) handleDefault(ctx context.Context, msg *jsonrpc.Message) (*jso
 	initParams := h.server.initParams
 	h.server.mu.RUnlock()
 
-	inst, err := h.server.pool.GetOrStart(ctx, lspName, initParams)
-	if err != nil {
-		if msg.IsRequest() {
-			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
-				fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+	// The primary LSP must start; additional LSPs for the filetype are
+	// best-effort so a broken linter does not take down navigation.
+	var insts []*subprocess.LSPInstance
+	for i, lspName := range lspNames {
+		inst, err := h.server.pool.GetOrStart(ctx, lspName, initParams)
+		if err != nil {
+			if i > 0 {
+				fmt.Fprintf(os.Stderr, "warning: starting LSP %s: %v\n", lspName, err)
+				continue
+			}
+			if msg.IsRequest() {
+				return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError,
+					fmt.Sprintf("starting LSP %s: %v", lspName, err), nil)
+			}
+			return nil, err
 		}
-		return nil, err
+		insts = append(insts, inst)
 	}
 
 	if msg.IsNotification() {
-		return nil, inst.Notify(msg.Method, msg.Params)
+		var errs []error
+		for _, inst := range insts {
+			if err := inst.Notify(msg.Method, msg.Params); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		// Tracked after forwarding so a restart triggered above replays the
+		// document as it was before this notification.
+		h.server.documents.Track(msg.Method, msg.Params)
+		return nil, errors.Join(errs...)
 	}
 
-	result, err := inst.Call(ctx, msg.Method, msg.Params)
-	if err != nil {
-		if rpcErr, ok := err.(*jsonrpc.Error); ok {
-			return jsonrpc.NewErrorResponse(*msg.ID, rpcErr.Code, rpcErr.Message, rpcErr.Data)
+	targets := subprocess.SelectForMethod(insts, msg.Method)
+	results, err := subprocess.CallAll(callCtx, targets, func(ctx context.Context, inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		result, err := inst.Call(ctx, msg.Method, msg.Params)
+		if err != nil {
+			return nil, err
 		}
-		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError, err.Error(), nil)
+		return lsp.TagResolveData(msg.Method, inst.Key, result), nil
+	})
+	if err != nil {
+		return upstreamErrorResponse(callCtx, msg, err)
 	}
 
 	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
-	resp.Result = result
+	resp.Result = lsp.MergeResults(msg.Method, results)
 	return resp, nil
 }
 
+// handleResolve forwards a */resolve request to the server that produced the
+// item, using the tag TagResolveData left in the item's data field.
+func (h *Handler) handleResolve(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	lspName, params, ok := lsp.UntagResolveParams(msg.Params)
+	if !ok {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams,
+			fmt.Sprintf("%s: item was not produced by a known LSP", msg.Method), nil)
+	}
+
+	inst, ok := h.server.pool.Get(lspName)
+	if !ok {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams,
+			fmt.Sprintf("unknown LSP: %s", lspName), nil)
+	}
+
+	result, err := inst.Call(ctx, msg.Method, params)
+	if err != nil {
+		return upstreamErrorResponse(ctx, msg, err)
+	}
+
+	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+	resp.Result = lsp.TagResolveData(msg.Method, lspName, result)
+	return resp, nil
+}
+
+// trackRequest derives a cancellable context for a client request. The
+// returned cancel func must be called once the request has been answered.
+func (h *Handler) trackRequest(ctx context.Context, id jsonrpc.ID) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := id.String()
+
+	h.inflightMu.Lock()
+	h.inflight[key] = cancel
+	h.inflightMu.Unlock()
+
+	return ctx, func() {
+		h.inflightMu.Lock()
+		delete(h.inflight, key)
+		h.inflightMu.Unlock()
+		cancel()
+	}
+}
+
+// handleCancelRequest cancels the context of the referenced client request.
+// The upstream connection turns that into a $/cancelRequest for the server
+// that owns the call.
+func (h *Handler) handleCancelRequest(msg *jsonrpc.Message) {
+	var params struct {
+		ID jsonrpc.ID `json:"id"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params.ID.IsNull() {
+		return
+	}
+
+	h.inflightMu.Lock()
+	cancel, ok := h.inflight[params.ID.String()]
+	h.inflightMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
 func (h *Handler) tryExternalFormat(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, bool) {
 	if h.server.fmtRouter == nil {
 		return nil, false
@@ -322,6 +442,24 @@ func serverNotificationHandler(s *Server, lspName string) jsonrpc.Handler {
 			// Fall through to forward to client
 		}
 
+		// Merge diagnostics with what other LSPs published for the same URI
+		if msg.IsNotification() && msg.Method == lsp.MethodTextDocumentPublishDiagnostics {
+			var params lsp.PublishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err == nil {
+				// Project instances of the same LSP publish for disjoint
+				// roots, so diagnostics are attributed to the LSP name.
+				source := lspName
+				if inst, ok := s.pool.Get(lspName); ok {
+					source = inst.Name
+				}
+				merged := s.diagnostics.Update(source, params)
+				if s.clientConn != nil {
+					s.clientConn.Notify(msg.Method, merged)
+				}
+				return nil, nil
+			}
+		}
+
 		if msg.IsNotification() {
 			if s.clientConn != nil {
 				s.clientConn.Notify(msg.Method, msg.Params)
@@ -409,16 +547,21 @@ func lookupSettingsSection(settings map[string]any, section string) any {
 	return current
 }
 
+// aggregateCapabilities merges lux's defaults with the capabilities of the
+// configured servers, as cached by lux add or reported by running
+// instances. Resolve support is advertised only when one of them supports
+// it.
 func (s *Server) aggregateCapabilities() lsp.ServerCapabilities {
-	var caps []lsp.ServerCapabilities
+	caps := []lsp.ServerCapabilities{defaultCapabilities()}
 
 	cached, err := s.loadCachedCapabilities()
 	if err == nil {
-		caps = cached
+		caps = append(caps, cached...)
 	}
-
-	if len(caps) == 0 {
-		caps = append(caps, defaultCapabilities())
+	for _, inst := range s.pool.Running() {
+		if running, ok := inst.ServerCapabilities(); ok {
+			caps = append(caps, running)
+		}
 	}
 
 	return lsp.MergeCapabilities(caps...)
@@ -468,6 +611,11 @@ type CachedCapabilities struct {
 }
 
 func loadCapabilityCache(name string) (*CachedCapabilities, error) {
-	return nil, fmt.Errorf("not implemented")
+	cached, err := capabilities.LoadCache(name)
+	if err != nil {
+		return nil, err
+	}
+	c := CachedCapabilities(*cached)
+	return &c, nil
 }
 
@@ -42,6 +42,16 @@ func (r *Router) Route(method string, params json.RawMessage) string {
 	return ft.LSP
 }
 
+// RouteAll returns every LSP attached to the filetype the request targets,
+// primary first.
+func (r *Router) RouteAll(method string, params json.RawMessage) []string {
+	ft := r.routeFiletype(method, params)
+	if ft == nil {
+		return nil
+	}
+	return ft.LSPNames()
+}
+
 func (r *Router) routeFiletype(method string, params json.RawMessage) *filetype.Config {
 	var paramsMap map[string]any
 	if err := json.Unmarshal(params, &paramsMap); err != nil {
@@ -94,6 +104,16 @@ func (r *Router) RouteByURI(uri lsp.DocumentURI) string {
 	return ft.LSP
 }
 
+// RouteAllByURI returns every LSP attached to the filetype of uri, primary
+// first.
+func (r *Router) RouteAllByURI(uri lsp.DocumentURI) []string {
+	ft := r.FiletypeByURI(uri)
+	if ft == nil {
+		return nil
+	}
+	return ft.LSPNames()
+}
+
 func (r *Router) RouteByExtension(ext string) string {
 	name := r.matchers.MatchByExtension(ext)
 	if name == "" {
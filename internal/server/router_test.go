@@ -161,3 +161,42 @@ func TestRouter_RouteByLanguageID(t *testing.T) {
 		t.Errorf("RouteByLanguageID(rust) = %q, want empty", got)
 	}
 }
+
+func TestRouter_RouteAll(t *testing.T) {
+	filetypes := []*filetype.Config{
+		{Name: "typescript", Extensions: []string{"ts"}, LSP: "tsserver", LSPs: []string{"eslint", "tailwind"}},
+		{Name: "go", Extensions: []string{"go"}, LSP: "gopls"},
+	}
+
+	router, err := NewRouter(filetypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, _ := json.Marshal(map[string]any{
+		"textDocument": map[string]any{"uri": "file:///src/app.ts"},
+	})
+
+	got := router.RouteAll(lsp.MethodTextDocumentDefinition, params)
+	want := []string{"tsserver", "eslint", "tailwind"}
+	if len(got) != len(want) {
+		t.Fatalf("RouteAll() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("RouteAll()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if got := router.RouteByURI(lsp.DocumentURI("file:///src/app.ts")); got != "tsserver" {
+		t.Errorf("RouteByURI() = %q, want primary %q", got, "tsserver")
+	}
+
+	if got := router.RouteAllByURI(lsp.DocumentURI("file:///src/main.go")); len(got) != 1 || got[0] != "gopls" {
+		t.Errorf("RouteAllByURI(main.go) = %v, want [gopls]", got)
+	}
+
+	if got := router.RouteAllByURI(lsp.DocumentURI("file:///src/readme.md")); got != nil {
+		t.Errorf("RouteAllByURI(readme.md) = %v, want nil", got)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/subprocess"
+	"github.com/amarbel-llc/lux/internal/trace"
 	"github.com/amarbel-llc/lux/internal/warmup"
 )
 
@@ -25,6 +26,9 @@ type Server struct {
 	executor    subprocess.Executor
 	clientConn  *jsonrpc.Conn
 	controlSrv  *control.Server
+	diagnostics *DiagnosticsAggregator
+	documents   *DocumentStore
+	tracer      *trace.Recorder
 	initParams  *lsp.InitializeParams
 	projectRoot string
 	initialized bool
@@ -45,30 +49,26 @@ func New(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("creating router: %w", err)
 	}
 
-	executor := subprocess.NewNixExecutor()
+	executor := NewExecutor()
 
 	s := &Server{
-		cfg:       cfg,
-		router:    router,
-		filetypes: ftConfigs,
-		executor:  executor,
-		done:      make(chan struct{}),
+		cfg:         cfg,
+		router:      router,
+		filetypes:   ftConfigs,
+		executor:    executor,
+		diagnostics: NewDiagnosticsAggregator(),
+		documents:   NewDocumentStore(),
+		done:        make(chan struct{}),
 	}
 
 	s.pool = subprocess.NewPool(executor, func(lspName string) jsonrpc.Handler {
 		return serverNotificationHandler(s, lspName)
 	})
+	s.pool.OnRestart(s.replayDocuments)
+	s.pool.OnStop(s.clearDiagnostics)
 
 	for _, l := range cfg.LSPs {
-		// Convert config.CapabilityOverride to subprocess.CapabilityOverride
-		var capOverrides *subprocess.CapabilityOverride
-		if l.Capabilities != nil {
-			capOverrides = &subprocess.CapabilityOverride{
-				Disable: l.Capabilities.Disable,
-				Enable:  l.Capabilities.Enable,
-			}
-		}
-		s.pool.Register(l.Name, l.Flake, l.Binary, l.Args, l.Env, l.InitOptions, l.Settings, l.SettingsWireKey(), capOverrides, l.ShouldWaitForReady(), l.ReadyTimeoutDuration(), l.ActivityTimeoutDuration())
+		s.pool.Register(LSPSpec(l))
 	}
 
 	fmtCfg, err := config.LoadMergedFormatters()
@@ -101,7 +101,11 @@ func (s *Server) Run(ctx context.Context) error {
 	defer cancel()
 
 	handler := NewHandler(s)
-	s.clientConn = jsonrpc.NewConn(os.Stdin, os.Stdout, handler.Handle)
+	s.clientConn = jsonrpc.NewConn(
+		s.tracer.TapReader(os.Stdin, trace.ClientToLux, trace.ClientPeer),
+		s.tracer.TapWriter(os.Stdout, trace.LuxToClient, trace.ClientPeer),
+		handler.Handle,
+	)
 
 	controlSrv, err := control.NewServer(s.cfg.SocketPath(), s.pool, s.cfg, s.filetypes, s.executor)
 	if err != nil {
@@ -111,6 +115,8 @@ func (s *Server) Run(ctx context.Context) error {
 		go s.controlSrv.Run(ctx)
 	}
 
+	go s.pool.Supervise(ctx)
+
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- s.clientConn.Run(ctx)
@@ -140,6 +146,13 @@ func (s *Server) Close() {
 	close(s.done)
 }
 
+// SetTracer records client and language server traffic to rec. It must be
+// called before Run.
+func (s *Server) SetTracer(rec *trace.Recorder) {
+	s.tracer = rec
+	s.pool.SetTracer(rec)
+}
+
 func (s *Server) Pool() *subprocess.Pool {
 	return s.pool
 }
@@ -153,20 +166,86 @@ func (s *Server) reloadPool(cfg *config.Config) error {
 
 	// Re-register all LSPs with updated config
 	for _, l := range cfg.LSPs {
-		// Convert config.CapabilityOverride to subprocess.CapabilityOverride
-		var capOverrides *subprocess.CapabilityOverride
-		if l.Capabilities != nil {
-			capOverrides = &subprocess.CapabilityOverride{
-				Disable: l.Capabilities.Disable,
-				Enable:  l.Capabilities.Enable,
-			}
-		}
-		s.pool.Register(l.Name, l.Flake, l.Binary, l.Args, l.Env, l.InitOptions, l.Settings, l.SettingsWireKey(), capOverrides, l.ShouldWaitForReady(), l.ReadyTimeoutDuration(), l.ActivityTimeoutDuration())
+		s.pool.Register(LSPSpec(l))
 	}
 
 	return nil
 }
 
+// NewExecutor returns the nix executor lux runs servers and formatters
+// with, backed by the persistent build cache and GC roots in the data
+// directory and pinned to lux.lock when there is one.
+func NewExecutor() *subprocess.NixExecutor {
+	executor := subprocess.NewNixExecutor()
+	executor.SetBuildCache(subprocess.NewBuildCache(config.BuildCachePath()))
+	executor.SetGCRoots(subprocess.NewGCRoots(config.GCRootsDir()))
+
+	lock, err := config.LoadLockFrom(config.LockPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] ignoring lock file: %v\n", err)
+		return executor
+	}
+	executor.SetPins(lockPins(lock))
+	return executor
+}
+
+// lockPins converts the entries of lock to executor pins.
+func lockPins(lock *config.Lock) map[string]subprocess.Pin {
+	pins := make(map[string]subprocess.Pin, len(lock.Entries))
+	for _, e := range lock.Entries {
+		pins[e.Flake] = subprocess.Pin{
+			URL:       e.URL,
+			Revision:  e.Revision,
+			NarHash:   e.NarHash,
+			StorePath: e.StorePath,
+		}
+	}
+	return pins
+}
+
+// LSPSpec converts an LSP config entry into the spec the pool runs it with.
+func LSPSpec(l config.LSP) subprocess.LSPSpec {
+	var capOverrides *subprocess.CapabilityOverride
+	if l.Capabilities != nil {
+		capOverrides = &subprocess.CapabilityOverride{
+			Disable: l.Capabilities.Disable,
+			Enable:  l.Capabilities.Enable,
+		}
+	}
+
+	return subprocess.LSPSpec{
+		Name:            l.Name,
+		Flake:           l.Flake,
+		Command:         l.Command,
+		Binary:          l.Binary,
+		Args:            l.Args,
+		Env:             l.Env,
+		RuntimeDeps:     l.RuntimeDeps,
+		InitOptions:     l.InitOptions,
+		Settings:        l.Settings,
+		SettingsKey:     l.SettingsWireKey(),
+		CapOverrides:    capOverrides,
+		WaitForReady:    l.ShouldWaitForReady(),
+		ReadyTimeout:    l.ReadyTimeoutDuration(),
+		ActivityTimeout: l.ActivityTimeoutDuration(),
+		PerProject:      l.IsProjectScoped(),
+		DevShell:        l.UsesDevShell(),
+		Direnv:          l.UsesDirenv(),
+		IdleTimeout:     l.IdleTimeoutDuration(),
+		MaxMemory:       l.MaxMemoryBytes(),
+		HangTimeout:     l.HangTimeoutDuration(),
+		ProbeInterval:   l.ProbeIntervalDuration(),
+		PathMap:         l.PathMap,
+		Transport:       subprocess.Transport(l.Transport),
+		Address:         l.Address,
+		Limits: subprocess.Limits{
+			Nice:         l.Nice,
+			AddressSpace: l.MaxAddressSpaceBytes(),
+			OpenFiles:    uint64(l.MaxOpenFiles),
+		},
+	}
+}
+
 func (s *Server) FormatterRouter() *formatter.Router {
 	return s.fmtRouter
 }
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// isWorkspaceRequest reports whether method is a workspace-wide request that
+// carries no document URI and therefore cannot be routed by filetype.
+func isWorkspaceRequest(method string) bool {
+	switch method {
+	case lsp.MethodWorkspaceSymbol, lsp.MethodWorkspaceExecuteCommand, lsp.MethodWorkspaceDiagnostic:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleWorkspaceRequest answers URI-less workspace requests from the running
+// LSPs. workspace/symbol and workspace/diagnostic fan out to every server
+// that supports them and merge the results; workspace/executeCommand goes to
+// the server that registered the command.
+func (h *Handler) handleWorkspaceRequest(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+	var targets []*subprocess.LSPInstance
+
+	if msg.Method == lsp.MethodWorkspaceExecuteCommand {
+		var params struct {
+			Command string `json:"command"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InvalidParams, "invalid params", nil)
+		}
+
+		for _, inst := range h.server.pool.Running() {
+			if inst.SupportsCommand(params.Command) {
+				targets = append(targets, inst)
+				break
+			}
+		}
+		if len(targets) == 0 {
+			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound,
+				fmt.Sprintf("no running LSP provides command %s", params.Command), nil)
+		}
+	} else {
+		for _, inst := range h.server.pool.Running() {
+			if inst.SupportsMethod(msg.Method) {
+				targets = append(targets, inst)
+			}
+		}
+		if len(targets) == 0 {
+			return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.MethodNotFound,
+				fmt.Sprintf("no running LSP supports %s", msg.Method), nil)
+		}
+	}
+
+	results, err := subprocess.CallAll(ctx, targets, func(ctx context.Context, inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		return inst.Call(ctx, msg.Method, msg.Params)
+	})
+	if err != nil {
+		return upstreamErrorResponse(ctx, msg, err)
+	}
+
+	resp, _ := jsonrpc.NewResponse(*msg.ID, nil)
+	resp.Result = lsp.MergeResults(msg.Method, results)
+	return resp, nil
+}
+
+// upstreamErrorResponse converts an error from an upstream call into the
+// response sent back to the client.
+func upstreamErrorResponse(ctx context.Context, msg *jsonrpc.Message, err error) (*jsonrpc.Message, error) {
+	if ctx.Err() != nil {
+		return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.RequestCancelled, "request cancelled", nil)
+	}
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		return jsonrpc.NewErrorResponse(*msg.ID, rpcErr.Code, rpcErr.Message, rpcErr.Data)
+	}
+	return jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError, err.Error(), nil)
+}
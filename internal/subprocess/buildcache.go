@@ -0,0 +1,207 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CacheEntry records the outcome of one flake build. Entries are keyed by
+// the flake reference, the binary spec and the flake's locked narHash, so a
+// moved input produces a new entry rather than reusing a stale one.
+type CacheEntry struct {
+	Flake     string    `json:"flake"`
+	Binary    string    `json:"binary,omitempty"`
+	NarHash   string    `json:"nar_hash"`
+	Revision  string    `json:"revision,omitempty"`
+	StorePath string    `json:"store_path"`
+	BuiltAt   time.Time `json:"built_at"`
+	UsedAt    time.Time `json:"used_at,omitempty"`
+}
+
+func (e CacheEntry) key() string {
+	return e.Flake + "::" + e.Binary + "::" + e.NarHash
+}
+
+// BuildCache persists resolved store paths across lux runs as a JSON file.
+// Writes merge with what is on disk so concurrent lux processes do not
+// drop each other's entries.
+type BuildCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+	loaded  bool
+}
+
+func NewBuildCache(path string) *BuildCache {
+	return &BuildCache{path: path, entries: make(map[string]CacheEntry)}
+}
+
+func (c *BuildCache) Path() string {
+	return c.path
+}
+
+// Lookup returns the entry for flake, binary and narHash if its store path
+// still exists.
+func (c *BuildCache) Lookup(flake, binary, narHash string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadLocked()
+
+	entry, ok := c.entries[CacheEntry{Flake: flake, Binary: binary, NarHash: narHash}.key()]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	if _, err := os.Stat(entry.StorePath); err != nil {
+		return CacheEntry{}, false
+	}
+	return entry, true
+}
+
+// Put records entry, replacing any entry with the same key.
+func (c *BuildCache) Put(entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updateLocked(func(entries map[string]CacheEntry) {
+		entries[entry.key()] = entry
+	})
+}
+
+// MarkUsed notes that a server was started from the entry.
+func (c *BuildCache) MarkUsed(flake, binary, narHash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := CacheEntry{Flake: flake, Binary: binary, NarHash: narHash}.key()
+	return c.updateLocked(func(entries map[string]CacheEntry) {
+		if entry, ok := entries[key]; ok {
+			entry.UsedAt = time.Now()
+			entries[key] = entry
+		}
+	})
+}
+
+// LastUsed returns when any build of flake and binary last started a
+// server.
+func (c *BuildCache) LastUsed(flake, binary string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadLocked()
+
+	var last time.Time
+	for _, entry := range c.entries {
+		if entry.Flake == flake && entry.Binary == binary && entry.UsedAt.After(last) {
+			last = entry.UsedAt
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// Entries returns all entries sorted by flake and binary, newest first.
+func (c *BuildCache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reloadLocked()
+
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Flake != entries[j].Flake {
+			return entries[i].Flake < entries[j].Flake
+		}
+		if entries[i].Binary != entries[j].Binary {
+			return entries[i].Binary < entries[j].Binary
+		}
+		return entries[i].BuiltAt.After(entries[j].BuiltAt)
+	})
+	return entries
+}
+
+// Clear removes every entry, or only those for flake when it is non-empty.
+func (c *BuildCache) Clear(flake string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updateLocked(func(entries map[string]CacheEntry) {
+		for key, entry := range entries {
+			if flake == "" || entry.Flake == flake {
+				delete(entries, key)
+			}
+		}
+	})
+}
+
+func (c *BuildCache) loadLocked() {
+	if !c.loaded {
+		c.reloadLocked()
+	}
+}
+
+func (c *BuildCache) reloadLocked() {
+	c.loaded = true
+	entries := make(map[string]CacheEntry)
+
+	data, err := os.ReadFile(c.path)
+	if err == nil {
+		var list []CacheEntry
+		if err := json.Unmarshal(data, &list); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] ignoring corrupt build cache %s: %v\n", c.path, err)
+		}
+		for _, entry := range list {
+			entries[entry.key()] = entry
+		}
+	}
+	c.entries = entries
+}
+
+func (c *BuildCache) updateLocked(fn func(map[string]CacheEntry)) error {
+	c.reloadLocked()
+	fn(c.entries)
+
+	list := make([]CacheEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].key() < list[j].key() })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".build-cache-*")
+	if err != nil {
+		return fmt.Errorf("writing build cache: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing build cache: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing build cache: %w", err)
+	}
+	return nil
+}
+
+type prebuildKey struct{}
+
+// PrebuildContext marks builds made ahead of need, so they do not count as
+// a server being used.
+func PrebuildContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, prebuildKey{}, true)
+}
+
+func isPrebuild(ctx context.Context) bool {
+	v, _ := ctx.Value(prebuildKey{}).(bool)
+	return v
+}
@@ -0,0 +1,120 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildCache_PersistsAndChecksExistence(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "store", "abc-gopls")
+	os.MkdirAll(storePath, 0755)
+	path := filepath.Join(dir, "build-cache.json")
+
+	cache := NewBuildCache(path)
+	if err := cache.Put(CacheEntry{Flake: "nixpkgs#gopls", NarHash: "sha256-a", StorePath: storePath, BuiltAt: time.Now()}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	reopened := NewBuildCache(path)
+	if _, ok := reopened.Lookup("nixpkgs#gopls", "", "sha256-a"); !ok {
+		t.Error("expected entry to persist")
+	}
+	if _, ok := reopened.Lookup("nixpkgs#gopls", "", "sha256-b"); ok {
+		t.Error("expected miss for a different narHash")
+	}
+	if _, ok := reopened.Lookup("nixpkgs#gopls", "gopls", "sha256-a"); ok {
+		t.Error("expected miss for a different binary spec")
+	}
+
+	os.RemoveAll(storePath)
+	if _, ok := reopened.Lookup("nixpkgs#gopls", "", "sha256-a"); ok {
+		t.Error("expected miss once the store path is gone")
+	}
+}
+
+func TestBuildCache_UsageAndClear(t *testing.T) {
+	cache := NewBuildCache(filepath.Join(t.TempDir(), "build-cache.json"))
+	cache.Put(CacheEntry{Flake: "nixpkgs#gopls", NarHash: "sha256-a", StorePath: "/nix/store/a"})
+	cache.Put(CacheEntry{Flake: "nixpkgs#nil", NarHash: "sha256-a", StorePath: "/nix/store/b"})
+
+	if _, ok := cache.LastUsed("nixpkgs#gopls", ""); ok {
+		t.Error("expected no usage before MarkUsed")
+	}
+	cache.MarkUsed("nixpkgs#gopls", "", "sha256-a")
+	if last, ok := cache.LastUsed("nixpkgs#gopls", ""); !ok || time.Since(last) > time.Minute {
+		t.Errorf("LastUsed = %v, %v", last, ok)
+	}
+
+	cache.Clear("nixpkgs#gopls")
+	if entries := cache.Entries(); len(entries) != 1 || entries[0].Flake != "nixpkgs#nil" {
+		t.Errorf("unexpected entries after Clear: %+v", entries)
+	}
+	cache.Clear("")
+	if entries := cache.Entries(); len(entries) != 0 {
+		t.Errorf("expected empty cache, got %+v", entries)
+	}
+}
+
+func TestNixExecutor_ReusesPersistentBuilds(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "abc-gopls")
+	os.MkdirAll(filepath.Join(storePath, "bin"), 0755)
+	os.WriteFile(filepath.Join(storePath, "bin", "gopls"), []byte("#!/bin/sh\n"), 0755)
+	cachePath := filepath.Join(dir, "build-cache.json")
+
+	narHash := "sha256-a"
+	builds := 0
+	newExecutor := func() *NixExecutor {
+		e := NewNixExecutor()
+		e.SetBuildCache(NewBuildCache(cachePath))
+		e.build = func(ctx context.Context, flake string) (string, error) {
+			builds++
+			return storePath, nil
+		}
+		e.lockFlake = func(ctx context.Context, ref string) (flakeLock, error) {
+			if ref != "nixpkgs" {
+				t.Errorf("resolved %q, want the flake ref without its attribute", ref)
+			}
+			return flakeLock{NarHash: narHash}, nil
+		}
+		return e
+	}
+
+	if _, err := newExecutor().Build(PrebuildContext(context.Background()), "nixpkgs#gopls", ""); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if _, ok := NewBuildCache(cachePath).LastUsed("nixpkgs#gopls", ""); ok {
+		t.Error("a prebuild should not count as use")
+	}
+
+	// A fresh process reuses the stored path without building.
+	path, err := newExecutor().Build(context.Background(), "nixpkgs#gopls", "")
+	if err != nil || path != filepath.Join(storePath, "bin", "gopls") {
+		t.Fatalf("Build = %q, %v", path, err)
+	}
+	if builds != 1 {
+		t.Errorf("expected 1 build, got %d", builds)
+	}
+	if _, ok := NewBuildCache(cachePath).LastUsed("nixpkgs#gopls", ""); !ok {
+		t.Error("expected the start to be recorded as use")
+	}
+
+	// Runtime dependencies count as use too, so lux gc keeps their roots.
+	if _, err := newExecutor().BuildStorePath(context.Background(), "nixpkgs#go"); err != nil {
+		t.Fatalf("BuildStorePath: %v", err)
+	}
+	if _, ok := NewBuildCache(cachePath).LastUsed("nixpkgs#go", ""); !ok {
+		t.Error("expected the runtime dependency to be recorded as use")
+	}
+
+	// Moving the flake's lock invalidates the entry.
+	narHash = "sha256-b"
+	newExecutor().Build(context.Background(), "nixpkgs#gopls", "")
+	if builds != 3 {
+		t.Errorf("expected a rebuild after the lock changed, got %d builds", builds)
+	}
+}
@@ -0,0 +1,56 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ExecutorKind selects how a server's binary is obtained. The pool keeps one
+// Executor per kind.
+type ExecutorKind string
+
+const (
+	// ExecutorNix builds a flake reference with nix.
+	ExecutorNix ExecutorKind = "nix"
+	// ExecutorCommand runs an already installed binary, given as an absolute
+	// path or a name looked up on PATH.
+	ExecutorCommand ExecutorKind = "command"
+)
+
+// CommandExecutor runs binaries installed outside of nix. Build only
+// resolves the command; there is nothing to build.
+type CommandExecutor struct{}
+
+func NewCommandExecutor() *CommandExecutor {
+	return &CommandExecutor{}
+}
+
+func (e *CommandExecutor) Build(ctx context.Context, command, binarySpec string) (string, error) {
+	if !filepath.IsAbs(command) {
+		path, err := exec.LookPath(command)
+		if err != nil {
+			return "", fmt.Errorf("command %q not found on PATH: %w", command, err)
+		}
+		return path, nil
+	}
+
+	info, err := os.Stat(command)
+	if err != nil {
+		return "", fmt.Errorf("command %q not found: %w", command, err)
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return "", fmt.Errorf("command %q is not executable", command)
+	}
+	return command, nil
+}
+
+func (e *CommandExecutor) BuildStorePath(ctx context.Context, flake string) (string, error) {
+	return "", fmt.Errorf("cannot build %s: the command executor does not use nix", flake)
+}
+
+func (e *CommandExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	return startProcess(ctx, path, args, env, workDir)
+}
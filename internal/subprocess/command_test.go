@@ -0,0 +1,62 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+)
+
+func TestCommandExecutor_Build(t *testing.T) {
+	dir := t.TempDir()
+	execPath := filepath.Join(dir, "fake-ls")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("writing executable: %v", err)
+	}
+	plain := filepath.Join(dir, "not-exec")
+	if err := os.WriteFile(plain, nil, 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	t.Setenv("PATH", dir)
+
+	executor := NewCommandExecutor()
+
+	if got, err := executor.Build(context.Background(), "fake-ls", ""); err != nil || got != execPath {
+		t.Errorf("Build(name) = %q, %v", got, err)
+	}
+	if got, err := executor.Build(context.Background(), execPath, ""); err != nil || got != execPath {
+		t.Errorf("Build(absolute) = %q, %v", got, err)
+	}
+	if _, err := executor.Build(context.Background(), "missing-ls", ""); err == nil {
+		t.Error("expected error for command not on PATH")
+	}
+	if _, err := executor.Build(context.Background(), plain, ""); err == nil {
+		t.Error("expected error for non-executable file")
+	}
+}
+
+func TestPool_CommandSpecUsesCommandExecutor(t *testing.T) {
+	nix := newFakeExecutor()
+	command := newFakeExecutor()
+	pool := NewPool(nix, func(string) jsonrpc.Handler { return nil })
+	pool.SetExecutor(ExecutorCommand, command)
+	pool.Register(LSPSpec{Name: "gopls", Command: "gopls"})
+
+	if _, err := pool.GetOrStart(context.Background(), "gopls", nil); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	defer pool.StopAll()
+
+	select {
+	case <-command.executed:
+	default:
+		t.Error("expected the command executor to start the server")
+	}
+	select {
+	case <-nix.executed:
+		t.Error("nix executor should not be used for a command server")
+	default:
+	}
+}
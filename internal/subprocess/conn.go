@@ -0,0 +1,256 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// Conn is the JSON-RPC connection to a language server. It behaves like
+// jsonrpc.Conn but keeps track of which request ID belongs to each call so a
+// cancelled call can be cancelled on the server with $/cancelRequest, and so
+// in-flight calls fail instead of hanging when the connection goes away.
+type Conn struct {
+	stream   *jsonrpc.Stream
+	handler  jsonrpc.Handler
+	rewriter Rewriter
+	pending  map[string]*pendingCall
+	mu       sync.Mutex
+	nextID   atomic.Int64
+	closed   atomic.Bool
+	err      error
+}
+
+// pendingCall is a request awaiting its response.
+type pendingCall struct {
+	ch     chan *jsonrpc.Message
+	method string
+	sent   time.Time
+}
+
+// Rewriter transforms the params and results of every message crossing a
+// Conn, for servers that need a different view of the payloads than lux
+// and its clients, such as paths inside a sandbox.
+type Rewriter interface {
+	// ToServer rewrites a payload lux is sending to the server.
+	ToServer(json.RawMessage) json.RawMessage
+	// FromServer rewrites a payload the server sent to lux.
+	FromServer(json.RawMessage) json.RawMessage
+}
+
+func NewConn(r io.Reader, w io.Writer, handler jsonrpc.Handler) *Conn {
+	return &Conn{
+		stream:  jsonrpc.NewStream(r, w),
+		handler: handler,
+		pending: make(map[string]*pendingCall),
+	}
+}
+
+// SetRewriter installs rw for all traffic on the connection. It must be
+// called before Run.
+func (c *Conn) SetRewriter(rw Rewriter) {
+	c.rewriter = rw
+}
+
+func (c *Conn) toServer(msg *jsonrpc.Message) {
+	if c.rewriter == nil {
+		return
+	}
+	if len(msg.Params) > 0 {
+		msg.Params = c.rewriter.ToServer(msg.Params)
+	}
+	if len(msg.Result) > 0 {
+		msg.Result = c.rewriter.ToServer(msg.Result)
+	}
+}
+
+func (c *Conn) fromServer(msg *jsonrpc.Message) {
+	if c.rewriter == nil {
+		return
+	}
+	if len(msg.Params) > 0 {
+		msg.Params = c.rewriter.FromServer(msg.Params)
+	}
+	if len(msg.Result) > 0 {
+		msg.Result = c.rewriter.FromServer(msg.Result)
+	}
+}
+
+func (c *Conn) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for {
+		msg, err := c.stream.Read()
+		if err != nil {
+			if c.closed.Load() {
+				c.failPending(nil)
+				return nil
+			}
+			return c.failPending(fmt.Errorf("reading message: %w", err))
+		}
+
+		c.fromServer(msg)
+
+		if msg.IsResponse() {
+			c.handleResponse(msg)
+			continue
+		}
+
+		go c.handleMessage(ctx, msg)
+	}
+}
+
+func (c *Conn) handleResponse(msg *jsonrpc.Message) {
+	c.mu.Lock()
+	call, ok := c.pending[msg.ID.String()]
+	if ok {
+		delete(c.pending, msg.ID.String())
+	}
+	c.mu.Unlock()
+
+	if ok {
+		call.ch <- msg
+		close(call.ch)
+	}
+}
+
+func (c *Conn) handleMessage(ctx context.Context, msg *jsonrpc.Message) {
+	if c.handler == nil {
+		return
+	}
+
+	resp, err := c.handler(ctx, msg)
+	if err != nil {
+		if msg.IsRequest() {
+			errResp, _ := jsonrpc.NewErrorResponse(*msg.ID, jsonrpc.InternalError, err.Error(), nil)
+			c.stream.Write(errResp)
+		}
+		return
+	}
+
+	if resp != nil {
+		c.toServer(resp)
+		c.stream.Write(resp)
+	}
+}
+
+// failPending wakes every in-flight call once the connection is gone. The
+// first failure recorded is what calls report; it is returned.
+func (c *Conn) failPending(err error) error {
+	c.mu.Lock()
+	if c.err == nil {
+		if err == nil {
+			err = fmt.Errorf("connection closed")
+		}
+		c.err = err
+	}
+	err = c.err
+	pending := c.pending
+	c.pending = make(map[string]*pendingCall)
+	c.mu.Unlock()
+
+	for _, call := range pending {
+		close(call.ch)
+	}
+	return err
+}
+
+// Fail fails every in-flight call, and every later one, with err. It is
+// used on servers that stopped answering without closing the connection.
+func (c *Conn) Fail(err error) {
+	c.failPending(err)
+}
+
+// Oldest returns the method and age of the call that has waited longest for
+// its response.
+func (c *Conn) Oldest() (method string, age time.Duration, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var oldest *pendingCall
+	for _, call := range c.pending {
+		if oldest == nil || call.sent.Before(oldest.sent) {
+			oldest = call
+		}
+	}
+	if oldest == nil {
+		return "", 0, false
+	}
+	return oldest.method, time.Since(oldest.sent), true
+}
+
+// Call sends a request and waits for its response. If ctx is cancelled first
+// the server is sent $/cancelRequest for the request and ctx.Err() is
+// returned.
+func (c *Conn) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := jsonrpc.NewNumberID(c.nextID.Add(1))
+
+	msg, err := jsonrpc.NewRequest(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	c.toServer(msg)
+
+	ch := make(chan *jsonrpc.Message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.pending[id.String()] = &pendingCall{ch: ch, method: method, sent: time.Now()}
+	c.mu.Unlock()
+
+	if err := c.stream.Write(msg); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id.String())
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		_, inFlight := c.pending[id.String()]
+		delete(c.pending, id.String())
+		c.mu.Unlock()
+
+		if inFlight {
+			c.Notify(lsp.MethodCancelRequest, map[string]any{"id": id})
+		}
+		return nil, ctx.Err()
+	case resp, ok := <-ch:
+		if !ok {
+			c.mu.Lock()
+			err := c.err
+			c.mu.Unlock()
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	}
+}
+
+func (c *Conn) Notify(method string, params any) error {
+	msg, err := jsonrpc.NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+	c.toServer(msg)
+	return c.stream.Write(msg)
+}
+
+func (c *Conn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,155 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// newTestConn wires a Conn to an in-memory fake server and returns the
+// server's end of the stream.
+func newTestConn(t *testing.T) (*Conn, *jsonrpc.Stream, func()) {
+	t.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	conn := NewConn(clientR, clientW, nil)
+	server := jsonrpc.NewStream(serverR, serverW)
+
+	go conn.Run(context.Background())
+
+	return conn, server, func() {
+		serverW.Close()
+		clientW.Close()
+	}
+}
+
+func TestConn_CallResponse(t *testing.T) {
+	conn, server, closeFn := newTestConn(t)
+	defer closeFn()
+
+	go func() {
+		req, err := server.Read()
+		if err != nil {
+			return
+		}
+		resp, _ := jsonrpc.NewResponse(*req.ID, map[string]string{"ok": "yes"})
+		server.Write(resp)
+	}()
+
+	result, err := conn.Call(context.Background(), lsp.MethodTextDocumentHover, nil)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if string(result) != `{"ok":"yes"}` {
+		t.Errorf("result = %s", result)
+	}
+}
+
+func TestConn_CancelSendsCancelRequest(t *testing.T) {
+	conn, server, closeFn := newTestConn(t)
+	defer closeFn()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := conn.Call(ctx, lsp.MethodTextDocumentReferences, nil)
+		errCh <- err
+	}()
+
+	req, err := server.Read()
+	if err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+
+	cancel()
+
+	note, err := server.Read()
+	if err != nil {
+		t.Fatalf("reading cancel: %v", err)
+	}
+
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("Call error = %v, want context.Canceled", err)
+	}
+
+	if note.Method != lsp.MethodCancelRequest {
+		t.Fatalf("method = %q, want %q", note.Method, lsp.MethodCancelRequest)
+	}
+
+	var params struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(note.Params, &params); err != nil {
+		t.Fatalf("parsing cancel params: %v", err)
+	}
+	if string(params.ID) != req.ID.String() {
+		t.Errorf("cancelled id = %s, want %s", params.ID, req.ID.String())
+	}
+}
+
+func TestConn_PendingFailsOnClose(t *testing.T) {
+	conn, server, closeFn := newTestConn(t)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := conn.Call(context.Background(), lsp.MethodWorkspaceSymbol, nil)
+		errCh <- err
+	}()
+
+	if _, err := server.Read(); err != nil {
+		t.Fatalf("reading request: %v", err)
+	}
+	closeFn()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("expected error after connection closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending call did not fail after connection closed")
+	}
+}
+
+func TestConn_RewriterAppliesBothWays(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	defer serverW.Close()
+	defer clientW.Close()
+
+	conn := NewConn(clientR, clientW, nil)
+	conn.SetRewriter(lsp.NewPathMap(map[string]string{"/host": "/sandbox"}))
+	server := jsonrpc.NewStream(serverR, serverW)
+	go conn.Run(context.Background())
+
+	seen := make(chan string, 1)
+	go func() {
+		req, err := server.Read()
+		if err != nil {
+			return
+		}
+		seen <- string(req.Params)
+		resp, _ := jsonrpc.NewResponse(*req.ID, req.Params)
+		server.Write(resp)
+	}()
+
+	result, err := conn.Call(context.Background(), lsp.MethodTextDocumentHover,
+		map[string]string{"uri": "file:///host/a.go"})
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got := <-seen; got != `{"uri":"file:///sandbox/a.go"}` {
+		t.Errorf("server saw %s", got)
+	}
+	if string(result) != `{"uri":"file:///host/a.go"}` {
+		t.Errorf("result = %s", result)
+	}
+}
@@ -0,0 +1,198 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// ignoredDevShellVars are variables of the build sandbox that make no sense
+// in a server process; nix develop skips the same ones.
+var ignoredDevShellVars = map[string]bool{
+	"BASHOPTS":           true,
+	"HOME":               true,
+	"NIX_BUILD_TOP":      true,
+	"NIX_ENFORCE_PURITY": true,
+	"NIX_LOG_FD":         true,
+	"NIX_REMOTE":         true,
+	"NIX_SSL_CERT_FILE":  true,
+	"PPID":               true,
+	"SHELL":              true,
+	"SHELLOPTS":          true,
+	"SSL_CERT_FILE":      true,
+	"TEMP":               true,
+	"TEMPDIR":            true,
+	"TERM":               true,
+	"TMP":                true,
+	"TMPDIR":             true,
+	"TZ":                 true,
+	"UID":                true,
+}
+
+// DevShell evaluates the default devShell of project flakes and caches the
+// resulting environment until the flake's flake.lock changes.
+type DevShell struct {
+	mu      sync.Mutex
+	entries map[string]*devShellEntry // flake directory -> entry
+	eval    func(ctx context.Context, flakeDir string) ([]byte, error)
+}
+
+type devShellEntry struct {
+	mu       sync.Mutex
+	lockHash string
+	env      map[string]string
+}
+
+func NewDevShell() *DevShell {
+	return &DevShell{
+		entries: make(map[string]*devShellEntry),
+		eval:    printDevEnv,
+	}
+}
+
+func printDevEnv(ctx context.Context, flakeDir string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "nix", "print-dev-env", "--json", flakeDir)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("nix print-dev-env failed: %w\n%s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// Env returns the exported variables of the devShell of the flake in dir or
+// the nearest directory above it.
+func (d *DevShell) Env(ctx context.Context, dir string) (map[string]string, error) {
+	flakeDir, err := findFlakeDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	lockHash := hashFile(filepath.Join(flakeDir, "flake.lock"))
+
+	d.mu.Lock()
+	entry, ok := d.entries[flakeDir]
+	if !ok {
+		entry = &devShellEntry{}
+		d.entries[flakeDir] = entry
+	}
+	d.mu.Unlock()
+
+	// Held across the evaluation so concurrent starts in one project share it.
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.env != nil && entry.lockHash == lockHash {
+		return entry.env, nil
+	}
+
+	out, err := d.eval(ctx, flakeDir)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating devShell of %s: %w", flakeDir, err)
+	}
+	env, err := parseDevEnv(out)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating devShell of %s: %w", flakeDir, err)
+	}
+
+	entry.env = env
+	entry.lockHash = lockHash
+	return env, nil
+}
+
+func findFlakeDir(dir string) (string, error) {
+	if d, ok := findUp(dir, "flake.nix"); ok {
+		return d, nil
+	}
+	return "", fmt.Errorf("no flake.nix found at or above %s", dir)
+}
+
+// findUp returns the nearest directory at or above dir containing name.
+func findUp(dir, name string) (string, bool) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, name)); err == nil {
+			return d, true
+		}
+		if d == filepath.Dir(d) {
+			return "", false
+		}
+	}
+}
+
+// hashFile returns a digest of path's contents, or "" if it cannot be read,
+// so a flake without a lock file is still cached.
+func hashFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func parseDevEnv(data []byte) (map[string]string, error) {
+	var parsed struct {
+		Variables map[string]struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"variables"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("parsing print-dev-env output: %w", err)
+	}
+
+	env := make(map[string]string)
+	for name, v := range parsed.Variables {
+		if v.Type != "exported" || ignoredDevShellVars[name] {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(v.Value, &value); err != nil {
+			continue
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// DevShellEnv evaluates the devShell environment for dir through executor,
+// which must be able to evaluate flakes.
+func DevShellEnv(ctx context.Context, executor Executor, dir string) (map[string]string, error) {
+	ds, ok := executor.(interface {
+		DevShellEnv(ctx context.Context, dir string) (map[string]string, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("devshell environments need the nix executor")
+	}
+	return ds.DevShellEnv(ctx, dir)
+}
+
+// WithDevShell layers env over a devShell environment. Configured variables
+// win, except PATH: the devShell's PATH comes first, followed by the
+// configured PATH or, failing that, lux's own.
+func WithDevShell(shell, env map[string]string) map[string]string {
+	merged := maps.Clone(shell)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	shellPath, hasShellPath := merged["PATH"]
+	maps.Copy(merged, env)
+
+	if hasShellPath {
+		path, ok := env["PATH"]
+		if !ok {
+			path = os.Getenv("PATH")
+		}
+		merged["PATH"] = shellPath + ":" + path
+	}
+	return merged
+}
@@ -0,0 +1,93 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const devEnvJSON = `{
+  "variables": {
+    "PATH": {"type": "exported", "value": "/nix/store/go/bin"},
+    "GOROOT": {"type": "exported", "value": "/nix/store/go/share/go"},
+    "HOME": {"type": "exported", "value": "/homeless-shelter"},
+    "shellHook": {"type": "var", "value": "echo hi"},
+    "outputs": {"type": "array", "value": ["out"]}
+  }
+}`
+
+func TestDevShell_CachesUntilLockChanges(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "flake.nix"), []byte("{}"), 0644)
+	lock := filepath.Join(root, "flake.lock")
+	os.WriteFile(lock, []byte("v1"), 0644)
+	sub := filepath.Join(root, "cmd", "app")
+	os.MkdirAll(sub, 0755)
+
+	evals := 0
+	ds := NewDevShell()
+	ds.eval = func(ctx context.Context, flakeDir string) ([]byte, error) {
+		evals++
+		if flakeDir != root {
+			t.Errorf("evaluated %s, want %s", flakeDir, root)
+		}
+		return []byte(devEnvJSON), nil
+	}
+
+	env, err := ds.Env(context.Background(), sub)
+	if err != nil {
+		t.Fatalf("Env: %v", err)
+	}
+	if env["GOROOT"] != "/nix/store/go/share/go" || env["PATH"] != "/nix/store/go/bin" {
+		t.Errorf("unexpected env: %v", env)
+	}
+	for _, name := range []string{"HOME", "shellHook", "outputs"} {
+		if _, ok := env[name]; ok {
+			t.Errorf("%s should not be exported to the server", name)
+		}
+	}
+
+	ds.Env(context.Background(), root)
+	if evals != 1 {
+		t.Errorf("expected cached result, got %d evaluations", evals)
+	}
+
+	os.WriteFile(lock, []byte("v2"), 0644)
+	ds.Env(context.Background(), root)
+	if evals != 2 {
+		t.Errorf("expected re-evaluation after flake.lock changed, got %d evaluations", evals)
+	}
+}
+
+func TestDevShell_NoFlake(t *testing.T) {
+	ds := NewDevShell()
+	ds.eval = func(ctx context.Context, flakeDir string) ([]byte, error) {
+		t.Fatal("should not evaluate without a flake")
+		return nil, nil
+	}
+	if _, err := ds.Env(context.Background(), t.TempDir()); err == nil {
+		t.Error("expected error when no flake.nix exists")
+	}
+}
+
+func TestWithDevShell(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	shell := map[string]string{"PATH": "/nix/store/go/bin", "GOROOT": "/nix/store/go/share/go", "CGO_ENABLED": "1"}
+
+	env := WithDevShell(shell, map[string]string{"CGO_ENABLED": "0"})
+	if env["CGO_ENABLED"] != "0" || env["GOROOT"] != "/nix/store/go/share/go" {
+		t.Errorf("configured env should override the devShell: %v", env)
+	}
+	if env["PATH"] != "/nix/store/go/bin:/usr/bin" {
+		t.Errorf("PATH = %q", env["PATH"])
+	}
+
+	env = WithDevShell(shell, map[string]string{"PATH": "/opt/bin"})
+	if env["PATH"] != "/nix/store/go/bin:/opt/bin" {
+		t.Errorf("PATH = %q", env["PATH"])
+	}
+	if shell["PATH"] != "/nix/store/go/bin" {
+		t.Error("devShell env was modified")
+	}
+}
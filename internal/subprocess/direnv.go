@@ -0,0 +1,152 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DirenvState describes whether direnv applies to a project.
+type DirenvState string
+
+const (
+	DirenvNone    DirenvState = "none"
+	DirenvAllowed DirenvState = "allowed"
+	DirenvBlocked DirenvState = "blocked"
+)
+
+var errDirenvBlocked = errors.New(".envrc is blocked")
+
+// Direnv loads project environments with direnv export json and caches them
+// until the governing .envrc changes.
+type Direnv struct {
+	mu      sync.Mutex
+	entries map[string]*direnvEntry // .envrc directory -> entry
+	export  func(ctx context.Context, dir string) ([]byte, error)
+}
+
+type direnvEntry struct {
+	mu     sync.Mutex
+	rcHash string
+	env    map[string]string
+}
+
+func NewDirenv() *Direnv {
+	return &Direnv{
+		entries: make(map[string]*direnvEntry),
+		export:  direnvExport,
+	}
+}
+
+func direnvExport(ctx context.Context, dir string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "direnv", "export", "json")
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if msg := stderr.String(); strings.Contains(msg, "is blocked") || strings.Contains(msg, "not allowed") {
+		return nil, errDirenvBlocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("direnv export failed: %w\n%s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// DirenvEnv loads the direnv environment for dir through executor's cache.
+// Executors without one load it afresh every time.
+func DirenvEnv(ctx context.Context, executor Executor, dir string) (map[string]string, DirenvState, error) {
+	d, ok := executor.(interface {
+		DirenvEnv(ctx context.Context, dir string) (map[string]string, DirenvState, error)
+	})
+	if !ok {
+		return NewDirenv().Env(ctx, dir)
+	}
+	return d.DirenvEnv(ctx, dir)
+}
+
+// Env returns the variables direnv sets for dir. Without an .envrc at or
+// above dir the state is DirenvNone; a blocked .envrc yields DirenvBlocked
+// and no variables. Blocked results are not cached so a later direnv allow
+// takes effect on the next start.
+func (d *Direnv) Env(ctx context.Context, dir string) (map[string]string, DirenvState, error) {
+	rcDir, ok := findUp(dir, ".envrc")
+	if !ok {
+		return nil, DirenvNone, nil
+	}
+	rcHash := hashFile(filepath.Join(rcDir, ".envrc"))
+
+	d.mu.Lock()
+	entry, ok := d.entries[rcDir]
+	if !ok {
+		entry = &direnvEntry{}
+		d.entries[rcDir] = entry
+	}
+	d.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.env != nil && entry.rcHash == rcHash {
+		return entry.env, DirenvAllowed, nil
+	}
+
+	out, err := d.export(ctx, rcDir)
+	if errors.Is(err, errDirenvBlocked) {
+		entry.env = nil
+		return nil, DirenvBlocked, nil
+	}
+	if err != nil {
+		return nil, DirenvNone, fmt.Errorf("loading %s/.envrc: %w", rcDir, err)
+	}
+
+	env, err := parseDirenvExport(out)
+	if err != nil {
+		return nil, DirenvNone, fmt.Errorf("loading %s/.envrc: %w", rcDir, err)
+	}
+
+	entry.env = env
+	entry.rcHash = rcHash
+	return env, DirenvAllowed, nil
+}
+
+func parseDirenvExport(data []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return env, nil
+	}
+
+	var vars map[string]*string
+	if err := json.Unmarshal(data, &vars); err != nil {
+		return nil, fmt.Errorf("parsing direnv export: %w", err)
+	}
+	for name, value := range vars {
+		// Unset variables and direnv's own bookkeeping are left out.
+		if value == nil || strings.HasPrefix(name, "DIRENV_") {
+			continue
+		}
+		env[name] = *value
+	}
+	return env, nil
+}
+
+// WithDirenv layers env over the variables direnv exported; configured
+// variables win. direnv exports complete values, PATH included, so nothing
+// needs joining.
+func WithDirenv(direnv, env map[string]string) map[string]string {
+	merged := maps.Clone(direnv)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	maps.Copy(merged, env)
+	return merged
+}
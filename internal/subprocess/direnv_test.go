@@ -0,0 +1,68 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirenv_CachesUntilEnvrcChanges(t *testing.T) {
+	root := t.TempDir()
+	envrc := filepath.Join(root, ".envrc")
+	os.WriteFile(envrc, []byte("export GOFLAGS=-mod=mod"), 0644)
+
+	exports := 0
+	d := NewDirenv()
+	d.export = func(ctx context.Context, dir string) ([]byte, error) {
+		exports++
+		return []byte(`{"GOFLAGS":"-mod=mod","OLDVAR":null,"DIRENV_DIR":"-/src"}`), nil
+	}
+
+	env, state, err := d.Env(context.Background(), filepath.Join(root, "pkg"))
+	if err != nil {
+		t.Fatalf("Env: %v", err)
+	}
+	if state != DirenvAllowed {
+		t.Errorf("state = %s", state)
+	}
+	if len(env) != 1 || env["GOFLAGS"] != "-mod=mod" {
+		t.Errorf("unexpected env: %v", env)
+	}
+
+	d.Env(context.Background(), root)
+	if exports != 1 {
+		t.Errorf("expected cached result, got %d exports", exports)
+	}
+
+	os.WriteFile(envrc, []byte("export GOFLAGS=-mod=vendor"), 0644)
+	d.Env(context.Background(), root)
+	if exports != 2 {
+		t.Errorf("expected re-export after .envrc changed, got %d exports", exports)
+	}
+}
+
+func TestDirenv_BlockedAndMissing(t *testing.T) {
+	d := NewDirenv()
+	d.export = func(ctx context.Context, dir string) ([]byte, error) {
+		return nil, errDirenvBlocked
+	}
+
+	if _, state, err := d.Env(context.Background(), t.TempDir()); err != nil || state != DirenvNone {
+		t.Errorf("without .envrc: state = %s, err = %v", state, err)
+	}
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, ".envrc"), []byte("use flake"), 0644)
+	env, state, err := d.Env(context.Background(), root)
+	if err != nil || state != DirenvBlocked || len(env) != 0 {
+		t.Errorf("blocked: env = %v, state = %s, err = %v", env, state, err)
+	}
+}
+
+func TestWithDirenv(t *testing.T) {
+	env := WithDirenv(map[string]string{"GOFLAGS": "-mod=mod", "PATH": "/proj/bin:/usr/bin"}, map[string]string{"GOFLAGS": "-mod=vendor"})
+	if env["GOFLAGS"] != "-mod=vendor" || env["PATH"] != "/proj/bin:/usr/bin" {
+		t.Errorf("unexpected env: %v", env)
+	}
+}
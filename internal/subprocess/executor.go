@@ -2,18 +2,135 @@ package subprocess
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 type Process struct {
 	Stdin  io.WriteCloser
 	Stdout io.ReadCloser
 	Stderr io.ReadCloser
+	Pid    int
 	Wait   func() error
 	Kill   func() error
 }
 
 type Executor interface {
 	Build(ctx context.Context, flake, binarySpec string) (string, error)
+	BuildStorePath(ctx context.Context, flake string) (string, error)
 	Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error)
 }
+
+// RuntimeDepsPath builds each runtime dependency and returns the bin/
+// directories of their store paths as a PATH list, in the order given.
+func RuntimeDepsPath(ctx context.Context, executor Executor, deps []string) (string, error) {
+	var dirs []string
+	for _, dep := range deps {
+		storePath, err := executor.BuildStorePath(ctx, dep)
+		if err != nil {
+			return "", fmt.Errorf("building runtime dep %s: %w", dep, err)
+		}
+		dirs = append(dirs, filepath.Join(storePath, "bin"))
+	}
+	return strings.Join(dirs, ":"), nil
+}
+
+// WithRuntimeDeps returns a copy of env whose PATH starts with the bin/
+// directories of deps. A configured PATH is kept after them; otherwise the
+// child's PATH extends lux's own. env is returned unchanged when there are
+// no deps.
+func WithRuntimeDeps(ctx context.Context, executor Executor, deps []string, env map[string]string) (map[string]string, error) {
+	if len(deps) == 0 {
+		return env, nil
+	}
+
+	prefix, err := RuntimeDepsPath(ctx, executor, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := maps.Clone(env)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	path, ok := merged["PATH"]
+	if !ok {
+		path = os.Getenv("PATH")
+	}
+	merged["PATH"] = prefix + ":" + path
+	return merged, nil
+}
+
+// startProcess runs path with piped stdio. It backs every executor kind.
+func startProcess(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.SysProcAttr = sysProcAttr()
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd.Process.Pid)
+	}
+
+	if workDir != "" {
+		cmd.Dir = workDir
+	}
+
+	// Set up environment variables
+	if len(env) > 0 {
+		// Start with current environment
+		cmd.Env = os.Environ()
+
+		// Add or override with custom env vars
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	if limits := limitsFrom(ctx); !limits.isZero() {
+		if err := runUnderLimits(cmd, limits); err != nil {
+			return nil, fmt.Errorf("starting process: %w", err)
+		}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return nil, fmt.Errorf("creating stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("creating stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		stdin.Close()
+		stdout.Close()
+		stderr.Close()
+		return nil, fmt.Errorf("starting process: %w", err)
+	}
+
+	return &Process{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Pid:    cmd.Process.Pid,
+		Wait:   cmd.Wait,
+		Kill: func() error {
+			if cmd.Process != nil {
+				return killProcessGroup(cmd.Process.Pid)
+			}
+			return nil
+		},
+	}, nil
+}
@@ -0,0 +1,116 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// SupportsMethod reports whether the instance advertised a provider for
+// method. Instances that have not reported capabilities are assumed to
+// support everything.
+func (inst *LSPInstance) SupportsMethod(method string) bool {
+	inst.mu.RLock()
+	defer inst.mu.RUnlock()
+
+	if inst.Capabilities == nil {
+		return true
+	}
+	return inst.Capabilities.SupportsMethod(method)
+}
+
+// ServerCapabilities returns the capabilities the instance reported, if it
+// has been initialized.
+func (inst *LSPInstance) ServerCapabilities() (lsp.ServerCapabilities, bool) {
+	inst.mu.RLock()
+	defer inst.mu.RUnlock()
+
+	if inst.Capabilities == nil {
+		return lsp.ServerCapabilities{}, false
+	}
+	return *inst.Capabilities, true
+}
+
+// SupportsCommand reports whether the instance listed command in its
+// executeCommandProvider.
+func (inst *LSPInstance) SupportsCommand(command string) bool {
+	inst.mu.RLock()
+	defer inst.mu.RUnlock()
+
+	if inst.Capabilities == nil || inst.Capabilities.ExecuteCommandProvider == nil {
+		return false
+	}
+	return slices.Contains(inst.Capabilities.ExecuteCommandProvider.Commands, command)
+}
+
+// SelectForMethod picks the instances that should receive method. Mergeable
+// methods go to every instance that supports them; everything else goes to
+// the first supporting instance only. If none advertise support the first
+// instance is used so the server can answer with its own error.
+func SelectForMethod(insts []*LSPInstance, method string) []*LSPInstance {
+	if len(insts) == 0 {
+		return nil
+	}
+
+	var selected []*LSPInstance
+	for _, inst := range insts {
+		if !inst.SupportsMethod(method) {
+			continue
+		}
+		selected = append(selected, inst)
+		if !lsp.IsMergeableMethod(method) {
+			break
+		}
+	}
+
+	if len(selected) == 0 {
+		return insts[:1]
+	}
+	return selected
+}
+
+// CallAll invokes fn for every instance concurrently and returns the
+// successful results in instance order. An error is returned only when every
+// call failed.
+func CallAll(ctx context.Context, insts []*LSPInstance, fn func(ctx context.Context, inst *LSPInstance) (json.RawMessage, error)) ([]json.RawMessage, error) {
+	if len(insts) == 1 {
+		result, err := fn(ctx, insts[0])
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{result}, nil
+	}
+
+	results := make([]json.RawMessage, len(insts))
+	errs := make([]error, len(insts))
+
+	var wg sync.WaitGroup
+	for i, inst := range insts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = fn(ctx, inst)
+		}()
+	}
+	wg.Wait()
+
+	var succeeded []json.RawMessage
+	var failed []error
+	for i := range insts {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", insts[i].Name, errs[i]))
+			continue
+		}
+		succeeded = append(succeeded, results[i])
+	}
+
+	if len(succeeded) == 0 {
+		return nil, errors.Join(failed...)
+	}
+	return succeeded, nil
+}
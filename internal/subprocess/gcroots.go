@@ -0,0 +1,125 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// GCRoots registers indirect nix GC roots for the store paths lux uses, one
+// symlink per flake in a directory, so garbage collection does not force a
+// rebuild on the next cold start.
+type GCRoots struct {
+	dir string
+	mu  sync.Mutex
+
+	addRoot func(ctx context.Context, storePath, link string) error
+}
+
+// GCRoot is a flake whose store path lux keeps alive.
+type GCRoot struct {
+	Flake     string
+	StorePath string
+	Link      string
+}
+
+func NewGCRoots(dir string) *GCRoots {
+	return &GCRoots{dir: dir, addRoot: nixAddRoot}
+}
+
+func (r *GCRoots) Dir() string {
+	return r.dir
+}
+
+// Add roots storePath as the output of flake, replacing the flake's
+// previous root.
+func (r *GCRoots) Add(ctx context.Context, flake, storePath string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link := r.link(flake)
+	if target, err := os.Readlink(link); err == nil && target == storePath {
+		return nil
+	}
+
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return fmt.Errorf("creating gc roots directory: %w", err)
+	}
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing old gc root: %w", err)
+	}
+	return r.addRoot(ctx, storePath, link)
+}
+
+// Rooted reports whether flake has a root whose store path still exists.
+func (r *GCRoots) Rooted(flake string) bool {
+	target, err := os.Readlink(r.link(flake))
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(target)
+	return err == nil
+}
+
+// List returns all roots, sorted by flake.
+func (r *GCRoots) List() ([]GCRoot, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading gc roots: %w", err)
+	}
+
+	var roots []GCRoot
+	for _, entry := range entries {
+		flake, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+		link := filepath.Join(r.dir, entry.Name())
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		roots = append(roots, GCRoot{Flake: flake, StorePath: target, Link: link})
+	}
+
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Flake < roots[j].Flake })
+	return roots, nil
+}
+
+// Remove drops the root of flake. Nix forgets the indirect root once its
+// symlink is gone.
+func (r *GCRoots) Remove(flake string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.Remove(r.link(flake)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing gc root: %w", err)
+	}
+	return nil
+}
+
+// link is the symlink for flake. Escaping keeps the name reversible so
+// List can recover the flake.
+func (r *GCRoots) link(flake string) string {
+	return filepath.Join(r.dir, url.PathEscape(flake))
+}
+
+func nixAddRoot(ctx context.Context, storePath, link string) error {
+	cmd := exec.CommandContext(ctx, "nix-store", "--realise", storePath, "--add-root", link)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nix-store --add-root failed: %w\n%s", err, stderr.String())
+	}
+	return nil
+}
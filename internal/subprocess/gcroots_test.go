@@ -0,0 +1,84 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// symlinkRoots returns GCRoots that create plain symlinks instead of
+// calling nix-store, counting how often a root is added.
+func symlinkRoots(dir string, added *int) *GCRoots {
+	roots := NewGCRoots(dir)
+	roots.addRoot = func(ctx context.Context, storePath, link string) error {
+		*added++
+		return os.Symlink(storePath, link)
+	}
+	return roots
+}
+
+func TestGCRoots(t *testing.T) {
+	dir := t.TempDir()
+	storeA := filepath.Join(dir, "a-gopls")
+	storeB := filepath.Join(dir, "b-gopls")
+	os.Mkdir(storeA, 0755)
+	os.Mkdir(storeB, 0755)
+
+	var added int
+	roots := symlinkRoots(filepath.Join(dir, "gcroots"), &added)
+	ctx := context.Background()
+
+	if roots.Rooted("github:NixOS/nixpkgs/nixos-unstable#gopls") {
+		t.Error("nothing should be rooted yet")
+	}
+
+	roots.Add(ctx, "github:NixOS/nixpkgs/nixos-unstable#gopls", storeA)
+	roots.Add(ctx, "github:NixOS/nixpkgs/nixos-unstable#gopls", storeA)
+	if added != 1 {
+		t.Errorf("re-adding the same path should be a no-op, added %d roots", added)
+	}
+
+	roots.Add(ctx, "github:NixOS/nixpkgs/nixos-unstable#gopls", storeB)
+	roots.Add(ctx, "nixpkgs#go", storeA)
+
+	list, err := roots.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 2 || list[0].Flake != "github:NixOS/nixpkgs/nixos-unstable#gopls" || list[0].StorePath != storeB {
+		t.Fatalf("unexpected roots: %+v", list)
+	}
+
+	if err := roots.Remove("nixpkgs#go"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if roots.Rooted("nixpkgs#go") {
+		t.Error("removed root should not be rooted")
+	}
+
+	os.Remove(storeB)
+	if roots.Rooted("github:NixOS/nixpkgs/nixos-unstable#gopls") {
+		t.Error("a root whose store path is gone should not count")
+	}
+}
+
+func TestNixExecutor_RootsBuilds(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "abc-go")
+	os.Mkdir(storePath, 0755)
+
+	var added int
+	e := NewNixExecutor()
+	e.SetGCRoots(symlinkRoots(filepath.Join(dir, "gcroots"), &added))
+	e.build = func(ctx context.Context, flake string) (string, error) {
+		return storePath, nil
+	}
+
+	if _, err := e.BuildStorePath(context.Background(), "nixpkgs#go"); err != nil {
+		t.Fatalf("BuildStorePath: %v", err)
+	}
+	if !e.Rooted("nixpkgs#go") || added != 1 {
+		t.Errorf("expected the build to be rooted, added %d roots", added)
+	}
+}
@@ -0,0 +1,142 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Limits constrains the resources of a server process. Zero values leave
+// what lux itself runs with.
+type Limits struct {
+	// Nice is added to the scheduling priority, -20 to 19.
+	Nice int
+	// AddressSpace caps virtual memory in bytes (RLIMIT_AS).
+	AddressSpace int64
+	// OpenFiles caps open file descriptors (RLIMIT_NOFILE).
+	OpenFiles uint64
+}
+
+func (l Limits) isZero() bool {
+	return l == Limits{}
+}
+
+type limitsKey struct{}
+
+// WithLimits makes processes started with ctx run under limits.
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, limits)
+}
+
+func limitsFrom(ctx context.Context) Limits {
+	l, _ := ctx.Value(limitsKey{}).(Limits)
+	return l
+}
+
+// ExecLimitsCommand is the hidden lux subcommand servers with limits are
+// started through. Limits applied after exec would miss whatever the server
+// does first, and a nice level set from outside reaches only its main
+// thread, so the launcher applies them to itself and then executes the
+// server:
+//
+//	lux _exec-limits <nice> <address-space> <open-files> <path> <argv...>
+const ExecLimitsCommand = "_exec-limits"
+
+var limitsLauncher string
+
+// SetLimitsLauncher makes servers with limits start through the lux
+// executable at path, which must dispatch ExecLimitsCommand to
+// ExecUnderLimits. Without a launcher such servers fail to start. It is
+// meant to be called once, before any server starts.
+func SetLimitsLauncher(path string) {
+	limitsLauncher = path
+}
+
+// ExecUnderLimits implements ExecLimitsCommand: it applies the limits in
+// args to the calling process and replaces it with the command that
+// follows them. It returns only on failure.
+func ExecUnderLimits(args []string) error {
+	if len(args) < 5 {
+		return fmt.Errorf("usage: %s <nice> <address-space> <open-files> <path> <argv...>", ExecLimitsCommand)
+	}
+	path := args[3]
+
+	var l Limits
+	var err error
+	if l.Nice, err = strconv.Atoi(args[0]); err != nil {
+		return fmt.Errorf("%s: invalid nice level: %w", path, err)
+	}
+	if l.AddressSpace, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+		return fmt.Errorf("%s: invalid address space limit: %w", path, err)
+	}
+	if l.OpenFiles, err = strconv.ParseUint(args[2], 10, 64); err != nil {
+		return fmt.Errorf("%s: invalid open files limit: %w", path, err)
+	}
+
+	runtime.LockOSThread()
+	if err := setOwnLimits(l); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	err = syscall.Exec(path, args[4:], os.Environ())
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// runUnderLimits makes cmd start the limits launcher, which applies l to
+// itself before executing the original command.
+func runUnderLimits(cmd *exec.Cmd, l Limits) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	if limitsLauncher == "" {
+		return fmt.Errorf("resource limits need a limits launcher")
+	}
+
+	args := []string{
+		limitsLauncher,
+		ExecLimitsCommand,
+		strconv.Itoa(l.Nice),
+		strconv.FormatInt(l.AddressSpace, 10),
+		strconv.FormatUint(l.OpenFiles, 10),
+		cmd.Path,
+	}
+	cmd.Args = append(args, cmd.Args...)
+	cmd.Path = limitsLauncher
+	return nil
+}
+
+// cpuMeter turns a process's cumulative CPU time into utilization since the
+// previous sample.
+type cpuMeter struct {
+	mu    sync.Mutex
+	at    time.Time
+	total time.Duration
+}
+
+func (m *cpuMeter) reset(at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.at = at
+	m.total = 0
+}
+
+// sample records total as of now and returns the percentage of one CPU
+// used since the last sample.
+func (m *cpuMeter) sample(total time.Duration, now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wall := now.Sub(m.at)
+	used := total - m.total
+	m.at, m.total = now, total
+	if wall <= 0 || used < 0 {
+		return 0
+	}
+	return float64(used) / float64(wall) * 100
+}
@@ -0,0 +1,271 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// logBufferSize is how many entries each instance keeps.
+const logBufferSize = 1000
+
+// maxLogLine bounds a stderr line held back while waiting for its newline.
+const maxLogLine = 64 << 10
+
+type LogSource string
+
+const (
+	LogSourceStderr      LogSource = "stderr"
+	LogSourceLogMessage  LogSource = "logMessage"
+	LogSourceShowMessage LogSource = "showMessage"
+	LogSourceLux         LogSource = "lux"
+)
+
+// logSeq numbers entries across all buffers, so a follower can tell the
+// entries it already got with the backlog from new ones.
+var logSeq atomic.Uint64
+
+// LogEntry is one line of an instance's log.
+type LogEntry struct {
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"`
+	Source   LogSource `json:"source"`
+	Level    string    `json:"level,omitempty"`
+	Text     string    `json:"text"`
+
+	seq uint64
+}
+
+// LogBuffer keeps the most recent log entries of an instance: the server's
+// stderr, the messages it sends to the client and lux's lifecycle events.
+// It outlives restarts, so a crash can be read next to what led up to it.
+type LogBuffer struct {
+	instance string
+	onAdd    func(LogEntry)
+
+	mu      sync.Mutex
+	entries []LogEntry
+	next    int
+	full    bool
+	partial []byte
+}
+
+func NewLogBuffer(instance string, size int, onAdd func(LogEntry)) *LogBuffer {
+	return &LogBuffer{
+		instance: instance,
+		onAdd:    onAdd,
+		entries:  make([]LogEntry, size),
+	}
+}
+
+func (b *LogBuffer) Add(source LogSource, level, text string) {
+	entry := LogEntry{
+		Time:     time.Now(),
+		Instance: b.instance,
+		Source:   source,
+		Level:    level,
+		Text:     text,
+	}
+
+	b.mu.Lock()
+	entry.seq = logSeq.Add(1)
+	b.entries[b.next] = entry
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+	b.mu.Unlock()
+
+	if b.onAdd != nil {
+		b.onAdd(entry)
+	}
+}
+
+// Entries returns the buffered entries, oldest first.
+func (b *LogBuffer) Entries() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]LogEntry(nil), b.entries[:b.next]...)
+	}
+	out := make([]LogEntry, 0, len(b.entries))
+	out = append(out, b.entries[b.next:]...)
+	return append(out, b.entries[:b.next]...)
+}
+
+// Write records server stderr, one entry per line.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	b.partial = append(b.partial, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(bytes.TrimRight(b.partial[:i], "\r")))
+		b.partial = b.partial[i+1:]
+	}
+	if len(b.partial) > maxLogLine {
+		lines = append(lines, string(b.partial))
+		b.partial = nil
+	}
+	b.mu.Unlock()
+
+	for _, line := range lines {
+		b.Add(LogSourceStderr, "", line)
+	}
+	return len(p), nil
+}
+
+// logf records a lifecycle event in the instance's log and reports it on
+// lux's stderr.
+func (inst *LSPInstance) logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	inst.Logs.Add(LogSourceLux, "", msg)
+	fmt.Fprintf(os.Stderr, "[lux] %s: %s\n", inst.Key, msg)
+}
+
+// logEvent records a lifecycle event in the instance's log only.
+func (inst *LSPInstance) logEvent(format string, args ...any) {
+	inst.Logs.Add(LogSourceLux, "", fmt.Sprintf(format, args...))
+}
+
+// captureMessages records window/logMessage and window/showMessage from the
+// server before handing them to next.
+func (inst *LSPInstance) captureMessages(next jsonrpc.Handler) jsonrpc.Handler {
+	return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+		if msg.IsNotification() && (msg.Method == lsp.MethodWindowLogMessage || msg.Method == lsp.MethodWindowShowMessage) {
+			var params lsp.MessageParams
+			if err := json.Unmarshal(msg.Params, &params); err == nil {
+				source := LogSourceLogMessage
+				if msg.Method == lsp.MethodWindowShowMessage {
+					source = LogSourceShowMessage
+				}
+				inst.Logs.Add(source, params.Type.String(), params.Message)
+			}
+		}
+		if next == nil {
+			return nil, nil
+		}
+		return next(ctx, msg)
+	}
+}
+
+func (p *Pool) newLogBuffer(name, key string) *LogBuffer {
+	return NewLogBuffer(key, logBufferSize, func(e LogEntry) {
+		p.publishLog(name, e)
+	})
+}
+
+type logSubscriber struct {
+	name string
+	ch   chan LogEntry
+
+	// seen is the last entry of each instance the backlog handed to the
+	// follower included.
+	seen map[string]uint64
+}
+
+func (p *Pool) publishLog(name string, e LogEntry) {
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+	for _, sub := range p.logSubs {
+		if sub.name != name && sub.name != e.Instance {
+			continue
+		}
+		if e.seq <= sub.seen[e.Instance] {
+			continue
+		}
+		// A follower that cannot keep up misses entries rather than
+		// stalling the server.
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+// Logs returns the buffered entries of an LSP, merged across its project
+// instances, oldest first. name may also be the key of one instance.
+func (p *Pool) Logs(name string) ([]LogEntry, error) {
+	insts := p.logInstances(name)
+	if len(insts) == 0 {
+		return nil, fmt.Errorf("unknown LSP: %s", name)
+	}
+	return mergeLogs(insts), nil
+}
+
+func mergeLogs(insts []*LSPInstance) []LogEntry {
+	var entries []LogEntry
+	for _, inst := range insts {
+		entries = append(entries, inst.Logs.Entries()...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries
+}
+
+// FollowLogs returns the buffered entries of an LSP like Logs, and delivers
+// the entries added from then on, including those of project instances
+// started later, until stop is called. No entry is both in backlog and
+// delivered.
+func (p *Pool) FollowLogs(name string) (backlog []LogEntry, entries <-chan LogEntry, stop func(), err error) {
+	insts := p.logInstances(name)
+	if len(insts) == 0 {
+		return nil, nil, nil, fmt.Errorf("unknown LSP: %s", name)
+	}
+
+	sub := &logSubscriber{name: name, ch: make(chan LogEntry, 256), seen: make(map[string]uint64)}
+	p.logMu.Lock()
+	p.logSubs = append(p.logSubs, sub)
+	// Entries added before this point but not yet published are in the
+	// backlog; seen keeps publishLog from delivering them again.
+	backlog = mergeLogs(insts)
+	for _, e := range backlog {
+		sub.seen[e.Instance] = max(sub.seen[e.Instance], e.seq)
+	}
+	p.logMu.Unlock()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			p.logMu.Lock()
+			defer p.logMu.Unlock()
+			for i, s := range p.logSubs {
+				if s == sub {
+					p.logSubs = append(p.logSubs[:i], p.logSubs[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+	return backlog, sub.ch, stop, nil
+}
+
+func (p *Pool) logInstances(name string) []*LSPInstance {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var insts []*LSPInstance
+	for lspName, inst := range p.instances {
+		if lspName == name {
+			insts = append(insts, inst)
+		}
+		for _, projInst := range p.projects[lspName] {
+			if lspName == name || projInst.Key == name {
+				insts = append(insts, projInst)
+			}
+		}
+	}
+	return insts
+}
@@ -0,0 +1,135 @@
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestLogBuffer_KeepsMostRecent(t *testing.T) {
+	b := NewLogBuffer("gopls", 3, nil)
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		b.Add(LogSourceLux, "", text)
+	}
+
+	entries := b.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, want := range []string{"c", "d", "e"} {
+		if entries[i].Text != want {
+			t.Errorf("entry %d = %q, want %q", i, entries[i].Text, want)
+		}
+		if entries[i].Instance != "gopls" {
+			t.Errorf("entry %d instance = %q", i, entries[i].Instance)
+		}
+	}
+}
+
+func TestLogBuffer_SplitsStderrLines(t *testing.T) {
+	b := NewLogBuffer("gopls", 10, nil)
+	b.Write([]byte("first\r\nsec"))
+	b.Write([]byte("ond\nthird"))
+
+	entries := b.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 (partial line held back)", len(entries))
+	}
+	if entries[0].Text != "first" || entries[1].Text != "second" {
+		t.Errorf("got %q, %q", entries[0].Text, entries[1].Text)
+	}
+	if entries[0].Source != LogSourceStderr {
+		t.Errorf("source = %q, want stderr", entries[0].Source)
+	}
+}
+
+func TestPool_LogsLifecycleAndMessages(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+
+	if _, _, _, err := pool.FollowLogs("unknown"); err == nil {
+		t.Error("FollowLogs of an unknown LSP should fail")
+	}
+
+	_, followed, stop, err := pool.FollowLogs("gopls")
+	if err != nil {
+		t.Fatalf("FollowLogs: %v", err)
+	}
+	defer stop()
+
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{}); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	srv := <-executor.executed
+
+	note, _ := jsonrpc.NewNotification(lsp.MethodWindowLogMessage, lsp.MessageParams{Type: lsp.MessageTypeWarning, Message: "slow index"})
+	srv.stream.Write(note)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-followed:
+			if e.Source != LogSourceLogMessage {
+				continue
+			}
+			if e.Level != "warning" || e.Text != "slow index" {
+				t.Errorf("got %+v", e)
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for the logMessage entry")
+		}
+		break
+	}
+
+	entries, err := pool.Logs("gopls")
+	if err != nil {
+		t.Fatalf("Logs: %v", err)
+	}
+	var texts []string
+	for _, e := range entries {
+		texts = append(texts, string(e.Source)+": "+e.Text)
+	}
+	want := []string{"lux: starting", "lux: running", "logMessage: slow index"}
+	if len(texts) != len(want) {
+		t.Fatalf("got %q, want %q", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, texts[i], want[i])
+		}
+	}
+}
+
+func TestPool_FollowLogsSkipsBacklog(t *testing.T) {
+	pool := NewPool(nil, nil)
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+	inst, _ := pool.Get("gopls")
+	inst.logEvent("before")
+
+	backlog, followed, stop, err := pool.FollowLogs("gopls")
+	if err != nil {
+		t.Fatalf("FollowLogs: %v", err)
+	}
+	defer stop()
+	if len(backlog) != 1 || backlog[0].Text != "before" {
+		t.Fatalf("backlog = %+v", backlog)
+	}
+
+	// An entry buffered before FollowLogs but published after it must not
+	// be delivered a second time.
+	pool.publishLog("gopls", backlog[0])
+	inst.logEvent("after")
+
+	select {
+	case e := <-followed:
+		if e.Text != "after" {
+			t.Errorf("got %q, want only the entry added after following", e.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the new entry")
+	}
+}
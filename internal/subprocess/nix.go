@@ -3,25 +3,125 @@ package subprocess
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 type NixExecutor struct {
-	cache   map[string]string
-	cacheMu sync.RWMutex
+	cache    map[string]string
+	cacheMu  sync.RWMutex
+	devShell *DevShell
+	direnv   *Direnv
+
+	// builds persists store paths across runs; nil keeps everything in
+	// memory. locks memoizes each flake's locked narHash for this process
+	// and used the entries already marked as used.
+	builds *BuildCache
+	locks  map[string]flakeLock
+	used   map[string]bool
+
+	// pins maps flakes to the builds lux.lock fixes them to.
+	pins map[string]Pin
+
+	// roots keeps the store paths of built flakes from being collected;
+	// nil registers no roots.
+	roots *GCRoots
+
+	build     func(ctx context.Context, flake string) (string, error)
+	lockFlake func(ctx context.Context, ref string) (flakeLock, error)
+}
+
+type flakeLock struct {
+	URL      string
+	NarHash  string
+	Revision string
+}
+
+// Pin fixes a flake to a locked source and the store path it built to.
+type Pin struct {
+	URL       string
+	Revision  string
+	NarHash   string
+	StorePath string
 }
 
 func NewNixExecutor() *NixExecutor {
 	return &NixExecutor{
-		cache: make(map[string]string),
+		cache:     make(map[string]string),
+		devShell:  NewDevShell(),
+		direnv:    NewDirenv(),
+		locks:     make(map[string]flakeLock),
+		used:      make(map[string]bool),
+		build:     nixBuild,
+		lockFlake: nixFlakeLock,
 	}
 }
 
+// SetBuildCache makes builds persist across runs in c.
+func (e *NixExecutor) SetBuildCache(c *BuildCache) {
+	e.builds = c
+}
+
+func (e *NixExecutor) BuildCache() *BuildCache {
+	return e.builds
+}
+
+// SetGCRoots makes every store path lux resolves a GC root in roots.
+func (e *NixExecutor) SetGCRoots(roots *GCRoots) {
+	e.roots = roots
+}
+
+// Rooted reports whether the store path of flake is protected by a GC root.
+func (e *NixExecutor) Rooted(flake string) bool {
+	return e.roots != nil && e.roots.Rooted(flake)
+}
+
+// SetPins makes builds of the given flakes use their pinned source instead
+// of whatever the flake reference currently resolves to.
+func (e *NixExecutor) SetPins(pins map[string]Pin) {
+	e.cacheMu.Lock()
+	e.pins = pins
+	e.cacheMu.Unlock()
+}
+
+// Resolve locks flake's source as it stands now and builds it from the
+// locked reference, returning a Pin for it. Pins set on e are ignored.
+func (e *NixExecutor) Resolve(ctx context.Context, flake string) (Pin, error) {
+	ref, attr, _ := strings.Cut(flake, "#")
+	lock, err := e.lockFlake(ctx, ref)
+	if err != nil {
+		return Pin{}, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	if lock.URL == "" {
+		return Pin{}, fmt.Errorf("resolving %s: flake metadata has no locked url", ref)
+	}
+
+	storePath, err := e.build(ctx, pinnedRef(lock.URL, attr))
+	if err != nil {
+		return Pin{}, err
+	}
+
+	return Pin{
+		URL:       lock.URL,
+		Revision:  lock.Revision,
+		NarHash:   lock.NarHash,
+		StorePath: storePath,
+	}, nil
+}
+
+func pinnedRef(url, attr string) string {
+	if attr == "" {
+		return url
+	}
+	return url + "#" + attr
+}
+
 func (e *NixExecutor) Build(ctx context.Context, flake, binarySpec string) (string, error) {
 	cacheKey := flake
 	if binarySpec != "" {
@@ -31,17 +131,240 @@ func (e *NixExecutor) Build(ctx context.Context, flake, binarySpec string) (stri
 	e.cacheMu.RLock()
 	if path, ok := e.cache[cacheKey]; ok {
 		e.cacheMu.RUnlock()
+		e.markUsed(ctx, flake, binarySpec)
 		return path, nil
 	}
 	e.cacheMu.RUnlock()
 
-	cmd := exec.CommandContext(ctx, "nix", "build", flake, "--no-link", "--print-out-paths")
+	outPath, err := e.storePath(ctx, flake, binarySpec)
+	if err != nil {
+		return "", err
+	}
+	e.addRoot(ctx, flake, outPath)
+
+	binPath, err := findExecutable(outPath, binarySpec)
+	if err != nil {
+		return "", err
+	}
+
+	e.cacheMu.Lock()
+	e.cache[cacheKey] = binPath
+	e.cacheMu.Unlock()
+
+	e.markUsed(ctx, flake, binarySpec)
+	return binPath, nil
+}
+
+// BuildStorePath builds flake and returns its output store path rather than
+// an executable inside it.
+func (e *NixExecutor) BuildStorePath(ctx context.Context, flake string) (string, error) {
+	cacheKey := "storepath::" + flake
+
+	e.cacheMu.RLock()
+	if path, ok := e.cache[cacheKey]; ok {
+		e.cacheMu.RUnlock()
+		e.markUsed(ctx, flake, "")
+		return path, nil
+	}
+	e.cacheMu.RUnlock()
+
+	storePath, err := e.storePath(ctx, flake, "")
+	if err != nil {
+		return "", err
+	}
+	e.addRoot(ctx, flake, storePath)
+
+	e.cacheMu.Lock()
+	e.cache[cacheKey] = storePath
+	e.cacheMu.Unlock()
+
+	e.markUsed(ctx, flake, "")
+	return storePath, nil
+}
+
+// storePath returns the output path of flake. A pinned flake is taken from
+// its pinned store path, or rebuilt from its locked source when that path
+// has been collected. Otherwise, with a build cache, a previous build is
+// reused as long as the flake's lock has not moved and the store path still
+// exists.
+func (e *NixExecutor) storePath(ctx context.Context, flake, binarySpec string) (string, error) {
+	e.cacheMu.RLock()
+	pin, pinned := e.pins[flake]
+	e.cacheMu.RUnlock()
+	if pinned {
+		storePath := pin.StorePath
+		if _, err := os.Stat(storePath); err != nil {
+			_, attr, _ := strings.Cut(flake, "#")
+			ReportProgress(ctx, "building "+flake, nil)
+			if storePath, err = e.build(ctx, pinnedRef(pin.URL, attr)); err != nil {
+				return "", err
+			}
+		}
+		e.recordPin(flake, binarySpec, pin, storePath)
+		return storePath, nil
+	}
+
+	lock, persistent := e.flakeLock(ctx, flake)
+	if persistent {
+		if entry, ok := e.builds.Lookup(flake, binarySpec, lock.NarHash); ok {
+			return entry.StorePath, nil
+		}
+	}
+
+	ReportProgress(ctx, "building "+flake, nil)
+	storePath, err := e.build(ctx, flake)
+	if err != nil {
+		return "", err
+	}
+
+	if persistent {
+		entry := CacheEntry{
+			Flake:     flake,
+			Binary:    binarySpec,
+			NarHash:   lock.NarHash,
+			Revision:  lock.Revision,
+			StorePath: storePath,
+			BuiltAt:   time.Now(),
+		}
+		if err := e.builds.Put(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "[lux] saving build cache: %v\n", err)
+		}
+	}
+	return storePath, nil
+}
+
+// flakeLock resolves the lock of flake's source once per process. It
+// reports false when there is no build cache or the lock cannot be
+// resolved, in which case builds bypass the persistent cache.
+func (e *NixExecutor) flakeLock(ctx context.Context, flake string) (flakeLock, bool) {
+	if e.builds == nil {
+		return flakeLock{}, false
+	}
+	ref, _, _ := strings.Cut(flake, "#")
+
+	e.cacheMu.RLock()
+	lock, ok := e.locks[ref]
+	e.cacheMu.RUnlock()
+	if ok {
+		return lock, true
+	}
+
+	lock, err := e.lockFlake(ctx, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] resolving %s, not using build cache: %v\n", ref, err)
+		return flakeLock{}, false
+	}
+
+	e.cacheMu.Lock()
+	e.locks[ref] = lock
+	e.cacheMu.Unlock()
+	return lock, true
+}
+
+// recordPin adds a build cache entry for a pinned flake under the pin's
+// narHash, so that its use is recorded like that of any other build.
+func (e *NixExecutor) recordPin(flake, binarySpec string, pin Pin, storePath string) {
+	if e.builds == nil {
+		return
+	}
+	if _, ok := e.builds.Lookup(flake, binarySpec, pin.NarHash); ok {
+		return
+	}
+	entry := CacheEntry{
+		Flake:     flake,
+		Binary:    binarySpec,
+		NarHash:   pin.NarHash,
+		Revision:  pin.Revision,
+		StorePath: storePath,
+		BuiltAt:   time.Now(),
+	}
+	if err := e.builds.Put(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] saving build cache: %v\n", err)
+	}
+}
+
+// addRoot registers a GC root for the store path of flake. Failing to root
+// a path only costs a rebuild later, so it is not an error.
+func (e *NixExecutor) addRoot(ctx context.Context, flake, storePath string) {
+	if e.roots == nil {
+		return
+	}
+	if err := e.roots.Add(ctx, flake, storePath); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] rooting %s: %v\n", flake, err)
+	}
+}
+
+// markUsed records in the build cache that a server, formatter or runtime
+// dependency was taken from flake, once per process. Prebuilds do not
+// count.
+func (e *NixExecutor) markUsed(ctx context.Context, flake, binarySpec string) {
+	if e.builds == nil || isPrebuild(ctx) {
+		return
+	}
+	ref, _, _ := strings.Cut(flake, "#")
+	key := flake + "::" + binarySpec
+
+	e.cacheMu.Lock()
+	lock, ok := e.locks[ref]
+	if pin, pinned := e.pins[flake]; pinned {
+		lock, ok = flakeLock{NarHash: pin.NarHash}, true
+	}
+	if !ok || e.used[key] {
+		e.cacheMu.Unlock()
+		return
+	}
+	e.used[key] = true
+	e.cacheMu.Unlock()
+
+	if err := e.builds.MarkUsed(flake, binarySpec, lock.NarHash); err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] saving build cache: %v\n", err)
+	}
+}
+
+// LastUsed reports when a server was last started from flake and
+// binarySpec, according to the build cache.
+func (e *NixExecutor) LastUsed(flake, binarySpec string) (time.Time, bool) {
+	if e.builds == nil {
+		return time.Time{}, false
+	}
+	return e.builds.LastUsed(flake, binarySpec)
+}
+
+func nixFlakeLock(ctx context.Context, ref string) (flakeLock, error) {
+	cmd := exec.CommandContext(ctx, "nix", "flake", "metadata", "--json", ref)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("nix build failed: %w\n%s", err, stderr.String())
+		return flakeLock{}, fmt.Errorf("nix flake metadata failed: %w\n%s", err, stderr.String())
+	}
+
+	var meta struct {
+		URL    string `json:"url"`
+		Locked struct {
+			NarHash string `json:"narHash"`
+			Rev     string `json:"rev"`
+		} `json:"locked"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &meta); err != nil {
+		return flakeLock{}, fmt.Errorf("parsing flake metadata: %w", err)
+	}
+	if meta.Locked.NarHash == "" {
+		return flakeLock{}, fmt.Errorf("flake metadata has no narHash")
+	}
+	return flakeLock{URL: meta.URL, NarHash: meta.Locked.NarHash, Revision: meta.Locked.Rev}, nil
+}
+
+func nixBuild(ctx context.Context, flake string) (string, error) {
+	cmd := exec.CommandContext(ctx, "nix", "build", flake, "--no-link", "--print-out-paths", "--log-format", "internal-json")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	log := &nixLog{report: func(text string) { ReportProgress(ctx, text, nil) }}
+	cmd.Stderr = log
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("nix build failed: %w\n%s", err, log.String())
 	}
 
 	outPath := strings.TrimSpace(stdout.String())
@@ -50,18 +373,61 @@ func (e *NixExecutor) Build(ctx context.Context, flake, binarySpec string) (stri
 	}
 
 	lines := strings.Split(outPath, "\n")
-	outPath = strings.TrimSpace(lines[0])
+	return strings.TrimSpace(lines[0]), nil
+}
 
-	binPath, err := findExecutable(outPath, binarySpec)
-	if err != nil {
-		return "", err
+// nixLog reads nix's internal-json log. The activities nix starts, such as
+// fetching a source or building a derivation, go to report; its messages
+// are kept for the error of a failed build.
+type nixLog struct {
+	report  func(text string)
+	partial []byte
+	msgs    bytes.Buffer
+}
+
+func (l *nixLog) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		l.line(l.partial[:i])
+		l.partial = l.partial[i+1:]
 	}
+	return len(p), nil
+}
 
-	e.cacheMu.Lock()
-	e.cache[cacheKey] = binPath
-	e.cacheMu.Unlock()
+func (l *nixLog) line(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("@nix "))
+	if !ok {
+		l.msgs.Write(line)
+		l.msgs.WriteByte('\n')
+		return
+	}
 
-	return binPath, nil
+	var entry struct {
+		Action string `json:"action"`
+		Text   string `json:"text"`
+		Msg    string `json:"msg"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return
+	}
+	switch entry.Action {
+	case "start":
+		if entry.Text != "" && l.report != nil {
+			l.report(entry.Text)
+		}
+	case "msg":
+		l.msgs.WriteString(entry.Msg)
+		l.msgs.WriteByte('\n')
+	}
+}
+
+// String returns the messages nix logged.
+func (l *nixLog) String() string {
+	return l.msgs.String() + string(l.partial)
 }
 
 func findExecutable(storePath, binarySpec string) (string, error) {
@@ -125,65 +491,27 @@ func findExecutable(storePath, binarySpec string) (string, error) {
 }
 
 func (e *NixExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
-	cmd := exec.CommandContext(ctx, path, args...)
-
-	if workDir != "" {
-		cmd.Dir = workDir
-	}
-
-	// Set up environment variables
-	if len(env) > 0 {
-		// Start with current environment
-		cmd.Env = os.Environ()
-
-		// Add or override with custom env vars
-		for k, v := range env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	}
-
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("creating stdin pipe: %w", err)
-	}
+	return startProcess(ctx, path, args, env, workDir)
+}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		stdin.Close()
-		return nil, fmt.Errorf("creating stdout pipe: %w", err)
-	}
+// DevShellEnv returns the environment of the devShell of the project flake
+// containing dir.
+func (e *NixExecutor) DevShellEnv(ctx context.Context, dir string) (map[string]string, error) {
+	return e.devShell.Env(ctx, dir)
+}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		stdin.Close()
-		stdout.Close()
-		return nil, fmt.Errorf("creating stderr pipe: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		stderr.Close()
-		return nil, fmt.Errorf("starting process: %w", err)
-	}
-
-	return &Process{
-		Stdin:  stdin,
-		Stdout: stdout,
-		Stderr: stderr,
-		Wait:   cmd.Wait,
-		Kill: func() error {
-			if cmd.Process != nil {
-				return cmd.Process.Kill()
-			}
-			return nil
-		},
-	}, nil
+// DirenvEnv returns the variables direnv exports for dir.
+func (e *NixExecutor) DirenvEnv(ctx context.Context, dir string) (map[string]string, DirenvState, error) {
+	return e.direnv.Env(ctx, dir)
 }
 
+// ClearCache forgets in-memory build results and resolved locks; the
+// persistent build cache is left alone.
 func (e *NixExecutor) ClearCache() {
 	e.cacheMu.Lock()
 	e.cache = make(map[string]string)
+	e.locks = make(map[string]flakeLock)
+	e.used = make(map[string]bool)
 	e.cacheMu.Unlock()
 }
 
@@ -1,6 +1,8 @@
 package subprocess
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -171,3 +173,128 @@ func TestFindExecutable_MultipleExecutablesDefaultToFirst(t *testing.T) {
 		t.Errorf("expected one of the executables, got %s", result)
 	}
 }
+
+func TestWithRuntimeDeps(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	executor := newFakeExecutor()
+
+	env, err := WithRuntimeDeps(context.Background(), executor, []string{"nixpkgs#go", "nixpkgs#gcc"}, map[string]string{"GOFLAGS": "-mod=mod"})
+	if err != nil {
+		t.Fatalf("WithRuntimeDeps: %v", err)
+	}
+	if want := "/nix/store/fake-nixpkgs#go/bin:/nix/store/fake-nixpkgs#gcc/bin:/usr/bin"; env["PATH"] != want {
+		t.Errorf("PATH = %q, want %q", env["PATH"], want)
+	}
+	if env["GOFLAGS"] != "-mod=mod" {
+		t.Errorf("GOFLAGS lost: %v", env)
+	}
+
+	configured := map[string]string{"PATH": "/opt/bin"}
+	env, err = WithRuntimeDeps(context.Background(), executor, []string{"nixpkgs#go"}, configured)
+	if err != nil {
+		t.Fatalf("WithRuntimeDeps: %v", err)
+	}
+	if env["PATH"] != "/nix/store/fake-nixpkgs#go/bin:/opt/bin" {
+		t.Errorf("PATH = %q", env["PATH"])
+	}
+	if configured["PATH"] != "/opt/bin" {
+		t.Error("configured env was modified")
+	}
+}
+
+func TestNixExecutor_ExecutePassesEnvLiterally(t *testing.T) {
+	proc, err := NewNixExecutor().Execute(context.Background(), "/bin/sh", []string{"-c", "printf %s \"$LUX_TEST_HOOK\""},
+		map[string]string{"LUX_TEST_HOOK": "echo ${PATH} $HOME"}, "")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	out, _ := io.ReadAll(proc.Stdout)
+	proc.Wait()
+
+	if string(out) != "echo ${PATH} $HOME" {
+		t.Errorf("child LUX_TEST_HOOK = %q", out)
+	}
+}
+
+func TestNixExecutor_HonorsPins(t *testing.T) {
+	dir := t.TempDir()
+	pinned := filepath.Join(dir, "pinned-gopls")
+	os.MkdirAll(filepath.Join(pinned, "bin"), 0755)
+	os.WriteFile(filepath.Join(pinned, "bin", "gopls"), []byte("#!/bin/sh\n"), 0755)
+
+	var built []string
+	e := NewNixExecutor()
+	e.SetBuildCache(NewBuildCache(filepath.Join(dir, "build-cache.json")))
+	e.build = func(ctx context.Context, flake string) (string, error) {
+		built = append(built, flake)
+		return pinned, nil
+	}
+	e.lockFlake = func(ctx context.Context, ref string) (flakeLock, error) {
+		t.Errorf("pinned flake %q should not be re-resolved", ref)
+		return flakeLock{}, nil
+	}
+
+	url := "github:NixOS/nixpkgs/abc123?narHash=sha256-a"
+	e.SetPins(map[string]Pin{
+		"nixpkgs#gopls": {URL: url, NarHash: "sha256-a", StorePath: pinned},
+		"nixpkgs#go":    {URL: url, NarHash: "sha256-a", StorePath: filepath.Join(dir, "collected-go")},
+	})
+
+	path, err := e.Build(context.Background(), "nixpkgs#gopls", "")
+	if err != nil || path != filepath.Join(pinned, "bin", "gopls") {
+		t.Fatalf("Build = %q, %v", path, err)
+	}
+	if len(built) != 0 {
+		t.Errorf("expected the pinned store path to be used as is, built %v", built)
+	}
+	if _, ok := e.LastUsed("nixpkgs#gopls", ""); !ok {
+		t.Error("expected the start from a pinned flake to be recorded as use")
+	}
+
+	// A collected store path is rebuilt from the locked source.
+	if _, err := e.BuildStorePath(context.Background(), "nixpkgs#go"); err != nil {
+		t.Fatalf("BuildStorePath: %v", err)
+	}
+	if len(built) != 1 || built[0] != url+"#go" {
+		t.Errorf("expected a build of the locked ref, got %v", built)
+	}
+}
+
+func TestNixExecutor_Resolve(t *testing.T) {
+	e := NewNixExecutor()
+	e.lockFlake = func(ctx context.Context, ref string) (flakeLock, error) {
+		return flakeLock{URL: "github:NixOS/nixpkgs/abc123", NarHash: "sha256-a", Revision: "abc123"}, nil
+	}
+	var built string
+	e.build = func(ctx context.Context, flake string) (string, error) {
+		built = flake
+		return "/nix/store/abc-gopls", nil
+	}
+
+	pin, err := e.Resolve(context.Background(), "nixpkgs#gopls")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if built != "github:NixOS/nixpkgs/abc123#gopls" {
+		t.Errorf("built %q, want the locked ref", built)
+	}
+	if pin.Revision != "abc123" || pin.NarHash != "sha256-a" || pin.StorePath != "/nix/store/abc-gopls" {
+		t.Errorf("unexpected pin: %+v", pin)
+	}
+}
+
+func TestNixLog(t *testing.T) {
+	var reported []string
+	log := &nixLog{report: func(text string) { reported = append(reported, text) }}
+
+	log.Write([]byte(`@nix {"action":"start","id":1,"level":3,"text":"building '/nix/store/abc-gopls.drv'","type":105}` + "\n"))
+	log.Write([]byte(`@nix {"action":"start","id":2,"level":5,"text":"","type":104}` + "\n@nix {\"action\":\"msg\",\"level\":0,"))
+	log.Write([]byte(`"msg":"error: builder failed"}` + "\nwarning: plain line\n"))
+
+	if len(reported) != 1 || reported[0] != "building '/nix/store/abc-gopls.drv'" {
+		t.Errorf("reported %q", reported)
+	}
+	if got, want := log.String(), "error: builder failed\nwarning: plain line\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
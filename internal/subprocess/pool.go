@@ -4,13 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"maps"
 	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
 	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/trace"
 )
 
 type LSPState int
@@ -22,6 +28,7 @@ const (
 	LSPStateStopping
 	LSPStateStopped
 	LSPStateFailed
+	LSPStateUnhealthy
 )
 
 func (s LSPState) String() string {
@@ -38,32 +45,88 @@ func (s LSPState) String() string {
 		return "stopped"
 	case LSPStateFailed:
 		return "failed"
+	case LSPStateUnhealthy:
+		return "unhealthy"
 	default:
 		return "unknown"
 	}
 }
 
-type LSPInstance struct {
-	Name         string
-	Flake        string
-	Binary       string
-	Args         []string
-	Env          map[string]string
-	InitOptions  map[string]any
-	Settings     map[string]any
-	SettingsKey  string
+// LSPSpec describes how to run a registered language server.
+type LSPSpec struct {
+	Name            string
+	Flake           string
+	Command         string
+	Binary          string
+	Args            []string
+	Env             map[string]string
+	RuntimeDeps     []string
+	InitOptions     map[string]any
+	Settings        map[string]any
+	SettingsKey     string
 	CapOverrides    *CapabilityOverride
-	State           LSPState
-	Process         *Process
-	Conn            *jsonrpc.Conn
-	Capabilities    *lsp.ServerCapabilities
-	StartedAt       time.Time
-	Error           error
-	Progress        *ProgressTracker
 	WaitForReady    bool
 	ReadyTimeout    time.Duration
 	ActivityTimeout time.Duration
 
+	// PerProject starts a separate instance for every project root instead
+	// of sharing one process across roots.
+	PerProject bool
+
+	// IdleTimeout stops the instance after this long without requests or
+	// open documents. MaxMemory restarts it once its RSS exceeds this many
+	// bytes. Zero disables either policy.
+	IdleTimeout time.Duration
+	MaxMemory   int64
+
+	// HangTimeout marks the instance unhealthy and restarts it once a
+	// request has waited this long for its response. ProbeInterval sends a
+	// probe request after this long without one in flight, so a hang is
+	// noticed without traffic. Zero disables either.
+	HangTimeout   time.Duration
+	ProbeInterval time.Duration
+
+	// DevShell runs the server in the environment of the project flake's
+	// default devShell; Direnv in the one direnv exports for the project.
+	DevShell bool
+	Direnv   bool
+
+	// PathMap maps host path prefixes to the paths the server sees them
+	// under; all traffic with the server is rewritten accordingly.
+	PathMap map[string]string
+
+	// Transport is how lux talks to the server; stdio when empty. With
+	// Address set, lux attaches to a server already listening there
+	// instead of starting one.
+	Transport Transport
+	Address   string
+
+	// Limits constrains the resources of the server process.
+	Limits Limits
+}
+
+type LSPInstance struct {
+	LSPSpec
+
+	// Key identifies the instance in the pool. It is the LSP name for
+	// shared instances and name@root for per-project instances.
+	Key          string
+	ProjectRoot  string
+	State        LSPState
+	Process      *Process
+	Conn         *Conn
+	Capabilities *lsp.ServerCapabilities
+	StartedAt    time.Time
+	Error        error
+	Progress     *ProgressTracker
+	Logs         *LogBuffer
+
+	initParams   *lsp.InitializeParams
+	restarts     int
+	direnvState  DirenvState
+	activity     activity
+	cpu          cpuMeter
+	lastProbe    time.Time
 	knownFolders map[string]bool
 	mu           sync.RWMutex
 	ctx          context.Context
@@ -75,122 +138,285 @@ type CapabilityOverride struct {
 	Enable  []string
 }
 
-// HandlerFactory creates a jsonrpc.Handler for a specific LSP instance by name.
+// HandlerFactory creates a jsonrpc.Handler for a specific LSP instance by
+// its pool key.
 type HandlerFactory func(lspName string) jsonrpc.Handler
 
 type Pool struct {
-	executor       Executor
+	executors      map[ExecutorKind]Executor
 	instances      map[string]*LSPInstance
+	projects       map[string]map[string]*LSPInstance // LSP name -> project root -> instance
 	mu             sync.RWMutex
 	handlerFactory HandlerFactory
+	restartPolicy  RestartPolicy
+	onRestart      []func(*LSPInstance)
+	onStop         []func(*LSPInstance)
+	tracer         *trace.Recorder
+
+	logMu   sync.Mutex
+	logSubs []*logSubscriber
 }
 
 func NewPool(executor Executor, handlerFactory HandlerFactory) *Pool {
 	return &Pool{
-		executor:       executor,
+		executors: map[ExecutorKind]Executor{
+			ExecutorNix:     executor,
+			ExecutorCommand: NewCommandExecutor(),
+		},
 		instances:      make(map[string]*LSPInstance),
+		projects:       make(map[string]map[string]*LSPInstance),
 		handlerFactory: handlerFactory,
+		restartPolicy:  DefaultRestartPolicy,
+	}
+}
+
+// Source reports which executor kind obtains the server's binary and the
+// reference it is given: the flake, or the command when one is set.
+func (s LSPSpec) Source() (ExecutorKind, string) {
+	if s.Command != "" {
+		return ExecutorCommand, s.Command
 	}
+	return ExecutorNix, s.Flake
 }
 
-func (p *Pool) Register(name, flake, binary string, args []string, env map[string]string, initOpts map[string]any, settings map[string]any, settingsKey string, capOverrides *CapabilityOverride, waitForReady bool, readyTimeout, activityTimeout time.Duration) {
+// SetExecutor registers the executor used for servers of the given kind,
+// replacing any previous one.
+func (p *Pool) SetExecutor(kind ExecutorKind, executor Executor) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.executors[kind] = executor
+}
+
+// Register adds spec to the pool. Registering a name again with a changed
+// spec stops the instances started under the old one, shared and
+// per-project, so that the next request starts them under the new one.
+func (p *Pool) Register(spec LSPSpec) {
+	p.mu.Lock()
+
+	old, ok := p.instances[spec.Name]
+	if ok && reflect.DeepEqual(old.LSPSpec, spec) {
+		p.mu.Unlock()
+		return
+	}
 
-	p.instances[name] = &LSPInstance{
-		Name:            name,
-		Flake:           flake,
-		Binary:          binary,
-		Args:            args,
-		Env:             env,
-		InitOptions:     initOpts,
-		Settings:        settings,
-		SettingsKey:     settingsKey,
-		CapOverrides:    capOverrides,
-		State:           LSPStateIdle,
-		WaitForReady:    waitForReady,
-		ReadyTimeout:    readyTimeout,
-		ActivityTimeout: activityTimeout,
+	var replaced []*LSPInstance
+	if ok {
+		replaced = append(replaced, old)
 	}
+	for _, projInst := range p.projects[spec.Name] {
+		replaced = append(replaced, projInst)
+	}
+	delete(p.projects, spec.Name)
+
+	p.instances[spec.Name] = &LSPInstance{
+		LSPSpec: spec,
+		Key:     spec.Name,
+		State:   LSPStateIdle,
+		Logs:    p.newLogBuffer(spec.Name, spec.Name),
+	}
+	p.mu.Unlock()
+
+	for _, inst := range replaced {
+		p.stopInstance(inst)
+	}
+}
+
+// SetTracer records the traffic of every instance started from now on.
+func (p *Pool) SetTracer(rec *trace.Recorder) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tracer = rec
 }
 
-func (p *Pool) Get(name string) (*LSPInstance, bool) {
+// Get looks up an instance by pool key: an LSP name or name@root for a
+// per-project instance.
+func (p *Pool) Get(key string) (*LSPInstance, bool) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	inst, ok := p.instances[name]
-	return inst, ok
+
+	if inst, ok := p.instances[key]; ok {
+		return inst, true
+	}
+
+	// Neither names nor roots are guaranteed to be free of "@", so match
+	// against the registered names rather than splitting the key.
+	for name, byRoot := range p.projects {
+		if root, ok := strings.CutPrefix(key, name+"@"); ok {
+			if inst, ok := byRoot[root]; ok {
+				return inst, true
+			}
+		}
+	}
+	return nil, false
 }
 
-func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.InitializeParams) (*LSPInstance, error) {
-	p.mu.RLock()
-	inst, ok := p.instances[name]
-	p.mu.RUnlock()
+// instanceFor returns the instance that should serve name for the project
+// described by initParams, creating a per-project instance if needed.
+func (p *Pool) instanceFor(name string, initParams *lsp.InitializeParams) (*LSPInstance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
+	inst, ok := p.instances[name]
 	if !ok {
 		return nil, fmt.Errorf("unknown LSP: %s", name)
 	}
 
+	root := projectRootOf(initParams)
+	if !inst.PerProject || root == "" {
+		return inst, nil
+	}
+
+	if p.projects[name] == nil {
+		p.projects[name] = make(map[string]*LSPInstance)
+	}
+	if projInst, ok := p.projects[name][root]; ok {
+		return projInst, nil
+	}
+
+	key := name + "@" + root
+	projInst := &LSPInstance{
+		LSPSpec:     inst.LSPSpec,
+		Key:         key,
+		ProjectRoot: root,
+		State:       LSPStateIdle,
+		Logs:        p.newLogBuffer(name, key),
+	}
+	p.projects[name][root] = projInst
+	return projInst, nil
+}
+
+func projectRootOf(initParams *lsp.InitializeParams) string {
+	if initParams == nil {
+		return ""
+	}
+	if initParams.RootPath != nil && *initParams.RootPath != "" {
+		return *initParams.RootPath
+	}
+	if initParams.RootURI != nil {
+		return initParams.RootURI.Path()
+	}
+	return ""
+}
+
+func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.InitializeParams) (*LSPInstance, error) {
+	inst, err := p.instanceFor(name, initParams)
+	if err != nil {
+		return nil, err
+	}
+
+	restarted, err := p.ensureRunning(ctx, inst, initParams)
+	if err != nil {
+		return nil, err
+	}
+	if restarted {
+		p.notifyRestart(inst)
+	}
+
+	return inst, nil
+}
+
+// ensureRunning starts inst unless it is already running, waiting for a
+// concurrent start to finish. restarted reports whether this call brought
+// back an instance that had been running before.
+func (p *Pool) ensureRunning(ctx context.Context, inst *LSPInstance, initParams *lsp.InitializeParams) (restarted bool, err error) {
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
 
 	if inst.State == LSPStateRunning {
-		return inst, nil
+		return false, nil
 	}
 
 	if inst.State == LSPStateStarting {
-		inst.mu.Unlock()
 		for {
+			inst.mu.Unlock()
 			time.Sleep(50 * time.Millisecond)
 			inst.mu.Lock()
 			if inst.State == LSPStateRunning {
-				return inst, nil
+				return false, nil
 			}
 			if inst.State == LSPStateFailed {
-				err := inst.Error
-				inst.mu.Unlock()
-				return nil, err
+				return false, inst.Error
 			}
-			inst.mu.Unlock()
 		}
 	}
 
+	restarted = !inst.StartedAt.IsZero()
+	return restarted, p.start(ctx, inst, initParams)
+}
+
+// start launches and initializes inst. The caller must hold inst.mu.
+func (p *Pool) start(ctx context.Context, inst *LSPInstance, initParams *lsp.InitializeParams) (err error) {
+	name := inst.Key
+
+	inst.logEvent("starting")
+	ReportProgress(ctx, name+": starting", nil)
+	defer func() {
+		if err != nil {
+			inst.logEvent("start failed: %v", err)
+		}
+	}()
+
 	inst.State = LSPStateStarting
+	inst.initParams = initParams
 	inst.Progress = NewProgressTracker()
-	inst.ctx, inst.cancel = context.WithCancel(ctx)
+	// The instance outlives the request that started it; only Stop ends it.
+	// It keeps none of the request's values either, so later work does not
+	// report to a caller long gone.
+	inst.ctx, inst.cancel = context.WithCancel(context.Background())
 
-	binPath, err := p.executor.Build(inst.ctx, inst.Flake, inst.Binary)
-	if err != nil {
+	kind, source := inst.Source()
+	p.mu.RLock()
+	executor, ok := p.executors[kind]
+	nix := p.executors[ExecutorNix]
+	p.mu.RUnlock()
+	if !ok {
 		inst.State = LSPStateFailed
-		inst.Error = err
-		return nil, fmt.Errorf("building %s: %w", name, err)
+		inst.Error = fmt.Errorf("no %s executor registered", kind)
+		return fmt.Errorf("starting %s: %w", name, inst.Error)
 	}
 
-	var workDir string
-	if initParams != nil && initParams.RootPath != nil {
-		workDir = *initParams.RootPath
-	}
+	workDir := projectRootOf(initParams)
 
-	proc, err := p.executor.Execute(inst.ctx, binPath, inst.Args, inst.Env, workDir)
-	if err != nil {
-		inst.State = LSPStateFailed
-		inst.Error = err
-		return nil, fmt.Errorf("executing %s: %w", name, err)
+	var proc *Process
+	if inst.Address != "" {
+		proc, err = attachProcess(inst.ctx, inst.Transport, inst.Address)
+		if err != nil {
+			inst.State = LSPStateFailed
+			inst.Error = err
+			return fmt.Errorf("attaching to %s: %w", name, err)
+		}
+	} else {
+		proc, err = p.launch(ctx, inst, executor, nix, source, workDir)
+		if err != nil {
+			return err
+		}
 	}
 
 	inst.Process = proc
-	go NewStderrLogger(name, os.Stderr).Run(proc.Stderr)
-	inst.Conn = jsonrpc.NewConn(proc.Stdout, proc.Stdin, p.handlerFactory(name))
+	go NewStderrLogger(inst.Key, os.Stderr).Run(io.TeeReader(proc.Stderr, inst.Logs))
+	p.mu.RLock()
+	tracer := p.tracer
+	p.mu.RUnlock()
+	conn := NewConn(
+		tracer.TapReader(proc.Stdout, trace.ServerToLux, inst.Key),
+		tracer.TapWriter(proc.Stdin, trace.LuxToServer, inst.Key),
+		inst.captureMessages(p.handlerFactory(inst.Key)),
+	)
+	if len(inst.PathMap) > 0 {
+		conn.SetRewriter(lsp.NewPathMap(inst.PathMap))
+	}
+	inst.Conn = conn
 
+	runCtx := inst.ctx
 	go func() {
-		if err := inst.Conn.Run(inst.ctx); err != nil {
-			inst.mu.Lock()
-			inst.State = LSPStateFailed
-			inst.Error = err
-			inst.mu.Unlock()
+		if err := conn.Run(runCtx); err != nil {
+			p.handleCrash(inst, conn, err)
 		}
 	}()
 
 	if initParams != nil {
+		ReportProgress(ctx, name+": initializing", nil)
+
 		// Merge LSP-specific init options into params
 		customParams := *initParams
 		if customParams.Capabilities.Window == nil {
@@ -209,7 +435,7 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 			inst.State = LSPStateFailed
 			inst.Error = err
 			proc.Kill()
-			return nil, fmt.Errorf("initializing %s: %w", name, err)
+			return fmt.Errorf("initializing %s: %w", name, err)
 		}
 
 		var initResult lsp.InitializeResult
@@ -217,7 +443,7 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 			inst.State = LSPStateFailed
 			inst.Error = err
 			proc.Kill()
-			return nil, fmt.Errorf("parsing init result from %s: %w", name, err)
+			return fmt.Errorf("parsing init result from %s: %w", name, err)
 		}
 
 		inst.Capabilities = &initResult.Capabilities
@@ -236,7 +462,7 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 			inst.State = LSPStateFailed
 			inst.Error = err
 			proc.Kill()
-			return nil, fmt.Errorf("sending initialized to %s: %w", name, err)
+			return fmt.Errorf("sending initialized to %s: %w", name, err)
 		}
 
 		// Send settings via workspace/didChangeConfiguration
@@ -256,29 +482,173 @@ func (p *Pool) GetOrStart(ctx context.Context, name string, initParams *lsp.Init
 	inst.State = LSPStateRunning
 	inst.StartedAt = time.Now()
 	inst.Error = nil
+	inst.activity.reset()
+	inst.cpu.reset(inst.StartedAt)
+	if proc.Pid > 0 {
+		inst.logEvent("running (pid %d)", proc.Pid)
+	} else {
+		inst.logEvent("running")
+	}
 
+	// A restarted process only knows its root; re-add the folders the
+	// previous one had been given.
+	prevFolders := inst.knownFolders
 	inst.knownFolders = make(map[string]bool)
 	if initParams != nil && initParams.RootURI != nil {
 		inst.knownFolders[initParams.RootURI.Path()] = true
 	}
+	if initParams != nil {
+		for _, folder := range slices.Sorted(maps.Keys(prevFolders)) {
+			if err := inst.addWorkspaceFolderLocked(folder); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", name, err)
+			}
+		}
+	}
 
-	return inst, nil
+	return nil
 }
 
-func (p *Pool) Stop(name string) error {
-	p.mu.RLock()
-	inst, ok := p.instances[name]
-	p.mu.RUnlock()
+// launch builds and starts the server process of inst. Servers using a
+// network transport are started with their placeholders filled in and
+// connected to once they listen. The build reports progress to the caller
+// of ctx but, like the process, is only cancelled by stopping inst.
+func (p *Pool) launch(ctx context.Context, inst *LSPInstance, executor, nix Executor, source, workDir string) (*Process, error) {
+	name := inst.Key
+
+	buildCtx := inst.ctx
+	if fn := ProgressFrom(ctx); fn != nil {
+		buildCtx = WithProgress(inst.ctx, fn)
+	}
+
+	binPath, err := executor.Build(buildCtx, source, inst.Binary)
+	if err != nil {
+		inst.State = LSPStateFailed
+		inst.Error = err
+		return nil, fmt.Errorf("building %s: %w", name, err)
+	}
+
+	env := inst.Env
+	if inst.DevShell {
+		if workDir == "" {
+			inst.State = LSPStateFailed
+			inst.Error = fmt.Errorf("a devshell environment needs a project root")
+			return nil, fmt.Errorf("starting %s: %w", name, inst.Error)
+		}
+		ReportProgress(buildCtx, name+": loading devshell", nil)
+		shell, err := DevShellEnv(buildCtx, nix, workDir)
+		if err != nil {
+			inst.State = LSPStateFailed
+			inst.Error = err
+			return nil, fmt.Errorf("loading devshell for %s: %w", name, err)
+		}
+		env = WithDevShell(shell, env)
+	}
+	if inst.Direnv {
+		if workDir == "" {
+			inst.State = LSPStateFailed
+			inst.Error = fmt.Errorf("a direnv environment needs a project root")
+			return nil, fmt.Errorf("starting %s: %w", name, inst.Error)
+		}
+		ReportProgress(buildCtx, name+": loading direnv", nil)
+		vars, state, err := DirenvEnv(buildCtx, nix, workDir)
+		if err != nil {
+			inst.State = LSPStateFailed
+			inst.Error = err
+			return nil, fmt.Errorf("loading direnv for %s: %w", name, err)
+		}
+		if state == DirenvBlocked {
+			inst.logf(".envrc for %s is blocked, run `direnv allow` to use it", workDir)
+		}
+		inst.direnvState = state
+		env = WithDirenv(vars, env)
+	}
+
+	// Runtime deps are flakes whichever way the server itself is obtained.
+	env, err = WithRuntimeDeps(buildCtx, nix, inst.RuntimeDeps, env)
+	if err != nil {
+		inst.State = LSPStateFailed
+		inst.Error = err
+		return nil, fmt.Errorf("building runtime deps for %s: %w", name, err)
+	}
+
+	args := inst.Args
+	var addr string
+	cleanup := func() {}
+	if inst.Transport.network() != "" {
+		var value string
+		addr, value, cleanup, err = listenAddress(inst.Transport)
+		if err != nil {
+			inst.State = LSPStateFailed
+			inst.Error = err
+			return nil, fmt.Errorf("starting %s: %w", name, err)
+		}
+		args, env = withListenAddress(inst.Transport, value, args, env)
+	}
+
+	proc, err := executor.Execute(WithLimits(inst.ctx, inst.Limits), binPath, args, env, workDir)
+	if err != nil {
+		cleanup()
+		inst.State = LSPStateFailed
+		inst.Error = err
+		return nil, fmt.Errorf("executing %s: %w", name, err)
+	}
+
+	if addr != "" {
+		proc, err = connectProcess(inst.ctx, name, inst.Transport, addr, proc, cleanup)
+		if err != nil {
+			inst.State = LSPStateFailed
+			inst.Error = err
+			return nil, fmt.Errorf("connecting to %s: %w", name, err)
+		}
+	}
+	return proc, nil
+}
 
+// Stop stops the instance with the given pool key. Stopping a per-project
+// LSP by name stops every one of its project instances.
+func (p *Pool) Stop(key string) error {
+	inst, ok := p.Get(key)
 	if !ok {
-		return fmt.Errorf("unknown LSP: %s", name)
+		return fmt.Errorf("unknown LSP: %s", key)
+	}
+
+	var insts []*LSPInstance
+	insts = append(insts, inst)
+	if inst.Key == inst.Name {
+		p.mu.RLock()
+		for _, projInst := range p.projects[inst.Name] {
+			insts = append(insts, projInst)
+		}
+		p.mu.RUnlock()
+	}
+
+	for _, inst := range insts {
+		p.stopInstance(inst)
 	}
+	return nil
+}
 
+// stopInstance stops inst and, if it was running, tells the stop handlers.
+func (p *Pool) stopInstance(inst *LSPInstance) {
+	if inst.stop() {
+		p.notifyStop(inst)
+	}
+}
+
+// stop stops inst and reports whether it had been running.
+func (inst *LSPInstance) stop() bool {
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
 
+	inst.restarts = 0
+
+	if inst.State == LSPStateFailed {
+		// Cancels a pending automatic restart.
+		inst.State = LSPStateStopped
+		return false
+	}
 	if inst.State != LSPStateRunning {
-		return nil
+		return false
 	}
 
 	inst.State = LSPStateStopping
@@ -287,8 +657,11 @@ func (p *Pool) Stop(name string) error {
 	defer cancel()
 
 	if inst.Conn != nil {
-		inst.Conn.Call(ctx, lsp.MethodShutdown, nil)
-		inst.Conn.Notify(lsp.MethodExit, nil)
+		// An attached server is not ours to shut down.
+		if inst.Address == "" {
+			inst.Conn.Call(ctx, lsp.MethodShutdown, nil)
+			inst.Conn.Notify(lsp.MethodExit, nil)
+		}
 		inst.Conn.Close()
 	}
 
@@ -296,17 +669,17 @@ func (p *Pool) Stop(name string) error {
 		inst.cancel()
 	}
 
-	if inst.Process != nil {
+	if proc := inst.Process; proc != nil {
 		done := make(chan struct{})
 		go func() {
-			inst.Process.Wait()
+			proc.Wait()
 			close(done)
 		}()
 
 		select {
 		case <-done:
 		case <-ctx.Done():
-			inst.Process.Kill()
+			proc.Kill()
 		}
 	}
 
@@ -314,8 +687,8 @@ func (p *Pool) Stop(name string) error {
 	inst.Process = nil
 	inst.Conn = nil
 	inst.Capabilities = nil
-
-	return nil
+	inst.logEvent("stopped")
+	return true
 }
 
 func (p *Pool) StopAll() {
@@ -342,6 +715,39 @@ func (p *Pool) Names() []string {
 	return names
 }
 
+// all returns every instance in the pool, shared and per-project.
+func (p *Pool) all() []*LSPInstance {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var insts []*LSPInstance
+	for name, inst := range p.instances {
+		insts = append(insts, inst)
+		for _, projInst := range p.projects[name] {
+			insts = append(insts, projInst)
+		}
+	}
+	return insts
+}
+
+// Running returns the instances that are currently running.
+func (p *Pool) Running() []*LSPInstance {
+	var running []*LSPInstance
+	for _, inst := range p.all() {
+		inst.mu.RLock()
+		if inst.State == LSPStateRunning {
+			running = append(running, inst)
+		}
+		inst.mu.RUnlock()
+	}
+
+	sort.Slice(running, func(i, j int) bool { return running[i].Key < running[j].Key })
+	return running
+}
+
+// IsIdleOrFailed reports whether the named LSP needs starting. Per-project
+// LSPs always report true since whether they need starting depends on the
+// project; GetOrStart returns running instances as-is.
 func (p *Pool) IsIdleOrFailed(name string) bool {
 	p.mu.RLock()
 	inst, ok := p.instances[name]
@@ -350,51 +756,134 @@ func (p *Pool) IsIdleOrFailed(name string) bool {
 	if !ok {
 		return false
 	}
+	if inst.PerProject {
+		return true
+	}
 
 	inst.mu.RLock()
 	defer inst.mu.RUnlock()
 	return inst.State == LSPStateIdle || inst.State == LSPStateFailed
 }
 
+// Status reports every instance. A per-project LSP is listed once per
+// project it runs in; its shared entry is only listed while it is in use or
+// when no project instance exists yet.
 func (p *Pool) Status() []LSPStatus {
+	// Instances are queried without p.mu: start holds an instance's lock
+	// while it takes p.mu, and may do so for the length of a build.
 	p.mu.RLock()
-	defer p.mu.RUnlock()
+	insts := make([]*LSPInstance, 0, len(p.instances))
+	projInsts := make(map[*LSPInstance][]*LSPInstance)
+	for name, inst := range p.instances {
+		insts = append(insts, inst)
+		projInsts[inst] = slices.Collect(maps.Values(p.projects[name]))
+	}
+	nix := p.executors[ExecutorNix]
+	p.mu.RUnlock()
 
 	var statuses []LSPStatus
-	for name, inst := range p.instances {
-		inst.mu.RLock()
-		status := LSPStatus{
-			Name:      name,
-			Flake:     inst.Flake,
-			State:     inst.State.String(),
-			StartedAt: inst.StartedAt,
+	for _, inst := range insts {
+		// Status samples CPU usage, so take it once per instance.
+		if status := inst.status(); len(projInsts[inst]) == 0 || status.State != LSPStateIdle.String() {
+			statuses = append(statuses, status)
 		}
-		if inst.Error != nil {
-			status.Error = inst.Error.Error()
+		for _, projInst := range projInsts[inst] {
+			statuses = append(statuses, projInst.status())
 		}
-		inst.mu.RUnlock()
-		statuses = append(statuses, status)
 	}
 
+	if roots, ok := nix.(interface{ Rooted(flake string) bool }); ok {
+		for i := range statuses {
+			statuses[i].Rooted = statuses[i].Flake != "" && roots.Rooted(statuses[i].Flake)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Name != statuses[j].Name {
+			return statuses[i].Name < statuses[j].Name
+		}
+		return statuses[i].ProjectRoot < statuses[j].ProjectRoot
+	})
 	return statuses
 }
 
+func (inst *LSPInstance) status() LSPStatus {
+	inst.mu.RLock()
+	defer inst.mu.RUnlock()
+
+	status := LSPStatus{
+		Name:        inst.Name,
+		Flake:       inst.Flake,
+		Command:     inst.Command,
+		Address:     inst.Address,
+		ProjectRoot: inst.ProjectRoot,
+		State:       inst.State.String(),
+		StartedAt:   inst.StartedAt,
+	}
+	if inst.Error != nil {
+		status.Error = inst.Error.Error()
+	}
+	status.Restarts = inst.restarts
+	if inst.Direnv {
+		status.Direnv = string(inst.direnvState)
+	}
+	if inst.IdleTimeout > 0 {
+		status.IdleTimeout = inst.IdleTimeout.String()
+	}
+	if inst.State == LSPStateRunning {
+		status.LastActivity = inst.activity.last()
+		status.OpenDocuments = inst.activity.openDocuments()
+		if inst.Process != nil && inst.Process.Pid > 0 {
+			status.RSS, _ = readRSS(inst.Process.Pid)
+			if cpu, err := readCPUTime(inst.Process.Pid); err == nil {
+				status.CPUTime = cpu.Seconds()
+				status.CPUPercent = inst.cpu.sample(cpu, time.Now())
+			}
+		}
+	}
+	status.MaxMemory = inst.MaxMemory
+	return status
+}
+
 type LSPStatus struct {
-	Name      string    `json:"name"`
-	Flake     string    `json:"flake"`
-	State     string    `json:"state"`
-	StartedAt time.Time `json:"started_at,omitempty"`
-	Error     string    `json:"error,omitempty"`
+	Name        string    `json:"name"`
+	Flake       string    `json:"flake,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	ProjectRoot string    `json:"project_root,omitempty"`
+	State       string    `json:"state"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Restarts    int       `json:"restarts,omitempty"`
+	Direnv      string    `json:"direnv,omitempty"`
+	Rooted      bool      `json:"rooted,omitempty"`
+
+	IdleTimeout   string    `json:"idle_timeout,omitempty"`
+	LastActivity  time.Time `json:"last_activity,omitempty"`
+	OpenDocuments int       `json:"open_documents,omitempty"`
+	MaxMemory     int64     `json:"max_memory,omitempty"`
+	RSS           int64     `json:"rss,omitempty"`
+
+	// CPUTime is the CPU seconds the process has used; CPUPercent its
+	// utilization of one CPU since the previous status.
+	CPUTime    float64 `json:"cpu_time,omitempty"`
+	CPUPercent float64 `json:"cpu_percent,omitempty"`
 }
 
 func (inst *LSPInstance) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
 	inst.mu.RLock()
 	defer inst.mu.RUnlock()
 
+	if inst.State == LSPStateUnhealthy {
+		return nil, inst.Error
+	}
 	if inst.State != LSPStateRunning {
 		return nil, fmt.Errorf("LSP %s is not running", inst.Name)
 	}
 
+	inst.activity.begin()
+	defer inst.activity.end()
+
 	return inst.Conn.Call(ctx, method, params)
 }
 
@@ -406,9 +895,17 @@ func (inst *LSPInstance) Notify(method string, params any) error {
 		return fmt.Errorf("LSP %s is not running", inst.Name)
 	}
 
+	inst.activity.notified(method, params)
+
 	return inst.Conn.Notify(method, params)
 }
 
+// Unused reports whether the instance has an idle timeout and has gone that
+// long without requests or notifications, even if it has documents open.
+func (inst *LSPInstance) Unused() bool {
+	return inst.IdleTimeout > 0 && inst.activity.unusedFor() >= inst.IdleTimeout
+}
+
 func (inst *LSPInstance) IsFailed() bool {
 	inst.mu.RLock()
 	defer inst.mu.RUnlock()
@@ -423,6 +920,10 @@ func (inst *LSPInstance) EnsureWorkspaceFolder(projectRoot string) error {
 		return fmt.Errorf("LSP %s is not running", inst.Name)
 	}
 
+	return inst.addWorkspaceFolderLocked(projectRoot)
+}
+
+func (inst *LSPInstance) addWorkspaceFolderLocked(projectRoot string) error {
 	if inst.knownFolders[projectRoot] {
 		return nil
 	}
@@ -0,0 +1,160 @@
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func initParamsFor(root string) *lsp.InitializeParams {
+	return &lsp.InitializeParams{RootPath: &root}
+}
+
+func TestPool_ProjectScopedInstances(t *testing.T) {
+	pool := NewPool(nil, nil)
+	pool.Register(LSPSpec{Name: "rust-analyzer", Flake: "nixpkgs#rust-analyzer", PerProject: true})
+
+	a, err := pool.instanceFor("rust-analyzer", initParamsFor("/src/a"))
+	if err != nil {
+		t.Fatalf("instanceFor: %v", err)
+	}
+	b, _ := pool.instanceFor("rust-analyzer", initParamsFor("/src/b"))
+	again, _ := pool.instanceFor("rust-analyzer", initParamsFor("/src/a"))
+
+	if a == b {
+		t.Error("expected separate instances per project root")
+	}
+	if a != again {
+		t.Error("expected the same instance for the same project root")
+	}
+	if a.Key != "rust-analyzer@/src/a" || a.ProjectRoot != "/src/a" {
+		t.Errorf("unexpected key/root: %q %q", a.Key, a.ProjectRoot)
+	}
+
+	if got, ok := pool.Get(a.Key); !ok || got != a {
+		t.Errorf("Get(%q) did not return the project instance", a.Key)
+	}
+
+	statuses := pool.Status()
+	if len(statuses) != 2 {
+		t.Fatalf("expected one status per project, got %+v", statuses)
+	}
+	if statuses[0].ProjectRoot != "/src/a" || statuses[1].ProjectRoot != "/src/b" {
+		t.Errorf("unexpected status roots: %+v", statuses)
+	}
+}
+
+func TestPool_SharedInstanceIgnoresRoot(t *testing.T) {
+	pool := NewPool(nil, nil)
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+
+	a, _ := pool.instanceFor("gopls", initParamsFor("/src/a"))
+	b, _ := pool.instanceFor("gopls", initParamsFor("/src/b"))
+
+	if a != b || a.Key != "gopls" {
+		t.Errorf("expected one shared instance keyed by name, got %q and %q", a.Key, b.Key)
+	}
+	if _, err := pool.instanceFor("missing", nil); err == nil {
+		t.Error("expected error for unknown LSP")
+	}
+}
+
+func TestPool_RegisterChangedSpecStopsInstances(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+	pool.Register(LSPSpec{Name: "rust-analyzer", Flake: "nixpkgs#rust-analyzer", PerProject: true})
+
+	shared, err := pool.GetOrStart(context.Background(), "gopls", initParamsFor("/src/a"))
+	if err != nil {
+		t.Fatalf("GetOrStart gopls: %v", err)
+	}
+	project, err := pool.GetOrStart(context.Background(), "rust-analyzer", initParamsFor("/src/a"))
+	if err != nil {
+		t.Fatalf("GetOrStart rust-analyzer: %v", err)
+	}
+
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+	if got, _ := pool.Get("gopls"); got != shared || shared.State != LSPStateRunning {
+		t.Error("registering an unchanged spec should keep the running instance")
+	}
+
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", Args: []string{"-remote=auto"}})
+	pool.Register(LSPSpec{Name: "rust-analyzer", Flake: "nixpkgs#rust-analyzer", PerProject: true, IdleTimeout: 1})
+
+	if shared.State != LSPStateStopped {
+		t.Errorf("replaced shared instance is %s, want stopped", shared.State)
+	}
+	if project.State != LSPStateStopped {
+		t.Errorf("replaced project instance is %s, want stopped", project.State)
+	}
+	if got, _ := pool.Get("gopls"); got == shared || len(got.Args) != 1 {
+		t.Errorf("expected a new instance with the new spec, got %+v", got.LSPSpec)
+	}
+	if _, ok := pool.Get(project.Key); ok {
+		t.Errorf("project instance %s should have been dropped", project.Key)
+	}
+}
+
+func TestPool_StartsInRootURIProject(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+
+	// rootPath is deprecated; many clients send only rootUri.
+	root := lsp.URIFromPath("/src/a")
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{RootURI: &root}); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	if srv := <-executor.executed; srv.workDir != "/src/a" {
+		t.Errorf("server started in %q, want /src/a", srv.workDir)
+	}
+	pool.StopAll()
+}
+
+func TestPool_DirenvUsesRootURIProject(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", Direnv: true})
+
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{}); err == nil {
+		t.Fatal("expected a direnv server without a project root to fail")
+	}
+
+	dir := t.TempDir()
+	root := lsp.URIFromPath(dir)
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{RootURI: &root}); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	if srv := <-executor.executed; srv.workDir != dir {
+		t.Errorf("server started in %q, want %q", srv.workDir, dir)
+	}
+	pool.StopAll()
+}
+
+func TestPool_StatusDoesNotHoldPoolLock(t *testing.T) {
+	pool := NewPool(nil, nil)
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+	inst, _ := pool.Get("gopls")
+
+	// As during a start, which holds the instance while it builds.
+	inst.mu.Lock()
+	go pool.Status()
+	time.Sleep(10 * time.Millisecond)
+
+	registered := make(chan struct{})
+	go func() {
+		pool.Register(LSPSpec{Name: "pyright", Flake: "nixpkgs#pyright"})
+		close(registered)
+	}()
+	select {
+	case <-registered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Register blocked behind a pending Status")
+	}
+	inst.mu.Unlock()
+}
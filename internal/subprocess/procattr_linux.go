@@ -0,0 +1,46 @@
+package subprocess
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// sysProcAttr puts a server in its own process group, so signals aimed at
+// lux's terminal do not reach it, and has the kernel kill it if lux dies.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// killProcessGroup kills a server along with the processes it spawned.
+func killProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// setOwnLimits applies l to the calling process, which is about to execute
+// a server. The nice level is per thread on Linux, so the caller must stay
+// locked to the thread that calls exec.
+func setOwnLimits(l Limits) error {
+	if l.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, l.Nice); err != nil {
+			return fmt.Errorf("setting nice level %d: %w", l.Nice, err)
+		}
+	}
+	if l.AddressSpace > 0 {
+		if err := setrlimit(syscall.RLIMIT_AS, uint64(l.AddressSpace)); err != nil {
+			return fmt.Errorf("limiting address space: %w", err)
+		}
+	}
+	if l.OpenFiles > 0 {
+		if err := setrlimit(syscall.RLIMIT_NOFILE, l.OpenFiles); err != nil {
+			return fmt.Errorf("limiting open files: %w", err)
+		}
+	}
+	return nil
+}
+
+func setrlimit(resource int, value uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+}
@@ -0,0 +1,107 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary stand in for lux as the limits launcher.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == ExecLimitsCommand {
+		err := ExecUnderLimits(os.Args[2:])
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(126)
+	}
+	if self, err := os.Executable(); err == nil {
+		SetLimitsLauncher(self)
+	}
+	os.Exit(m.Run())
+}
+
+func TestStartProcess_IsolatesAndLimits(t *testing.T) {
+	ctx := WithLimits(context.Background(), Limits{Nice: 5, AddressSpace: 8 << 30, OpenFiles: 64})
+	proc, err := startProcess(ctx, "sleep", []string{"30"}, nil, "")
+	if err != nil {
+		t.Fatalf("startProcess: %v", err)
+	}
+	defer func() {
+		proc.Kill()
+		proc.Wait()
+	}()
+
+	waitForExec(t, proc.Pid, "sleep")
+
+	if pgid, err := syscall.Getpgid(proc.Pid); err != nil || pgid != proc.Pid {
+		t.Errorf("expected the server to lead its own process group, pgid = %d, %v", pgid, err)
+	}
+
+	limits, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", proc.Pid))
+	if err != nil {
+		t.Fatalf("reading limits: %v", err)
+	}
+	if line := limitLine(string(limits), "Max open files"); !strings.Contains(line, " 64 ") {
+		t.Errorf("open file limit not applied: %q", line)
+	}
+	if line := limitLine(string(limits), "Max address space"); !strings.Contains(line, fmt.Sprint(int64(8<<30))) {
+		t.Errorf("address space limit not applied: %q", line)
+	}
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", proc.Pid))
+	if err != nil {
+		t.Fatalf("reading stat: %v", err)
+	}
+	fields := strings.Fields(string(stat)[strings.LastIndex(string(stat), ")")+1:])
+	if fields[16] != "5" {
+		t.Errorf("expected nice 5, got %s", fields[16])
+	}
+
+	if cpu, err := readCPUTime(proc.Pid); err != nil || cpu < 0 {
+		t.Errorf("readCPUTime = %v, %v", cpu, err)
+	}
+}
+
+func TestStartProcess_LimitsApplyBeforeExec(t *testing.T) {
+	ctx := WithLimits(context.Background(), Limits{Nice: 3, OpenFiles: 64})
+	proc, err := startProcess(ctx, "/bin/sh", []string{"-c", "ulimit -n; cut -d' ' -f19 /proc/self/stat"}, nil, "")
+	if err != nil {
+		t.Fatalf("startProcess: %v", err)
+	}
+	out, _ := io.ReadAll(proc.Stdout)
+	if err := proc.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	if got := strings.Fields(string(out)); len(got) != 2 || got[0] != "64" || got[1] != "3" {
+		t.Errorf("expected the server to start with 64 open files and nice 3, got %q", out)
+	}
+}
+
+// waitForExec waits until pid has replaced the limits launcher that applied its
+// limits with the command named comm.
+func waitForExec(t *testing.T, pid int, comm string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		if err == nil && strings.TrimSpace(string(got)) == comm {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("process %d never executed %s", pid, comm)
+}
+
+func limitLine(limits, name string) string {
+	for _, line := range strings.Split(limits, "\n") {
+		if strings.HasPrefix(line, name) {
+			return line
+		}
+	}
+	return ""
+}
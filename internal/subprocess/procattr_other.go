@@ -0,0 +1,33 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// sysProcAttr puts a server in its own process group. Only Linux can have
+// it killed when lux dies.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills a server along with the processes it spawned.
+func killProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// setOwnLimits applies the nice level of l to the calling process, which is
+// about to execute a server. Only Linux supports the rlimits.
+func setOwnLimits(l Limits) error {
+	if l.AddressSpace > 0 || l.OpenFiles > 0 {
+		return fmt.Errorf("address space and open file limits are only supported on Linux")
+	}
+	if l.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, l.Nice); err != nil {
+			return fmt.Errorf("setting nice level %d: %w", l.Nice, err)
+		}
+	}
+	return nil
+}
@@ -189,3 +189,29 @@ func (pt *ProgressTracker) WaitForReady(ctx context.Context, activityTimeout, ha
 		}
 	}
 }
+
+// ProgressFunc receives progress of work done on behalf of a caller, such as
+// building a server or waiting for it to finish indexing. percentage is nil
+// when the work does not say how far along it is.
+type ProgressFunc func(message string, percentage *int)
+
+type progressKey struct{}
+
+// WithProgress returns a context under which starting servers, nix builds
+// and readiness waits report to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ProgressFrom returns the ProgressFunc of ctx, or nil.
+func ProgressFrom(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+// ReportProgress sends message to the ProgressFunc of ctx, if there is one.
+func ReportProgress(ctx context.Context, message string, percentage *int) {
+	if fn := ProgressFrom(ctx); fn != nil {
+		fn(message, percentage)
+	}
+}
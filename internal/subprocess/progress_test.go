@@ -7,6 +7,8 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
 )
 
 func TestProgressTracker_NewIsReady(t *testing.T) {
@@ -299,3 +301,33 @@ func progressValue(t *testing.T, kind, title, message string, pct *int) json.Raw
 	}
 	return data
 }
+
+// reportingExecutor reports progress from its builds.
+type reportingExecutor struct{ *fakeExecutor }
+
+func (e reportingExecutor) Build(ctx context.Context, flake, binary string) (string, error) {
+	ReportProgress(ctx, "building "+flake, nil)
+	return e.fakeExecutor.Build(ctx, flake, binary)
+}
+
+func TestPool_StartReportsProgressToCallerOnly(t *testing.T) {
+	pool := NewPool(reportingExecutor{newFakeExecutor()}, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+
+	var messages []string
+	ctx := WithProgress(context.Background(), func(message string, _ *int) {
+		messages = append(messages, message)
+	})
+	inst, err := pool.GetOrStart(ctx, "gopls", initParamsFor("/src/a"))
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	defer pool.StopAll()
+
+	if len(messages) < 2 || messages[1] != "building nixpkgs#gopls" {
+		t.Errorf("expected the build to report to the caller, got %q", messages)
+	}
+	if ProgressFrom(inst.ctx) != nil {
+		t.Error("the instance context kept the caller's progress func")
+	}
+}
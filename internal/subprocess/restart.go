@@ -0,0 +1,167 @@
+package subprocess
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// RestartPolicy controls how the pool brings back instances whose process
+// died while running.
+type RestartPolicy struct {
+	// MaxRetries is the number of consecutive restarts attempted before the
+	// instance is left failed. Zero disables automatic restarts.
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first restart; each further
+	// attempt doubles it up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// ResetAfter is how long an instance must stay up for a later crash to
+	// start counting retries from zero again.
+	ResetAfter time.Duration
+}
+
+var DefaultRestartPolicy = RestartPolicy{
+	MaxRetries:     5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	ResetAfter:     time.Minute,
+}
+
+// Backoff returns the delay before restart attempt n, counting from zero.
+func (rp RestartPolicy) Backoff(n int) time.Duration {
+	d := rp.InitialBackoff
+	for range n {
+		d *= 2
+		if d >= rp.MaxBackoff {
+			return rp.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (p *Pool) SetRestartPolicy(policy RestartPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restartPolicy = policy
+}
+
+// OnRestart registers fn to be called after an instance that had been
+// running is started again, whether automatically after a crash or on
+// demand. Owners of open documents use it to replay didOpen.
+func (p *Pool) OnRestart(fn func(*LSPInstance)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onRestart = append(p.onRestart, fn)
+}
+
+func (p *Pool) notifyRestart(inst *LSPInstance) {
+	p.mu.RLock()
+	handlers := slices.Clone(p.onRestart)
+	p.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(inst)
+	}
+}
+
+// OnStop registers fn to be called after an instance stops running, whether
+// it is stopped, goes idle, crashes or is about to be restarted. Owners of
+// state kept per server use it to drop what the server left behind.
+func (p *Pool) OnStop(fn func(*LSPInstance)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onStop = append(p.onStop, fn)
+}
+
+func (p *Pool) notifyStop(inst *LSPInstance) {
+	p.mu.RLock()
+	handlers := slices.Clone(p.onStop)
+	p.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(inst)
+	}
+}
+
+// handleCrash is called when the connection to a process ends with an
+// error. Requests pending on conn have already failed; if the instance was
+// running it is restarted with backoff.
+func (p *Pool) handleCrash(inst *LSPInstance, conn *Conn, err error) {
+	p.mu.RLock()
+	policy := p.restartPolicy
+	p.mu.RUnlock()
+
+	inst.mu.Lock()
+	if inst.Conn != conn {
+		// A newer process has already replaced this one.
+		inst.mu.Unlock()
+		return
+	}
+
+	wasRunning := inst.State == LSPStateRunning || inst.State == LSPStateUnhealthy
+	inst.State = LSPStateFailed
+	inst.Error = err
+	if inst.cancel != nil {
+		inst.cancel()
+	}
+	if proc := inst.Process; proc != nil {
+		// The connection can break while a network server keeps running.
+		go func() {
+			proc.Kill()
+			proc.Wait()
+		}()
+	}
+	if wasRunning && time.Since(inst.StartedAt) >= policy.ResetAfter {
+		inst.restarts = 0
+	}
+	inst.mu.Unlock()
+
+	if wasRunning {
+		inst.logf("crashed: %v", err)
+		p.notifyStop(inst)
+		p.recoverInstance(inst, policy)
+	}
+}
+
+// recoverInstance restarts a crashed instance, backing off between attempts
+// until it runs again, the retry cap is reached, or someone else starts or
+// stops it.
+func (p *Pool) recoverInstance(inst *LSPInstance, policy RestartPolicy) {
+	for {
+		inst.mu.Lock()
+		if inst.State != LSPStateFailed {
+			inst.mu.Unlock()
+			return
+		}
+		if inst.restarts >= policy.MaxRetries {
+			inst.mu.Unlock()
+			inst.logf("giving up after %d restarts", policy.MaxRetries)
+			return
+		}
+		delay := policy.Backoff(inst.restarts)
+		inst.restarts++
+		attempt := inst.restarts
+		inst.mu.Unlock()
+
+		inst.logf("restarting in %s (attempt %d/%d)", delay, attempt, policy.MaxRetries)
+		time.Sleep(delay)
+
+		inst.mu.Lock()
+		if inst.State != LSPStateFailed {
+			inst.mu.Unlock()
+			return
+		}
+		err := p.start(context.Background(), inst, inst.initParams)
+		inst.mu.Unlock()
+
+		if err == nil {
+			inst.logf("restarted")
+			p.notifyRestart(inst)
+			return
+		}
+		inst.logf("restart failed: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package subprocess
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// fakeExecutor runs an in-memory LSP for every Execute call. The servers
+// answer initialize and shutdown and record the notifications they receive.
+// Requests for methods in hang are never answered; after a request for a
+// method in stall, the server stops reading its stdin.
+type fakeExecutor struct {
+	mu       sync.Mutex
+	servers  []*fakeServer
+	executed chan *fakeServer
+	hang     map[string]bool
+	stall    map[string]bool
+}
+
+func newFakeExecutor() *fakeExecutor {
+	return &fakeExecutor{executed: make(chan *fakeServer, 16)}
+}
+
+func (e *fakeExecutor) Build(ctx context.Context, flake, binary string) (string, error) {
+	return "/nix/store/fake-" + flake, nil
+}
+
+func (e *fakeExecutor) BuildStorePath(ctx context.Context, flake string) (string, error) {
+	return "/nix/store/fake-" + flake, nil
+}
+
+func (e *fakeExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	srv := &fakeServer{
+		stream:  jsonrpc.NewStream(serverR, serverW),
+		notes:   make(chan *jsonrpc.Message, 64),
+		done:    make(chan struct{}),
+		hang:    e.hang,
+		stall:   e.stall,
+		workDir: workDir,
+	}
+	srv.kill = func() {
+		srv.once.Do(func() {
+			serverW.Close()
+			clientW.Close()
+			close(srv.done)
+		})
+	}
+	go srv.run()
+
+	e.mu.Lock()
+	e.servers = append(e.servers, srv)
+	e.mu.Unlock()
+	e.executed <- srv
+
+	return &Process{
+		Stdin:  clientW,
+		Stdout: clientR,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		Wait: func() error {
+			<-srv.done
+			return nil
+		},
+		Kill: func() error {
+			srv.kill()
+			return nil
+		},
+	}, nil
+}
+
+type fakeServer struct {
+	stream  *jsonrpc.Stream
+	notes   chan *jsonrpc.Message
+	done    chan struct{}
+	once    sync.Once
+	kill    func()
+	hang    map[string]bool
+	stall   map[string]bool
+	workDir string
+}
+
+func (s *fakeServer) run() {
+	for {
+		msg, err := s.stream.Read()
+		if err != nil {
+			return
+		}
+		if msg.IsNotification() {
+			if msg.Method == lsp.MethodExit {
+				s.kill()
+				return
+			}
+			s.notes <- msg
+			continue
+		}
+		if s.stall[msg.Method] {
+			<-s.done
+			return
+		}
+		if s.hang[msg.Method] {
+			continue
+		}
+		var result any
+		if msg.Method == lsp.MethodInitialize {
+			result = map[string]any{"capabilities": map[string]any{}}
+		}
+		resp, _ := jsonrpc.NewResponse(*msg.ID, result)
+		s.stream.Write(resp)
+	}
+}
+
+// waitNote returns the next notification with the given method.
+func (s *fakeServer) waitNote(t *testing.T, method string) *jsonrpc.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-s.notes:
+			if msg.Method == method {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", method)
+			return nil
+		}
+	}
+}
+
+func TestRestartPolicy_Backoff(t *testing.T) {
+	rp := RestartPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for n, w := range want {
+		if got := rp.Backoff(n); got != w {
+			t.Errorf("Backoff(%d) = %v, want %v", n, got, w)
+		}
+	}
+}
+
+func TestPool_RestartsCrashedInstance(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.SetRestartPolicy(RestartPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, ResetAfter: time.Minute})
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+
+	restarted := make(chan *LSPInstance, 1)
+	pool.OnRestart(func(inst *LSPInstance) { restarted <- inst })
+
+	root := lsp.URIFromPath("/src/a")
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{RootURI: &root})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	first := <-executor.executed
+	if err := inst.EnsureWorkspaceFolder("/src/b"); err != nil {
+		t.Fatalf("EnsureWorkspaceFolder: %v", err)
+	}
+
+	first.kill()
+
+	second := <-executor.executed
+	select {
+	case got := <-restarted:
+		if got != inst {
+			t.Error("restart handler called with a different instance")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("instance was not restarted")
+	}
+
+	note := second.waitNote(t, lsp.MethodWorkspaceDidChangeFolders)
+	if !strings.Contains(string(note.Params), "/src/b") {
+		t.Errorf("expected /src/b to be re-added, got %s", note.Params)
+	}
+
+	if status := pool.Status(); status[0].State != "running" || status[0].Restarts != 1 {
+		t.Errorf("unexpected status after restart: %+v", status[0])
+	}
+}
+
+func TestPool_StopCancelsRestart(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.SetRestartPolicy(RestartPolicy{MaxRetries: 3, InitialBackoff: 200 * time.Millisecond, MaxBackoff: time.Second, ResetAfter: time.Minute})
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+
+	if _, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{}); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	first := <-executor.executed
+	first.kill()
+
+	// Wait for the crash to be noticed, then stop during the backoff.
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Status()[0].State != "failed" {
+		if time.Now().After(deadline) {
+			t.Fatal("crash not detected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	pool.Stop("gopls")
+
+	select {
+	case <-executor.executed:
+		t.Error("stopped instance was restarted")
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestPool_OnStop(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.SetRestartPolicy(RestartPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, ResetAfter: time.Minute})
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls"})
+
+	stopped := make(chan *LSPInstance, 4)
+	pool.OnStop(func(inst *LSPInstance) { stopped <- inst })
+	restarted := make(chan struct{}, 1)
+	pool.OnRestart(func(*LSPInstance) { restarted <- struct{}{} })
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	first := <-executor.executed
+
+	// A crash counts as a stop before the instance is restarted.
+	first.kill()
+	select {
+	case got := <-stopped:
+		if got != inst {
+			t.Error("stop handler called with a different instance")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop handler not called after a crash")
+	}
+	select {
+	case <-restarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("instance was not restarted")
+	}
+
+	pool.Stop("gopls")
+	pool.Stop("gopls")
+	if len(stopped) != 1 {
+		t.Errorf("expected one stop after two Stop calls, got %d", len(stopped))
+	}
+}
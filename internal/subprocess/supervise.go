@@ -0,0 +1,260 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+const superviseInterval = 10 * time.Second
+
+// activity records what an instance is being used for, so idle instances
+// can be told apart from ones with requests in flight or documents open.
+type activity struct {
+	mu       sync.Mutex
+	lastUsed time.Time
+	inflight int
+	docs     map[lsp.DocumentURI]bool
+}
+
+func (a *activity) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastUsed = time.Now()
+	a.inflight = 0
+	a.docs = make(map[lsp.DocumentURI]bool)
+}
+
+func (a *activity) begin() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastUsed = time.Now()
+	a.inflight++
+}
+
+func (a *activity) end() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastUsed = time.Now()
+	a.inflight--
+}
+
+// notified records a notification sent to the instance, tracking which
+// documents it has open. Closing a document does not count as use.
+func (a *activity) notified(method string, params any) {
+	var uri lsp.DocumentURI
+	if method == lsp.MethodTextDocumentDidOpen || method == lsp.MethodTextDocumentDidClose {
+		uri = notificationURI(params)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if method != lsp.MethodTextDocumentDidClose {
+		a.lastUsed = time.Now()
+	}
+
+	if uri == "" {
+		return
+	}
+	if a.docs == nil {
+		a.docs = make(map[lsp.DocumentURI]bool)
+	}
+	if method == lsp.MethodTextDocumentDidOpen {
+		a.docs[uri] = true
+	} else {
+		delete(a.docs, uri)
+	}
+}
+
+func (a *activity) last() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastUsed
+}
+
+func (a *activity) openDocuments() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.docs)
+}
+
+// idleFor returns how long the instance has been idle, or zero if it has
+// requests in flight or documents open.
+func (a *activity) idleFor() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.inflight > 0 || len(a.docs) > 0 {
+		return 0
+	}
+	return time.Since(a.lastUsed)
+}
+
+// unusedFor returns how long ago the instance was last sent a request or
+// notification, or zero if it has requests in flight. Open documents are
+// not counted.
+func (a *activity) unusedFor() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.inflight > 0 {
+		return 0
+	}
+	return time.Since(a.lastUsed)
+}
+
+func notificationURI(params any) lsp.DocumentURI {
+	var raw []byte
+	switch p := params.(type) {
+	case json.RawMessage:
+		raw = p
+	default:
+		var err error
+		if raw, err = json.Marshal(params); err != nil {
+			return ""
+		}
+	}
+
+	var doc struct {
+		TextDocument struct {
+			URI lsp.DocumentURI `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return ""
+	}
+	return doc.TextDocument.URI
+}
+
+// Supervise enforces the hang timeout, idle timeout and memory limit of
+// running instances until ctx is done.
+func (p *Pool) Supervise(ctx context.Context) {
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.superviseOnce(ctx)
+		}
+	}
+}
+
+func (p *Pool) superviseOnce(ctx context.Context) {
+	for _, inst := range p.Running() {
+		if inst.HangTimeout > 0 && p.checkLiveness(inst) {
+			continue
+		}
+
+		if inst.IdleTimeout > 0 {
+			if idle := inst.activity.idleFor(); idle >= inst.IdleTimeout {
+				inst.logf("stopping after %s idle", idle.Round(time.Second))
+				p.stopInstance(inst)
+				continue
+			}
+		}
+
+		if inst.MaxMemory > 0 {
+			inst.mu.RLock()
+			proc := inst.Process
+			inst.mu.RUnlock()
+			if proc == nil || proc.Pid <= 0 {
+				continue
+			}
+
+			rss, err := readRSS(proc.Pid)
+			if err != nil || rss <= inst.MaxMemory {
+				continue
+			}
+
+			inst.logf("restarting, RSS %d MiB over limit of %d MiB", rss>>20, inst.MaxMemory>>20)
+			p.restart(ctx, inst)
+		}
+	}
+}
+
+// restart stops inst and starts it again with the parameters it was last
+// started with, replaying open documents through the restart handlers.
+func (p *Pool) restart(ctx context.Context, inst *LSPInstance) {
+	inst.mu.RLock()
+	initParams := inst.initParams
+	inst.mu.RUnlock()
+
+	p.stopInstance(inst)
+
+	restarted, err := p.ensureRunning(ctx, inst, initParams)
+	if err != nil {
+		inst.logf("restart failed: %v", err)
+		return
+	}
+	if restarted {
+		p.notifyRestart(inst)
+	}
+}
+
+// readRSS returns the resident set size of pid in bytes.
+func readRSS(pid int) (int64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			break
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb << 10, nil
+	}
+	return 0, fmt.Errorf("no VmRSS in /proc/%d/status", pid)
+}
+
+// clockTicks is the unit of the CPU times in /proc/<pid>/stat (USER_HZ).
+const clockTicks = 100
+
+// readCPUTime returns the CPU time pid and its reaped children have used.
+func readCPUTime(pid int) (time.Duration, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name may contain spaces; fields resume after its ')'.
+	i := strings.LastIndex(string(data), ")")
+	if i < 0 {
+		return 0, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	fields := strings.Fields(string(data)[i+1:])
+	if len(fields) < 15 {
+		return 0, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+
+	// utime, stime, cutime and cstime are fields 14 to 17 of the line.
+	var ticks int64
+	for _, field := range fields[11:15] {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * time.Second / clockTicks, nil
+}
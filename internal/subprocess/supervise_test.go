@@ -0,0 +1,108 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestPool_SuperviseStopsIdleInstance(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", IdleTimeout: time.Millisecond})
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	open := json.RawMessage(`{"textDocument":{"uri":"file:///a.go","languageId":"go","version":1,"text":""}}`)
+	if err := inst.Notify(lsp.MethodTextDocumentDidOpen, open); err != nil {
+		t.Fatalf("didOpen: %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	pool.superviseOnce(context.Background())
+	if st := pool.Status()[0]; st.State != "running" || st.OpenDocuments != 1 {
+		t.Fatalf("instance with an open document should keep running: %+v", st)
+	}
+
+	if err := inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: "file:///a.go"},
+	}); err != nil {
+		t.Fatalf("didClose: %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	pool.superviseOnce(context.Background())
+	if st := pool.Status()[0]; st.State != "stopped" {
+		t.Errorf("expected idle instance to be stopped, got %+v", st)
+	}
+}
+
+func TestLSPInstance_UnusedWithOpenDocument(t *testing.T) {
+	executor := newFakeExecutor()
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", IdleTimeout: 5 * time.Millisecond})
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	open := json.RawMessage(`{"textDocument":{"uri":"file:///a.go","languageId":"go","version":1,"text":""}}`)
+	if err := inst.Notify(lsp.MethodTextDocumentDidOpen, open); err != nil {
+		t.Fatalf("didOpen: %v", err)
+	}
+	if inst.Unused() {
+		t.Fatal("instance should not be unused right after a notification")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if !inst.Unused() {
+		t.Fatal("instance with only an open document should become unused")
+	}
+
+	if err := inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: "file:///a.go"},
+	}); err != nil {
+		t.Fatalf("didClose: %v", err)
+	}
+
+	pool.superviseOnce(context.Background())
+	if st := pool.Status()[0]; st.State != "stopped" {
+		t.Errorf("closing the last document should not reset the idle time: %+v", st)
+	}
+}
+
+func TestReadRSS(t *testing.T) {
+	if _, err := os.Stat("/proc/self/status"); err != nil {
+		t.Skip("no /proc on this system")
+	}
+
+	rss, err := readRSS(os.Getpid())
+	if err != nil {
+		t.Fatalf("readRSS: %v", err)
+	}
+	if rss <= 0 {
+		t.Errorf("expected positive RSS, got %d", rss)
+	}
+}
+
+func TestCPUMeter(t *testing.T) {
+	var m cpuMeter
+	start := time.Now()
+	m.reset(start)
+
+	if got := m.sample(500*time.Millisecond, start.Add(time.Second)); got != 50 {
+		t.Errorf("first sample = %v, want 50", got)
+	}
+	if got := m.sample(2500*time.Millisecond, start.Add(2*time.Second)); got != 200 {
+		t.Errorf("second sample = %v, want 200", got)
+	}
+}
@@ -0,0 +1,199 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport is how lux exchanges JSON-RPC with a language server.
+type Transport string
+
+const (
+	TransportStdio  Transport = "stdio"
+	TransportTCP    Transport = "tcp"
+	TransportSocket Transport = "socket"
+)
+
+// Placeholders in a server's args and env that are replaced with the port
+// or socket path lux wants it to listen on.
+const (
+	PortPlaceholder   = "{port}"
+	SocketPlaceholder = "{socket}"
+)
+
+// connectTimeout bounds how long lux waits for a launched server to start
+// listening.
+var connectTimeout = 10 * time.Second
+
+func (t Transport) network() string {
+	switch t {
+	case TransportTCP:
+		return "tcp"
+	case TransportSocket:
+		return "unix"
+	default:
+		return ""
+	}
+}
+
+// listenAddress picks an address for a launched server to listen on and
+// returns it with the value its placeholder is replaced by. cleanup removes
+// whatever was created for it.
+func listenAddress(t Transport) (addr, value string, cleanup func(), err error) {
+	switch t {
+	case TransportTCP:
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", "", nil, fmt.Errorf("finding a free port: %w", err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), strconv.Itoa(port), func() {}, nil
+	case TransportSocket:
+		dir, err := os.MkdirTemp("", "lux-lsp-")
+		if err != nil {
+			return "", "", nil, fmt.Errorf("creating socket directory: %w", err)
+		}
+		path := filepath.Join(dir, "server.sock")
+		return path, path, func() { os.RemoveAll(dir) }, nil
+	default:
+		return "", "", nil, fmt.Errorf("transport %q does not listen", t)
+	}
+}
+
+// withListenAddress replaces the transport's placeholder in args and env
+// values with value.
+func withListenAddress(t Transport, value string, args []string, env map[string]string) ([]string, map[string]string) {
+	placeholder := PortPlaceholder
+	if t == TransportSocket {
+		placeholder = SocketPlaceholder
+	}
+
+	outArgs := make([]string, len(args))
+	for i, arg := range args {
+		outArgs[i] = strings.ReplaceAll(arg, placeholder, value)
+	}
+
+	var outEnv map[string]string
+	if env != nil {
+		outEnv = make(map[string]string, len(env))
+		for k, v := range env {
+			outEnv[k] = strings.ReplaceAll(v, placeholder, value)
+		}
+	}
+	return outArgs, outEnv
+}
+
+// dialServer connects to a server at addr, retrying until it accepts
+// connections or ctx ends.
+func dialServer(ctx context.Context, t Transport, addr string) (net.Conn, error) {
+	var d net.Dialer
+	for {
+		conn, err := d.DialContext(ctx, t.network(), addr)
+		if err == nil {
+			return conn, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// connectProcess waits for a launched server to listen on addr and returns
+// a Process speaking to it over that connection. The server's own stdout is
+// ordinary output then, so it is merged into Stderr and logged with it.
+func connectProcess(ctx context.Context, name string, t Transport, addr string, proc *Process, cleanup func()) (*Process, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	conn, err := dialServer(dialCtx, t, addr)
+	if err != nil {
+		proc.Kill()
+		proc.Wait()
+		cleanup()
+		return nil, err
+	}
+
+	return &Process{
+		Stdin:  conn,
+		Stdout: conn,
+		Stderr: mergeLines(proc.Stdout, proc.Stderr),
+		Pid:    proc.Pid,
+		Wait: func() error {
+			err := proc.Wait()
+			conn.Close()
+			proc.Stdin.Close()
+			cleanup()
+			return err
+		},
+		Kill: func() error {
+			conn.Close()
+			return proc.Kill()
+		},
+	}, nil
+}
+
+// mergeLines interleaves the output of a and b line by line into one
+// reader, which ends once both do.
+func mergeLines(a, b io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	copyLines := func(r io.Reader) {
+		defer wg.Done()
+		br := bufio.NewReader(r)
+		for {
+			// A line longer than the buffer is passed on in pieces.
+			line, err := br.ReadSlice('\n')
+			if len(line) > 0 {
+				mu.Lock()
+				pw.Write(line)
+				mu.Unlock()
+			}
+			if err != nil && err != bufio.ErrBufferFull {
+				return
+			}
+		}
+	}
+
+	wg.Add(2)
+	go copyLines(a)
+	go copyLines(b)
+	go func() {
+		wg.Wait()
+		pw.Close()
+	}()
+	return pr
+}
+
+// attachProcess connects to a server lux did not start. Ending the Process
+// only closes the connection.
+func attachProcess(ctx context.Context, t Transport, addr string) (*Process, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	conn, err := dialServer(dialCtx, t, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Process{
+		Stdin:  conn,
+		Stdout: conn,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		Wait:   conn.Close,
+		Kill:   conn.Close,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package subprocess
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// serveLSP answers initialize and shutdown on conn and reports every method
+// it receives until exit or the connection closes.
+func serveLSP(conn net.Conn, methods chan<- string) {
+	defer close(methods)
+	defer conn.Close()
+	stream := jsonrpc.NewStream(conn, conn)
+	for {
+		msg, err := stream.Read()
+		if err != nil {
+			return
+		}
+		methods <- msg.Method
+		if msg.Method == lsp.MethodExit {
+			return
+		}
+		if !msg.IsRequest() {
+			continue
+		}
+		var result any
+		if msg.Method == lsp.MethodInitialize {
+			result = map[string]any{"capabilities": map[string]any{}}
+		}
+		resp, _ := jsonrpc.NewResponse(*msg.ID, result)
+		stream.Write(resp)
+	}
+}
+
+func TestWithListenAddress(t *testing.T) {
+	args, env := withListenAddress(TransportTCP, "4711", []string{"--port={port}", "-v"}, map[string]string{"PORT": "{port}"})
+	if strings.Join(args, " ") != "--port=4711 -v" || env["PORT"] != "4711" {
+		t.Errorf("unexpected substitution: %v %v", args, env)
+	}
+
+	args, _ = withListenAddress(TransportSocket, "/tmp/s.sock", []string{"--pipe", "{socket}", "{port}"}, nil)
+	if strings.Join(args, " ") != "--pipe /tmp/s.sock {port}" {
+		t.Errorf("unexpected socket substitution: %v", args)
+	}
+}
+
+func TestPool_AttachesToRunningServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	methods := make(chan string, 16)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		serveLSP(conn, methods)
+	}()
+
+	pool := NewPool(newFakeExecutor(), func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "godot", Transport: TransportTCP, Address: l.Addr().String()})
+
+	if _, err := pool.GetOrStart(context.Background(), "godot", initParamsFor("/src/game")); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	if status := pool.Status(); status[0].State != "running" || status[0].Address != l.Addr().String() {
+		t.Errorf("unexpected status: %+v", status[0])
+	}
+
+	pool.Stop("godot")
+
+	var got []string
+	for m := range methods {
+		got = append(got, m)
+	}
+	if strings.Join(got, " ") != "initialize initialized" {
+		t.Errorf("an attached server should only be disconnected from, got %v", got)
+	}
+}
+
+// socketExecutor starts an in-process server listening on the socket path
+// it is given in place of {socket}.
+type socketExecutor struct {
+	fakeExecutor
+	methods chan string
+}
+
+func (e *socketExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*Process, error) {
+	l, err := net.Listen("unix", args[1])
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		serveLSP(conn, e.methods)
+		close(done)
+	}()
+
+	return &Process{
+		Stdin:  nopWriteCloser{io.Discard},
+		Stdout: io.NopCloser(strings.NewReader("listening\n")),
+		Stderr: io.NopCloser(strings.NewReader("warming up\n")),
+		Wait: func() error {
+			<-done
+			return nil
+		},
+		Kill: func() error { return l.Close() },
+	}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestPool_LaunchesSocketServer(t *testing.T) {
+	executor := &socketExecutor{methods: make(chan string, 16)}
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.Register(LSPSpec{Name: "pyright", Flake: "nixpkgs#pyright", Args: []string{"--socket", SocketPlaceholder}, Transport: TransportSocket})
+
+	if _, err := pool.GetOrStart(context.Background(), "pyright", initParamsFor("/src/app")); err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	select {
+	case m := <-executor.methods:
+		if m != lsp.MethodInitialize {
+			t.Errorf("expected initialize first, got %s", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server received nothing over the socket")
+	}
+
+	// With the protocol on the socket, stdout is logged like stderr.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		logged := make(map[string]bool)
+		entries, _ := pool.Logs("pyright")
+		for _, e := range entries {
+			if e.Source == LogSourceStderr {
+				logged[e.Text] = true
+			}
+		}
+		if logged["listening"] && logged["warming up"] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server output missing from the log: %+v", entries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pool.Stop("pyright")
+}
@@ -0,0 +1,56 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// probeMethod is the request sent to check that a server still answers.
+// Servers must reply to unknown $/ requests with MethodNotFound, and any
+// reply counts.
+const probeMethod = "$/lux/ping"
+
+// checkLiveness probes inst when a probe is due and, once a request has
+// waited HangTimeout for its response, marks inst unhealthy, fails the
+// requests waiting on it and kills the process so crash recovery restarts
+// it. It reports whether inst was killed. Only the supervisor calls it.
+func (p *Pool) checkLiveness(inst *LSPInstance) bool {
+	inst.mu.RLock()
+	conn, proc := inst.Conn, inst.Process
+	inst.mu.RUnlock()
+	if conn == nil {
+		return false
+	}
+
+	method, age, ok := conn.Oldest()
+	if !ok {
+		if inst.ProbeInterval > 0 && time.Since(inst.lastProbe) >= inst.ProbeInterval {
+			inst.lastProbe = time.Now()
+			go conn.Call(context.Background(), probeMethod, nil)
+		}
+		return false
+	}
+	if age < inst.HangTimeout {
+		return false
+	}
+
+	err := fmt.Errorf("%s is unresponsive: no response to %s for %s", inst.Key, method, age.Round(time.Second))
+	inst.logf("unhealthy, no response to %s for %s; killing", method, age.Round(time.Second))
+
+	// Waiting calls hold the instance's read lock, and so do writes blocked
+	// on a server that stopped reading its stdin. They are failed, and the
+	// process killed so its pipes break, before the lock is taken.
+	conn.Fail(err)
+	if proc != nil {
+		proc.Kill()
+	}
+
+	inst.mu.Lock()
+	if inst.Conn == conn && inst.State == LSPStateRunning {
+		inst.State = LSPStateUnhealthy
+		inst.Error = err
+	}
+	inst.mu.Unlock()
+	return true
+}
@@ -0,0 +1,159 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func newWatchedPool(t *testing.T, spec LSPSpec, hang ...string) (*Pool, *fakeExecutor, *LSPInstance) {
+	t.Helper()
+	executor := newFakeExecutor()
+	executor.hang = make(map[string]bool)
+	for _, method := range hang {
+		executor.hang[method] = true
+	}
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.SetRestartPolicy(RestartPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, ResetAfter: time.Minute})
+	pool.Register(spec)
+
+	inst, err := pool.GetOrStart(context.Background(), spec.Name, &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	<-executor.executed
+	return pool, executor, inst
+}
+
+func waitExecuted(t *testing.T, executor *fakeExecutor) {
+	t.Helper()
+	select {
+	case <-executor.executed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("instance was not restarted")
+	}
+}
+
+func TestWatchdog_RestartsHungServer(t *testing.T) {
+	pool, executor, inst := newWatchedPool(t,
+		LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", HangTimeout: 20 * time.Millisecond},
+		lsp.MethodTextDocumentHover)
+
+	callErr := make(chan error, 1)
+	go func() {
+		_, err := inst.Call(context.Background(), lsp.MethodTextDocumentHover, nil)
+		callErr <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, age, ok := inst.Conn.Oldest(); ok && age >= 20*time.Millisecond {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hover never became outstanding")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	pool.superviseOnce(context.Background())
+
+	select {
+	case err := <-callErr:
+		if err == nil || !strings.Contains(err.Error(), "gopls is unresponsive") || !strings.Contains(err.Error(), lsp.MethodTextDocumentHover) {
+			t.Errorf("pending call failed with %v, want it to name the server and the stuck method", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending call was not failed")
+	}
+
+	waitExecuted(t, executor)
+}
+
+func TestWatchdog_ProbesQuietServer(t *testing.T) {
+	pool, executor, inst := newWatchedPool(t,
+		LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", HangTimeout: 20 * time.Millisecond, ProbeInterval: time.Millisecond},
+		probeMethod)
+
+	pool.superviseOnce(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		method, age, ok := inst.Conn.Oldest()
+		if ok && method == probeMethod && age >= 20*time.Millisecond {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("probe was not sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	pool.superviseOnce(context.Background())
+	waitExecuted(t, executor)
+}
+
+func TestWatchdog_AnsweredProbeKeepsServer(t *testing.T) {
+	pool, executor, inst := newWatchedPool(t,
+		LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", HangTimeout: 20 * time.Millisecond, ProbeInterval: time.Millisecond})
+
+	pool.superviseOnce(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	pool.superviseOnce(context.Background())
+
+	select {
+	case <-executor.executed:
+		t.Fatal("responsive server was restarted")
+	default:
+	}
+	if inst.IsFailed() {
+		t.Fatalf("responsive server failed: %v", inst.Error)
+	}
+}
+
+func TestWatchdog_KillsServerThatStoppedReading(t *testing.T) {
+	executor := newFakeExecutor()
+	executor.stall = map[string]bool{lsp.MethodTextDocumentHover: true}
+	pool := NewPool(executor, func(string) jsonrpc.Handler { return nil })
+	pool.SetRestartPolicy(RestartPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, ResetAfter: time.Minute})
+	pool.Register(LSPSpec{Name: "gopls", Flake: "nixpkgs#gopls", HangTimeout: 20 * time.Millisecond})
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+	<-executor.executed
+
+	go inst.Call(context.Background(), lsp.MethodTextDocumentHover, nil)
+	time.Sleep(50 * time.Millisecond)
+
+	// The server no longer reads, so this write blocks holding the
+	// instance's read lock.
+	notified := make(chan error, 1)
+	go func() {
+		notified <- inst.Notify(lsp.MethodTextDocumentDidChange, map[string]any{})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	supervised := make(chan struct{})
+	go func() {
+		pool.superviseOnce(context.Background())
+		close(supervised)
+	}()
+	select {
+	case <-supervised:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor deadlocked on a server that stopped reading")
+	}
+
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked write was not released")
+	}
+	waitExecuted(t, executor)
+}
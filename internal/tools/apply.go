@@ -0,0 +1,436 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/command"
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+// ContentHash identifies the content of a document, so an edit computed
+// against one content is not applied to another.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// fileState is a file as an edit sees it while being planned.
+type fileState struct {
+	uri     lsp.DocumentURI
+	exists  bool
+	content string
+	mode    fs.FileMode
+
+	// The file as it was on disk before the edit.
+	origExists  bool
+	origContent string
+	origMode    fs.FileMode
+
+	edits int
+}
+
+func (f *fileState) changed() bool {
+	return f.exists != f.origExists || f.content != f.origContent
+}
+
+// editPlan is a WorkspaceEdit resolved against the filesystem: the final
+// state of every file it touches, computed in memory before anything is
+// written.
+type editPlan struct {
+	tracker DocumentTracker
+	files   map[string]*fileState
+	dirs    []string // directories deleted as a whole
+	summary []string
+}
+
+func newEditPlan(tracker DocumentTracker) *editPlan {
+	return &editPlan{tracker: tracker, files: make(map[string]*fileState)}
+}
+
+// file returns the planned state of the file at uri, loading it from disk
+// the first time.
+func (p *editPlan) file(uri lsp.DocumentURI) (*fileState, error) {
+	path := uri.Path()
+	if path == "" {
+		return nil, fmt.Errorf("cannot edit %s: not a file URI", uri)
+	}
+	if f, ok := p.files[path]; ok {
+		return f, nil
+	}
+
+	f := &fileState{uri: uri, mode: 0644}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, fmt.Errorf("%s is a directory", path)
+	case err == nil:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f.exists, f.content, f.mode = true, string(data), info.Mode().Perm()
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	f.origExists, f.origContent, f.origMode = f.exists, f.content, f.mode
+	p.files[path] = f
+	return f, nil
+}
+
+// edit applies text edits to the file at uri. version is the document
+// version the edits were computed against, if the server named one.
+func (p *editPlan) edit(uri lsp.DocumentURI, version *int, edits []lsp.TextEdit) error {
+	f, err := p.file(uri)
+	if err != nil {
+		return err
+	}
+	if !f.exists {
+		return fmt.Errorf("cannot edit %s: file does not exist", uri.Path())
+	}
+	if f.content == f.origContent {
+		if err := p.checkSynced(uri, f.content, version); err != nil {
+			return err
+		}
+	}
+
+	content, err := lsp.ApplyTextEdits(f.content, edits)
+	if err != nil {
+		return fmt.Errorf("editing %s: %w", uri.Path(), err)
+	}
+	f.content = content
+	f.edits += len(edits)
+	return nil
+}
+
+// checkSynced reports a conflict when the servers computed edits against a
+// different version or content of an open document than is on disk.
+func (p *editPlan) checkSynced(uri lsp.DocumentURI, content string, version *int) error {
+	if p.tracker == nil {
+		return nil
+	}
+	synced, hash, ok := p.tracker.Snapshot(uri)
+	if !ok {
+		return nil
+	}
+	if version != nil && *version != synced {
+		return fmt.Errorf("conflict: edit for %s is for version %d, but version %d is open", uri.Path(), *version, synced)
+	}
+	if hash != ContentHash(content) {
+		return fmt.Errorf("conflict: %s changed on disk since the language server last saw it", uri.Path())
+	}
+	return nil
+}
+
+func (p *editPlan) create(uri lsp.DocumentURI, opts lsp.FileChangeOptions) error {
+	f, err := p.file(uri)
+	if err != nil {
+		return err
+	}
+	if f.exists {
+		if opts.IgnoreIfExists && !opts.Overwrite {
+			return nil
+		}
+		if !opts.Overwrite {
+			return fmt.Errorf("cannot create %s: file exists", uri.Path())
+		}
+	}
+	f.exists, f.content = true, ""
+	p.summary = append(p.summary, "created "+uri.Path())
+	return nil
+}
+
+func (p *editPlan) rename(oldURI, newURI lsp.DocumentURI, opts lsp.FileChangeOptions) error {
+	if info, err := os.Stat(oldURI.Path()); err == nil && info.IsDir() {
+		return fmt.Errorf("cannot rename %s: renaming directories is not supported", oldURI.Path())
+	}
+	from, err := p.file(oldURI)
+	if err != nil {
+		return err
+	}
+	if !from.exists {
+		return fmt.Errorf("cannot rename %s: file does not exist", oldURI.Path())
+	}
+	to, err := p.file(newURI)
+	if err != nil {
+		return err
+	}
+	if to.exists {
+		if opts.IgnoreIfExists && !opts.Overwrite {
+			return nil
+		}
+		if !opts.Overwrite {
+			return fmt.Errorf("cannot rename %s to %s: target exists", oldURI.Path(), newURI.Path())
+		}
+	}
+
+	to.exists, to.content, to.mode = true, from.content, from.mode
+	from.exists, from.content = false, ""
+	p.summary = append(p.summary, fmt.Sprintf("renamed %s to %s", oldURI.Path(), newURI.Path()))
+	return nil
+}
+
+func (p *editPlan) remove(uri lsp.DocumentURI, opts lsp.FileChangeOptions) error {
+	path := uri.Path()
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 && !opts.Recursive {
+			return fmt.Errorf("cannot delete %s: directory is not empty", path)
+		}
+		p.dirs = append(p.dirs, path)
+		p.summary = append(p.summary, "deleted "+path)
+		return nil
+	}
+
+	f, err := p.file(uri)
+	if err != nil {
+		return err
+	}
+	if !f.exists {
+		if opts.IgnoreIfNotExists {
+			return nil
+		}
+		return fmt.Errorf("cannot delete %s: file does not exist", path)
+	}
+	f.exists, f.content = false, ""
+	p.summary = append(p.summary, "deleted "+path)
+	return nil
+}
+
+// add plans every change of edit, in order.
+func (p *editPlan) add(edit lsp.WorkspaceEdit) error {
+	if len(edit.DocumentChanges) > 0 {
+		for _, change := range edit.DocumentChanges {
+			var opts lsp.FileChangeOptions
+			if change.Options != nil {
+				opts = *change.Options
+			}
+
+			var err error
+			switch change.Kind {
+			case "":
+				if change.TextDocument == nil {
+					return fmt.Errorf("document change has neither kind nor textDocument")
+				}
+				err = p.edit(change.TextDocument.URI, change.TextDocument.Version, change.Edits)
+			case lsp.FileChangeCreate:
+				err = p.create(change.URI, opts)
+			case lsp.FileChangeRename:
+				err = p.rename(change.OldURI, change.NewURI, opts)
+			case lsp.FileChangeDelete:
+				err = p.remove(change.URI, opts)
+			default:
+				err = fmt.Errorf("unknown document change kind %q", change.Kind)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	uris := make([]lsp.DocumentURI, 0, len(edit.Changes))
+	for uri := range edit.Changes {
+		uris = append(uris, uri)
+	}
+	sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+	for _, uri := range uris {
+		if err := p.edit(uri, nil, edit.Changes[uri]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit writes the plan to disk. Each file is replaced atomically; if any
+// step fails, the steps already taken are undone, so the edit applies as a
+// whole or not at all.
+func (p *editPlan) commit() error {
+	var undo []func() error
+	var backups []string
+	rollback := func(err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				err = fmt.Errorf("%w (undoing failed: %v)", err, uerr)
+			}
+		}
+		return err
+	}
+
+	for _, dir := range p.dirs {
+		backup, err := os.MkdirTemp(filepath.Dir(dir), ".lux-delete-")
+		if err != nil {
+			return rollback(err)
+		}
+		moved := filepath.Join(backup, filepath.Base(dir))
+		if err := os.Rename(dir, moved); err != nil {
+			os.Remove(backup)
+			return rollback(err)
+		}
+		backups = append(backups, backup)
+		undo = append(undo, func() error {
+			if err := os.Rename(moved, dir); err != nil {
+				return err
+			}
+			return os.Remove(backup)
+		})
+	}
+
+	for _, path := range p.paths() {
+		f := p.files[path]
+		if !f.changed() {
+			continue
+		}
+
+		var err error
+		if f.exists {
+			err = writeFileAtomic(path, f.content, f.mode)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return rollback(err)
+		}
+		undo = append(undo, func() error {
+			if f.origExists {
+				return writeFileAtomic(path, f.origContent, f.origMode)
+			}
+			return os.Remove(path)
+		})
+	}
+
+	for _, backup := range backups {
+		os.RemoveAll(backup)
+	}
+	return nil
+}
+
+func (p *editPlan) paths() []string {
+	paths := make([]string, 0, len(p.files))
+	for path := range p.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sync brings open documents in line with what was written: changed ones
+// are re-read by their servers, removed ones are closed.
+func (p *editPlan) sync(ctx context.Context) error {
+	if p.tracker == nil {
+		return nil
+	}
+	for _, path := range p.paths() {
+		f := p.files[path]
+		if !f.changed() || !p.tracker.IsOpen(f.uri) {
+			continue
+		}
+		var err error
+		if f.exists {
+			err = p.tracker.Open(ctx, f.uri)
+		} else {
+			err = p.tracker.Close(f.uri)
+		}
+		if err != nil {
+			return fmt.Errorf("syncing %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// describe summarizes what the plan changed.
+func (p *editPlan) describe() string {
+	var sb strings.Builder
+	files, edits := 0, 0
+	for _, path := range p.paths() {
+		f := p.files[path]
+		if f.edits == 0 {
+			continue
+		}
+		files++
+		edits += f.edits
+		sb.WriteString(fmt.Sprintf("%s: %d edit(s)\n", path, f.edits))
+	}
+	for _, line := range p.summary {
+		sb.WriteString(line + "\n")
+	}
+	if sb.Len() == 0 {
+		return "No changes to apply"
+	}
+	return fmt.Sprintf("Applied %d edit(s) to %d file(s)\n", edits, files) + strings.TrimRight(sb.String(), "\n")
+}
+
+// applyResult applies edit and reports the outcome as a tool result.
+func (b *Bridge) applyResult(ctx context.Context, edit lsp.WorkspaceEdit) *command.Result {
+	text, err := b.applyWorkspaceEdit(ctx, edit)
+	if err != nil {
+		return command.TextErrorResult(err.Error())
+	}
+	return command.TextResult(text)
+}
+
+// applyWorkspaceEdit writes edit to disk and syncs the open documents it
+// touched, returning a summary of what changed.
+func (b *Bridge) applyWorkspaceEdit(ctx context.Context, edit lsp.WorkspaceEdit) (string, error) {
+	plan, err := b.writeWorkspaceEdit(edit)
+	if err != nil {
+		return "", err
+	}
+	if err := plan.sync(ctx); err != nil {
+		return "", err
+	}
+	return plan.describe(), nil
+}
+
+// writeWorkspaceEdit writes edit to disk and returns the plan, whose open
+// documents are still to be synced.
+func (b *Bridge) writeWorkspaceEdit(edit lsp.WorkspaceEdit) (*editPlan, error) {
+	plan := newEditPlan(b.docMgr)
+	if err := plan.add(edit); err != nil {
+		return nil, err
+	}
+	if err := plan.commit(); err != nil {
+		return nil, fmt.Errorf("writing edit: %w", err)
+	}
+	return plan, nil
+}
+
+func writeFileAtomic(path, content string, mode fs.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".lux-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+type fakeTracker struct {
+	open   map[lsp.DocumentURI]string // uri to the content servers were sent
+	opened []lsp.DocumentURI
+	closed []lsp.DocumentURI
+}
+
+func (f *fakeTracker) IsOpen(uri lsp.DocumentURI) bool {
+	_, ok := f.open[uri]
+	return ok
+}
+
+func (f *fakeTracker) Open(_ context.Context, uri lsp.DocumentURI) error {
+	f.opened = append(f.opened, uri)
+	return nil
+}
+
+func (f *fakeTracker) Close(uri lsp.DocumentURI) error {
+	f.closed = append(f.closed, uri)
+	return nil
+}
+
+func (f *fakeTracker) Snapshot(uri lsp.DocumentURI) (int, string, bool) {
+	content, ok := f.open[uri]
+	if !ok {
+		return 0, "", false
+	}
+	return 2, ContentHash(content), true
+}
+
+func writeFile(t *testing.T, path, content string) lsp.DocumentURI {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return lsp.URIFromPath(path)
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func replace(line, start, end int, text string) lsp.TextEdit {
+	return lsp.TextEdit{
+		Range:   lsp.Range{Start: lsp.Position{Line: line, Character: start}, End: lsp.Position{Line: line, Character: end}},
+		NewText: text,
+	}
+}
+
+func applyPlan(tracker DocumentTracker, edit lsp.WorkspaceEdit) (*editPlan, error) {
+	plan := newEditPlan(tracker)
+	if err := plan.add(edit); err != nil {
+		return nil, err
+	}
+	if err := plan.commit(); err != nil {
+		return nil, err
+	}
+	return plan, plan.sync(context.Background())
+}
+
+func TestEditPlan_Changes(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, filepath.Join(dir, "a.go"), "func old() {}\n")
+	b := writeFile(t, filepath.Join(dir, "b.go"), "old()\n")
+	tracker := &fakeTracker{open: map[lsp.DocumentURI]string{a: "func old() {}\n"}}
+
+	plan, err := applyPlan(tracker, lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+		a: {replace(0, 5, 8, "renamed")},
+		b: {replace(0, 0, 3, "renamed")},
+	}})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	if got := readFile(t, a.Path()); got != "func renamed() {}\n" {
+		t.Errorf("a.go = %q", got)
+	}
+	if got := readFile(t, b.Path()); got != "renamed()\n" {
+		t.Errorf("b.go = %q", got)
+	}
+	if len(tracker.opened) != 1 || tracker.opened[0] != a {
+		t.Errorf("synced %v, want only the open a.go", tracker.opened)
+	}
+	if got := plan.describe(); !strings.HasPrefix(got, "Applied 2 edit(s) to 2 file(s)") {
+		t.Errorf("describe = %q", got)
+	}
+}
+
+func TestEditPlan_Conflicts(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, filepath.Join(dir, "a.go"), "changed on disk\n")
+	tracker := &fakeTracker{open: map[lsp.DocumentURI]string{a: "as the server saw it\n"}}
+
+	_, err := applyPlan(tracker, lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+		a: {replace(0, 0, 7, "edited")},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "conflict") {
+		t.Errorf("content mismatch: err = %v, want a conflict", err)
+	}
+
+	tracker.open[a] = "changed on disk\n"
+	version := 1
+	_, err = applyPlan(tracker, lsp.WorkspaceEdit{DocumentChanges: []lsp.DocumentChange{{
+		TextDocument: &lsp.OptionalVersionedTextDocumentIdentifier{URI: a, Version: &version},
+		Edits:        []lsp.TextEdit{replace(0, 0, 7, "edited")},
+	}}})
+	if err == nil || !strings.Contains(err.Error(), "version 1") {
+		t.Errorf("version mismatch: err = %v, want a conflict", err)
+	}
+
+	if got := readFile(t, a.Path()); got != "changed on disk\n" {
+		t.Errorf("a.go was written despite the conflict: %q", got)
+	}
+}
+
+func TestEditPlan_FileOperations(t *testing.T) {
+	dir := t.TempDir()
+	old := writeFile(t, filepath.Join(dir, "old.go"), "package x\n")
+	gone := writeFile(t, filepath.Join(dir, "gone.go"), "package x\n")
+	created := lsp.URIFromPath(filepath.Join(dir, "sub", "new.go"))
+	renamed := lsp.URIFromPath(filepath.Join(dir, "renamed.go"))
+	tracker := &fakeTracker{open: map[lsp.DocumentURI]string{old: "package x\n", gone: "package x\n"}}
+
+	_, err := applyPlan(tracker, lsp.WorkspaceEdit{DocumentChanges: []lsp.DocumentChange{
+		{Kind: lsp.FileChangeCreate, URI: created},
+		{TextDocument: &lsp.OptionalVersionedTextDocumentIdentifier{URI: created}, Edits: []lsp.TextEdit{replace(0, 0, 0, "package sub\n")}},
+		{Kind: lsp.FileChangeRename, OldURI: old, NewURI: renamed},
+		{TextDocument: &lsp.OptionalVersionedTextDocumentIdentifier{URI: renamed}, Edits: []lsp.TextEdit{replace(0, 8, 9, "y")}},
+		{Kind: lsp.FileChangeDelete, URI: gone},
+	}})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	if got := readFile(t, created.Path()); got != "package sub\n" {
+		t.Errorf("new.go = %q", got)
+	}
+	if got := readFile(t, renamed.Path()); got != "package y\n" {
+		t.Errorf("renamed.go = %q", got)
+	}
+	for _, uri := range []lsp.DocumentURI{old, gone} {
+		if _, err := os.Stat(uri.Path()); !os.IsNotExist(err) {
+			t.Errorf("%s still exists", uri.Path())
+		}
+	}
+	if len(tracker.closed) != 2 {
+		t.Errorf("closed %v, want gone.go and old.go", tracker.closed)
+	}
+}
+
+func TestEditPlan_RollsBackOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, filepath.Join(dir, "a", "a.go"), "aaa\n")
+	b := writeFile(t, filepath.Join(dir, "b", "b.go"), "bbb\n")
+
+	plan := newEditPlan(nil)
+	if err := plan.add(lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+		a: {replace(0, 0, 3, "AAA")},
+		b: {replace(0, 0, 3, "BBB")},
+	}}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	// Replace b's directory with a file so writing b.go fails after a.go
+	// was written.
+	if err := os.RemoveAll(filepath.Dir(b.Path())); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Dir(b.Path()), "")
+
+	if err := plan.commit(); err == nil {
+		t.Fatal("commit should fail")
+	}
+	if got := readFile(t, a.Path()); got != "aaa\n" {
+		t.Errorf("a.go = %q, want it restored", got)
+	}
+}
@@ -3,15 +3,14 @@ package tools
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/amarbel-llc/purse-first/libs/go-mcp/command"
-	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
 	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/formatter"
 	"github.com/amarbel-llc/lux/internal/lsp"
@@ -23,6 +22,11 @@ import (
 type DocumentTracker interface {
 	IsOpen(uri lsp.DocumentURI) bool
 	Open(ctx context.Context, uri lsp.DocumentURI) error
+	Close(uri lsp.DocumentURI) error
+
+	// Snapshot returns the version of an open document and the ContentHash
+	// of the text its servers were last sent.
+	Snapshot(uri lsp.DocumentURI) (version int, hash string, ok bool)
 }
 
 type Bridge struct {
@@ -32,6 +36,17 @@ type Bridge struct {
 	executor         subprocess.Executor
 	docMgr           DocumentTracker
 	progressReporter func(lspName, message string)
+
+	// execMu serializes command execution, so the workspace edits servers
+	// send back while a command runs are reported as its outcome.
+	execMu      sync.Mutex
+	editsMu     sync.Mutex
+	collecting  bool
+	serverEdits []string
+	// editPlans are the edits applied during a command whose open
+	// documents are synced once it returns: syncing can start a server,
+	// which waits for the call in flight on it.
+	editPlans []*editPlan
 }
 
 func NewBridge(pool *subprocess.Pool, router *server.Router, fmtRouter *formatter.Router, executor subprocess.Executor, progressReporter func(lspName, message string)) *Bridge {
@@ -63,6 +78,14 @@ func (b *Bridge) waitForLSPReady(ctx context.Context, inst *subprocess.LSPInstan
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
+	// A caller that passed a progress token gets each change of the
+	// server's progress; others get a log line every tick.
+	report := subprocess.ProgressFrom(ctx)
+	reported := make(map[string]bool)
+	if report != nil {
+		report(inst.Name+": waiting for indexing", nil)
+	}
+
 	for {
 		select {
 		case err := <-done:
@@ -72,6 +95,7 @@ func (b *Bridge) waitForLSPReady(ctx context.Context, inst *subprocess.LSPInstan
 			return err
 		case <-ticker.C:
 			active := inst.Progress.ActiveProgress()
+			current := make(map[string]bool, len(active))
 			for _, tok := range active {
 				logMsg := tok.Title
 				if tok.Message != "" {
@@ -81,67 +105,81 @@ func (b *Bridge) waitForLSPReady(ctx context.Context, inst *subprocess.LSPInstan
 					logMsg += fmt.Sprintf(" (%d%%)", *tok.Pct)
 				}
 				fmt.Fprintf(os.Stderr, "[lux] %s: %s\n", inst.Name, logMsg)
-				if b.progressReporter != nil {
+				current[logMsg] = true
+
+				switch {
+				case report != nil:
+					if !reported[logMsg] {
+						report(progressMessage(inst.Name, tok), tok.Pct)
+					}
+				case b.progressReporter != nil:
 					b.progressReporter(inst.Name, logMsg)
 				}
 			}
+			reported = current
 		}
 	}
 }
 
-func isRetryableLSPError(err error) bool {
-	var rpcErr *jsonrpc.Error
-	if errors.As(err, &rpcErr) {
-		return rpcErr.Code == 0 && strings.Contains(rpcErr.Message, "no views")
+func progressMessage(lspName string, tok subprocess.ProgressToken) string {
+	msg := lspName + ": " + tok.Title
+	if tok.Message != "" {
+		msg += ": " + tok.Message
 	}
-	return false
+	return msg
 }
 
-func (b *Bridge) callWithRetry(ctx context.Context, inst *subprocess.LSPInstance, fn func(*subprocess.LSPInstance) (json.RawMessage, error)) (json.RawMessage, error) {
-	const maxAttempts = 8
-	delay := 500 * time.Millisecond
-
-	for attempt := 1; ; attempt++ {
-		result, err := fn(inst)
-		if err == nil || !isRetryableLSPError(err) || attempt >= maxAttempts {
-			return result, err
-		}
+// withDocument routes uri to every LSP configured for its filetype, makes sure
+// the document is open in each of them, and runs fn against the servers that
+// should answer method. Results from several servers are merged.
+func (b *Bridge) withDocument(ctx context.Context, uri lsp.DocumentURI, method string, fn func(*subprocess.LSPInstance) (json.RawMessage, error)) (json.RawMessage, error) {
+	lspNames := b.router.RouteAllByURI(uri)
+	if len(lspNames) == 0 {
+		return nil, fmt.Errorf("no LSP configured for %s", uri)
+	}
 
-		fmt.Fprintf(os.Stderr, "[lux] retrying LSP call (attempt %d/%d, waiting %v): %v\n", attempt, maxAttempts, delay, err)
+	initParams := b.DefaultInitParams(uri)
+	projectRoot := b.ProjectRootForPath(uri.Path())
 
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(delay):
+	// The primary LSP must start; additional LSPs are best-effort.
+	var insts []*subprocess.LSPInstance
+	for i, lspName := range lspNames {
+		inst, err := b.pool.GetOrStart(ctx, lspName, initParams)
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("starting LSP %s: %w", lspName, err)
+			}
+			fmt.Fprintf(os.Stderr, "[lux] %s: skipping: %v\n", lspName, err)
+			continue
 		}
-
-		delay *= 2
-		if delay > 5*time.Second {
-			delay = 5 * time.Second
+		if err := inst.EnsureWorkspaceFolder(projectRoot); err != nil {
+			return nil, fmt.Errorf("adding workspace folder: %w", err)
 		}
+		insts = append(insts, inst)
 	}
-}
 
-func (b *Bridge) withDocument(ctx context.Context, uri lsp.DocumentURI, fn func(*subprocess.LSPInstance) (json.RawMessage, error)) (json.RawMessage, error) {
-	lspName := b.router.RouteByURI(uri)
-	if lspName == "" {
-		return nil, fmt.Errorf("no LSP configured for %s", uri)
+	// Wait for LSPs to finish indexing before making calls
+	var targets []*subprocess.LSPInstance
+	for _, inst := range subprocess.SelectForMethod(insts, method) {
+		if err := b.waitForLSPReady(ctx, inst); err != nil {
+			if inst == insts[0] {
+				return nil, fmt.Errorf("waiting for LSP %s readiness: %w", inst.Name, err)
+			}
+			fmt.Fprintf(os.Stderr, "[lux] %s: skipping: %v\n", inst.Name, err)
+			continue
+		}
+		targets = append(targets, inst)
 	}
-
-	initParams := b.DefaultInitParams(uri)
-	inst, err := b.pool.GetOrStart(ctx, lspName, initParams)
-	if err != nil {
-		return nil, fmt.Errorf("starting LSP %s: %w", lspName, err)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no LSP ready for %s", uri)
 	}
 
-	// Wait for LSP to finish indexing before making calls
-	if err := b.waitForLSPReady(ctx, inst); err != nil {
-		return nil, fmt.Errorf("waiting for LSP %s readiness: %w", lspName, err)
-	}
-
-	projectRoot := b.ProjectRootForPath(uri.Path())
-	if err := inst.EnsureWorkspaceFolder(projectRoot); err != nil {
-		return nil, fmt.Errorf("adding workspace folder: %w", err)
+	call := func(ctx context.Context, inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		result, err := fn(inst)
+		if err != nil {
+			return nil, err
+		}
+		return lsp.TagResolveData(method, inst.Key, result), nil
 	}
 
 	// Use DocumentManager for persistent tracking if available
@@ -151,7 +189,11 @@ func (b *Bridge) withDocument(ctx context.Context, uri lsp.DocumentURI, fn func(
 				return nil, fmt.Errorf("opening document: %w", err)
 			}
 		}
-		return b.callWithRetry(ctx, inst, fn)
+		results, err := subprocess.CallAll(ctx, targets, call)
+		if err != nil {
+			return nil, callError(ctx, method, err)
+		}
+		return lsp.MergeResults(method, results), nil
 	}
 
 	// Fallback: ephemeral open/close when no DocumentManager
@@ -162,28 +204,43 @@ func (b *Bridge) withDocument(ctx context.Context, uri lsp.DocumentURI, fn func(
 
 	langID := b.InferLanguageID(uri)
 
-	if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
-		TextDocument: lsp.TextDocumentItem{
-			URI:        uri,
-			LanguageID: langID,
-			Version:    1,
-			Text:       content,
-		},
-	}); err != nil {
-		return nil, fmt.Errorf("opening document: %w", err)
+	for _, inst := range insts {
+		if err := inst.Notify(lsp.MethodTextDocumentDidOpen, lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{
+				URI:        uri,
+				LanguageID: langID,
+				Version:    1,
+				Text:       content,
+			},
+		}); err != nil {
+			return nil, fmt.Errorf("opening document: %w", err)
+		}
+
+		defer func() {
+			inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
+				TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			})
+		}()
 	}
 
-	defer func() {
-		inst.Notify(lsp.MethodTextDocumentDidClose, lsp.DidCloseTextDocumentParams{
-			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
-		})
-	}()
+	results, err := subprocess.CallAll(ctx, targets, call)
+	if err != nil {
+		return nil, callError(ctx, method, err)
+	}
+	return lsp.MergeResults(method, results), nil
+}
 
-	return b.callWithRetry(ctx, inst, fn)
+// callError reports a cancelled tool call as such. The upstream connection
+// has already sent $/cancelRequest to the server by the time this runs.
+func callError(ctx context.Context, method string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s cancelled: %w", method, ctx.Err())
+	}
+	return err
 }
 
 func (b *Bridge) Hover(ctx context.Context, uri lsp.DocumentURI, line, character int) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentHover, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentHover, lsp.TextDocumentPositionParams{
 			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
 			Position:     lsp.Position{Line: line, Character: character},
@@ -209,7 +266,7 @@ func (b *Bridge) Hover(ctx context.Context, uri lsp.DocumentURI, line, character
 }
 
 func (b *Bridge) Definition(ctx context.Context, uri lsp.DocumentURI, line, character int) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentDefinition, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentDefinition, lsp.TextDocumentPositionParams{
 			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
 			Position:     lsp.Position{Line: line, Character: character},
@@ -229,7 +286,7 @@ func (b *Bridge) Definition(ctx context.Context, uri lsp.DocumentURI, line, char
 }
 
 func (b *Bridge) References(ctx context.Context, uri lsp.DocumentURI, line, character int, includeDecl bool) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentReferences, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentReferences, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 			"position":     lsp.Position{Line: line, Character: character},
@@ -250,7 +307,7 @@ func (b *Bridge) References(ctx context.Context, uri lsp.DocumentURI, line, char
 }
 
 func (b *Bridge) Completion(ctx context.Context, uri lsp.DocumentURI, line, character int) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentCompletion, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentCompletion, lsp.TextDocumentPositionParams{
 			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
 			Position:     lsp.Position{Line: line, Character: character},
@@ -269,12 +326,12 @@ func (b *Bridge) Completion(ctx context.Context, uri lsp.DocumentURI, line, char
 	return command.TextResult(text), nil
 }
 
-func (b *Bridge) Format(ctx context.Context, uri lsp.DocumentURI) (*command.Result, error) {
-	if result, handled := b.tryExternalFormat(ctx, uri); handled {
+func (b *Bridge) Format(ctx context.Context, uri lsp.DocumentURI, apply bool) (*command.Result, error) {
+	if result, handled := b.tryExternalFormat(ctx, uri, apply); handled {
 		return result, nil
 	}
 
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentFormatting, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentFormatting, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 			"options": map[string]any{
@@ -296,11 +353,15 @@ func (b *Bridge) Format(ctx context.Context, uri lsp.DocumentURI) (*command.Resu
 		return command.TextResult("No formatting changes needed"), nil
 	}
 
+	if apply {
+		return b.applyResult(ctx, lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{uri: edits}}), nil
+	}
+
 	text := formatTextEdits(edits)
 	return command.TextResult(text), nil
 }
 
-func (b *Bridge) tryExternalFormat(ctx context.Context, uri lsp.DocumentURI) (*command.Result, bool) {
+func (b *Bridge) tryExternalFormat(ctx context.Context, uri lsp.DocumentURI, apply bool) (*command.Result, bool) {
 	if b.fmtRouter == nil {
 		return nil, false
 	}
@@ -350,12 +411,16 @@ func (b *Bridge) tryExternalFormat(ctx context.Context, uri lsp.DocumentURI) (*c
 		NewText: result.Formatted,
 	}
 
+	if apply {
+		return b.applyResult(ctx, lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{uri: {edit}}}), true
+	}
+
 	text := formatTextEdits([]lsp.TextEdit{edit})
 	return command.TextResult(text), true
 }
 
 func (b *Bridge) DocumentSymbols(ctx context.Context, uri lsp.DocumentURI) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentDocumentSymbol, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentDocumentSymbol, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 		})
@@ -374,7 +439,7 @@ func (b *Bridge) DocumentSymbols(ctx context.Context, uri lsp.DocumentURI) (*com
 }
 
 func (b *Bridge) DocumentSymbolsRaw(ctx context.Context, uri lsp.DocumentURI) ([]Symbol, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentDocumentSymbol, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentDocumentSymbol, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 		})
@@ -386,19 +451,8 @@ func (b *Bridge) DocumentSymbolsRaw(ctx context.Context, uri lsp.DocumentURI) ([
 	return parseSymbols(result), nil
 }
 
-func (b *Bridge) CodeAction(ctx context.Context, uri lsp.DocumentURI, startLine, startChar, endLine, endChar int) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
-		return inst.Call(ctx, lsp.MethodTextDocumentCodeAction, map[string]any{
-			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
-			"range": lsp.Range{
-				Start: lsp.Position{Line: startLine, Character: startChar},
-				End:   lsp.Position{Line: endLine, Character: endChar},
-			},
-			"context": map[string]any{
-				"diagnostics": []any{},
-			},
-		})
-	})
+func (b *Bridge) CodeAction(ctx context.Context, uri lsp.DocumentURI, startLine, startChar, endLine, endChar int, apply bool) (*command.Result, error) {
+	result, err := b.codeActions(ctx, uri, startLine, startChar, endLine, endChar)
 	if err != nil {
 		return command.TextErrorResult(err.Error()), nil
 	}
@@ -408,12 +462,40 @@ func (b *Bridge) CodeAction(ctx context.Context, uri lsp.DocumentURI, startLine,
 		return command.TextResult("No code actions available"), nil
 	}
 
+	if apply {
+		action, err := actionToApply(actions)
+		if err != nil {
+			return command.TextErrorResult(err.Error() + "\n" + formatCodeActions(actions)), nil
+		}
+		if action.Edit == nil {
+			return command.TextErrorResult(fmt.Sprintf("code action %q has no edit to apply; use execute_code_action to run it", action.Title)), nil
+		}
+		return b.applyResult(ctx, *action.Edit), nil
+	}
+
 	text := formatCodeActions(actions)
 	return command.TextResult(text), nil
 }
 
-func (b *Bridge) Rename(ctx context.Context, uri lsp.DocumentURI, line, character int, newName string) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+// codeActions requests the code actions for a range from every server of
+// uri. Each action's data is tagged with the server that produced it.
+func (b *Bridge) codeActions(ctx context.Context, uri lsp.DocumentURI, startLine, startChar, endLine, endChar int) (json.RawMessage, error) {
+	return b.withDocument(ctx, uri, lsp.MethodTextDocumentCodeAction, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		return inst.Call(ctx, lsp.MethodTextDocumentCodeAction, map[string]any{
+			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
+			"range": lsp.Range{
+				Start: lsp.Position{Line: startLine, Character: startChar},
+				End:   lsp.Position{Line: endLine, Character: endChar},
+			},
+			"context": map[string]any{
+				"diagnostics": []any{},
+			},
+		})
+	})
+}
+
+func (b *Bridge) Rename(ctx context.Context, uri lsp.DocumentURI, line, character int, newName string, apply bool) (*command.Result, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentRename, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentRename, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 			"position":     lsp.Position{Line: line, Character: character},
@@ -424,26 +506,25 @@ func (b *Bridge) Rename(ctx context.Context, uri lsp.DocumentURI, line, characte
 		return command.TextErrorResult(err.Error()), nil
 	}
 
-	var edit WorkspaceEdit
+	var edit lsp.WorkspaceEdit
 	if err := json.Unmarshal(result, &edit); err != nil {
 		return command.TextErrorResult(fmt.Sprintf("parsing workspace edit: %v", err)), nil
 	}
 
+	if apply {
+		return b.applyResult(ctx, edit), nil
+	}
+
 	text := formatWorkspaceEdit(edit)
 	return command.TextResult(text), nil
 }
 
 func (b *Bridge) WorkspaceSymbols(ctx context.Context, uri lsp.DocumentURI, query string) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
-		return inst.Call(ctx, lsp.MethodWorkspaceSymbol, map[string]any{
-			"query": query,
-		})
-	})
+	symbols, err := b.workspaceSymbols(ctx, uri, query)
 	if err != nil {
 		return command.TextErrorResult(err.Error()), nil
 	}
 
-	symbols := parseWorkspaceSymbols(result)
 	if len(symbols) == 0 {
 		return command.TextResult("No symbols found matching: " + query), nil
 	}
@@ -453,7 +534,7 @@ func (b *Bridge) WorkspaceSymbols(ctx context.Context, uri lsp.DocumentURI, quer
 }
 
 func (b *Bridge) Diagnostics(ctx context.Context, uri lsp.DocumentURI) (*command.Result, error) {
-	result, err := b.withDocument(ctx, uri, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+	result, err := b.withDocument(ctx, uri, lsp.MethodTextDocumentDiagnostic, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
 		return inst.Call(ctx, lsp.MethodTextDocumentDiagnostic, map[string]any{
 			"textDocument": lsp.TextDocumentIdentifier{URI: uri},
 		})
@@ -507,7 +588,13 @@ func (b *Bridge) DefaultInitParams(uri lsp.DocumentURI) *lsp.InitializeParams {
 		},
 		Capabilities: lsp.ClientCapabilities{
 			Workspace: &lsp.WorkspaceClientCapabilities{
+				ApplyEdit:        true,
+				ExecuteCommand:   &lsp.ExecuteCommandClientCaps{},
 				WorkspaceFolders: true,
+				WorkspaceEdit: &lsp.WorkspaceEditClientCaps{
+					DocumentChanges:    true,
+					ResourceOperations: []string{lsp.FileChangeCreate, lsp.FileChangeRename, lsp.FileChangeDelete},
+				},
 			},
 			TextDocument: &lsp.TextDocumentClientCapabilities{
 				Hover:          &lsp.HoverClientCaps{},
@@ -515,8 +602,11 @@ func (b *Bridge) DefaultInitParams(uri lsp.DocumentURI) *lsp.InitializeParams {
 				References:     &lsp.ReferencesClientCaps{},
 				Completion:     &lsp.CompletionClientCaps{},
 				DocumentSymbol: &lsp.DocumentSymbolClientCaps{},
-				CodeAction:     &lsp.CodeActionClientCaps{},
-				Formatting:     &lsp.FormattingClientCaps{},
+				CodeAction: &lsp.CodeActionClientCaps{
+					DataSupport:    true,
+					ResolveSupport: &lsp.CodeActionResolveSupport{Properties: []string{"edit", "command"}},
+				},
+				Formatting:         &lsp.FormattingClientCaps{},
 				Rename:             &lsp.RenameClientCaps{},
 				PublishDiagnostics: &lsp.PublishDiagnosticsClientCaps{},
 			},
@@ -597,11 +687,6 @@ func (b *Bridge) InferLanguageID(uri lsp.DocumentURI) string {
 
 // Helper types and functions
 
-type WorkspaceEdit struct {
-	Changes         map[string][]lsp.TextEdit `json:"changes,omitempty"`
-	DocumentChanges json.RawMessage           `json:"documentChanges,omitempty"`
-}
-
 type CompletionItem struct {
 	Label      string `json:"label"`
 	Kind       int    `json:"kind,omitempty"`
@@ -610,17 +695,21 @@ type CompletionItem struct {
 }
 
 type Symbol struct {
-	Name     string        `json:"name"`
-	Kind     int           `json:"kind"`
-	Range    lsp.Range     `json:"range,omitempty"`
-	Location *lsp.Location `json:"location,omitempty"`
-	Children []Symbol      `json:"children,omitempty"`
+	Name           string        `json:"name"`
+	Kind           int           `json:"kind"`
+	Range          lsp.Range     `json:"range,omitempty"`
+	SelectionRange *lsp.Range    `json:"selectionRange,omitempty"`
+	Location       *lsp.Location `json:"location,omitempty"`
+	ContainerName  string        `json:"containerName,omitempty"`
+	Children       []Symbol      `json:"children,omitempty"`
 }
 
 type CodeAction struct {
-	Title       string `json:"title"`
-	Kind        string `json:"kind,omitempty"`
-	IsPreferred bool   `json:"isPreferred,omitempty"`
+	Title       string             `json:"title"`
+	Kind        string             `json:"kind,omitempty"`
+	IsPreferred bool               `json:"isPreferred,omitempty"`
+	Edit        *lsp.WorkspaceEdit `json:"edit,omitempty"`
+	Command     json.RawMessage    `json:"command,omitempty"` // a Command, or the command name of a bare Command
 }
 
 func extractMarkdownContent(raw json.RawMessage) string {
@@ -786,7 +875,7 @@ func formatCodeActions(actions []CodeAction) string {
 		if i > 0 {
 			sb.WriteString("\n")
 		}
-		sb.WriteString("- ")
+		sb.WriteString(fmt.Sprintf("%d. ", i+1))
 		sb.WriteString(action.Title)
 		if action.Kind != "" {
 			sb.WriteString(" (")
@@ -813,20 +902,54 @@ func formatTextEdits(edits []lsp.TextEdit) string {
 	return sb.String()
 }
 
-func formatWorkspaceEdit(edit WorkspaceEdit) string {
+func formatWorkspaceEdit(edit lsp.WorkspaceEdit) string {
 	var sb strings.Builder
-	total := 0
+	total, ops := 0, 0
 	for uri, edits := range edit.Changes {
 		total += len(edits)
 		sb.WriteString(fmt.Sprintf("%s: %d edit(s)\n", uri, len(edits)))
 	}
-	if total == 0 {
+	for _, change := range edit.DocumentChanges {
+		switch change.Kind {
+		case "":
+			if change.TextDocument == nil {
+				continue
+			}
+			total += len(change.Edits)
+			sb.WriteString(fmt.Sprintf("%s: %d edit(s)\n", change.TextDocument.URI, len(change.Edits)))
+		case lsp.FileChangeRename:
+			ops++
+			sb.WriteString(fmt.Sprintf("rename %s to %s\n", change.OldURI, change.NewURI))
+		default:
+			ops++
+			sb.WriteString(fmt.Sprintf("%s %s\n", change.Kind, change.URI))
+		}
+	}
+	if total == 0 && ops == 0 {
 		return "No changes to apply"
 	}
 	sb.WriteString(fmt.Sprintf("\nTotal: %d edit(s)", total))
 	return sb.String()
 }
 
+// actionToApply picks the code action apply acts on: the only one offered,
+// or else the one the server marks as preferred.
+func actionToApply(actions []CodeAction) (CodeAction, error) {
+	if len(actions) == 1 {
+		return actions[0], nil
+	}
+	var preferred []CodeAction
+	for _, action := range actions {
+		if action.IsPreferred {
+			preferred = append(preferred, action)
+		}
+	}
+	if len(preferred) == 1 {
+		return preferred[0], nil
+	}
+	return CodeAction{}, fmt.Errorf("%d code actions available and none is preferred; narrow the range to apply one", len(actions))
+}
+
 func truncate(s string, max int) string {
 	s = strings.ReplaceAll(s, "\n", "\\n")
 	if len(s) <= max {
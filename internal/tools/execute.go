@@ -0,0 +1,223 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/command"
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// ExecuteCodeAction runs one of the code actions offered for a range, picked
+// by its 1-based index in the code_action listing or by title: its edit is
+// applied and its command executed by the server that offered it.
+func (b *Bridge) ExecuteCodeAction(ctx context.Context, uri lsp.DocumentURI, startLine, startChar, endLine, endChar, index int, title string) (*command.Result, error) {
+	result, err := b.codeActions(ctx, uri, startLine, startChar, endLine, endChar)
+	if err != nil {
+		return command.TextErrorResult(err.Error()), nil
+	}
+
+	var items []json.RawMessage
+	if result != nil && string(result) != "null" {
+		if err := json.Unmarshal(result, &items); err != nil {
+			return command.TextErrorResult(fmt.Sprintf("parsing code actions: %v", err)), nil
+		}
+	}
+	actions := parseCodeActions(result)
+	if len(actions) == 0 || len(actions) != len(items) {
+		return command.TextErrorResult("No code actions available"), nil
+	}
+
+	i, err := selectCodeAction(actions, index, title)
+	if err != nil {
+		return command.TextErrorResult(err.Error() + "\n" + formatCodeActions(actions)), nil
+	}
+
+	lspName, item, ok := lsp.UntagResolveParams(items[i])
+	if !ok {
+		return command.TextErrorResult(fmt.Sprintf("code action %q does not name the server that offered it", actions[i].Title)), nil
+	}
+	inst, ok := b.pool.Get(lspName)
+	if !ok {
+		return command.TextErrorResult(fmt.Sprintf("LSP %s is no longer running", lspName)), nil
+	}
+
+	text, err := b.executeCodeAction(ctx, inst, item)
+	if err != nil {
+		return command.TextErrorResult(fmt.Sprintf("executing %q: %v", actions[i].Title, err)), nil
+	}
+	return command.TextResult(fmt.Sprintf("Executed %q\n%s", actions[i].Title, text)), nil
+}
+
+func (b *Bridge) executeCodeAction(ctx context.Context, inst *subprocess.LSPInstance, item json.RawMessage) (string, error) {
+	cmd, err := bareCommand(item)
+	if err != nil {
+		return "", err
+	}
+	if cmd != nil {
+		return b.executeCommand(ctx, inst, *cmd)
+	}
+
+	var action CodeAction
+	if err := json.Unmarshal(item, &action); err != nil {
+		return "", fmt.Errorf("parsing code action: %w", err)
+	}
+	if action.Edit == nil && inst.SupportsMethod(lsp.MethodCodeActionResolve) {
+		resolved, err := inst.Call(ctx, lsp.MethodCodeActionResolve, item)
+		if err != nil {
+			return "", fmt.Errorf("resolving code action: %w", err)
+		}
+		action = CodeAction{}
+		if err := json.Unmarshal(resolved, &action); err != nil {
+			return "", fmt.Errorf("parsing resolved code action: %w", err)
+		}
+	}
+	if action.Edit == nil && len(action.Command) == 0 {
+		return "", fmt.Errorf("the code action has neither an edit nor a command")
+	}
+
+	var out []string
+	if action.Edit != nil {
+		text, err := b.applyWorkspaceEdit(ctx, *action.Edit)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, text)
+	}
+	if len(action.Command) > 0 {
+		var cmd lsp.Command
+		if err := json.Unmarshal(action.Command, &cmd); err != nil {
+			return "", fmt.Errorf("parsing command: %w", err)
+		}
+		text, err := b.executeCommand(ctx, inst, cmd)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, text)
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// executeCommand runs cmd in inst. The workspace edits the server sends
+// back while it runs are applied by ApplyEdit and summarized in the result.
+func (b *Bridge) executeCommand(ctx context.Context, inst *subprocess.LSPInstance, cmd lsp.Command) (string, error) {
+	if !inst.SupportsCommand(cmd.Command) {
+		return "", fmt.Errorf("%s does not support command %s", inst.Name, cmd.Command)
+	}
+
+	b.execMu.Lock()
+	defer b.execMu.Unlock()
+
+	b.editsMu.Lock()
+	b.collecting, b.serverEdits, b.editPlans = true, nil, nil
+	b.editsMu.Unlock()
+
+	result, err := inst.Call(ctx, lsp.MethodWorkspaceExecuteCommand, lsp.ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	})
+
+	b.editsMu.Lock()
+	edits, plans := b.serverEdits, b.editPlans
+	b.collecting, b.serverEdits, b.editPlans = false, nil, nil
+	b.editsMu.Unlock()
+
+	for _, plan := range plans {
+		if err := plan.sync(ctx); err != nil {
+			return "", err
+		}
+	}
+	if err != nil {
+		return "", callError(ctx, lsp.MethodWorkspaceExecuteCommand, err)
+	}
+
+	out := []string{fmt.Sprintf("Ran command %s", cmd.Command)}
+	out = append(out, edits...)
+	if result != nil && string(result) != "null" {
+		out = append(out, "Result: "+string(result))
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// ApplyEdit answers a workspace/applyEdit request from lspName. Edits are
+// only applied while execute_code_action runs a command; servers do not get
+// to change files the agent did not ask to change. Open documents are
+// synced after the command returns.
+func (b *Bridge) ApplyEdit(ctx context.Context, lspName string, params lsp.ApplyWorkspaceEditParams) lsp.ApplyWorkspaceEditResult {
+	b.editsMu.Lock()
+	defer b.editsMu.Unlock()
+
+	if !b.collecting {
+		fmt.Fprintf(os.Stderr, "[lux] %s: rejected workspace edit: no command is running\n", lspName)
+		return lsp.ApplyWorkspaceEditResult{FailureReason: "lux only applies workspace edits while executing a command"}
+	}
+
+	plan, err := b.writeWorkspaceEdit(params.Edit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[lux] %s: rejected workspace edit: %v\n", lspName, err)
+		return lsp.ApplyWorkspaceEditResult{FailureReason: err.Error()}
+	}
+	b.serverEdits = append(b.serverEdits, plan.describe())
+	b.editPlans = append(b.editPlans, plan)
+	return lsp.ApplyWorkspaceEditResult{Applied: true}
+}
+
+// selectCodeAction returns the index of the action named by index (1-based)
+// or title. A title matches exactly or, failing that, as the only action
+// whose title contains it, ignoring case.
+func selectCodeAction(actions []CodeAction, index int, title string) (int, error) {
+	switch {
+	case index != 0 && title != "":
+		return 0, fmt.Errorf("pass either index or title, not both")
+	case index != 0:
+		if index < 1 || index > len(actions) {
+			return 0, fmt.Errorf("index %d is out of range: %d code action(s) available", index, len(actions))
+		}
+		return index - 1, nil
+	case title == "":
+		return 0, fmt.Errorf("pass the index or title of the code action to execute")
+	}
+
+	for i, action := range actions {
+		if action.Title == title {
+			return i, nil
+		}
+	}
+	match := -1
+	for i, action := range actions {
+		if strings.Contains(strings.ToLower(action.Title), strings.ToLower(title)) {
+			if match >= 0 {
+				return 0, fmt.Errorf("several code actions match %q", title)
+			}
+			match = i
+		}
+	}
+	if match < 0 {
+		return 0, fmt.Errorf("no code action matches %q", title)
+	}
+	return match, nil
+}
+
+// bareCommand returns item as a Command when the server offered a command
+// instead of a code action, and nil otherwise.
+func bareCommand(item json.RawMessage) (*lsp.Command, error) {
+	var fields struct {
+		Command json.RawMessage `json:"command"`
+	}
+	if err := json.Unmarshal(item, &fields); err != nil {
+		return nil, fmt.Errorf("parsing code action: %w", err)
+	}
+	var name string
+	if json.Unmarshal(fields.Command, &name) != nil {
+		return nil, nil
+	}
+	var cmd lsp.Command
+	if err := json.Unmarshal(item, &cmd); err != nil {
+		return nil, fmt.Errorf("parsing command: %w", err)
+	}
+	return &cmd, nil
+}
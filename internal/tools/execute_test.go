@@ -0,0 +1,235 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+func TestSelectCodeAction(t *testing.T) {
+	actions := []CodeAction{
+		{Title: "Organize imports"},
+		{Title: "Extract function"},
+		{Title: "Extract variable"},
+	}
+
+	tests := []struct {
+		index   int
+		title   string
+		want    int
+		wantErr bool
+	}{
+		{index: 2, want: 1},
+		{title: "Extract variable", want: 2},
+		{title: "organize", want: 0},
+		{title: "extract", wantErr: true},
+		{title: "inline", wantErr: true},
+		{index: 4, wantErr: true},
+		{index: 1, title: "Organize imports", wantErr: true},
+		{wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := selectCodeAction(actions, tt.index, tt.title)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("selectCodeAction(%d, %q) = %d, want an error", tt.index, tt.title, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("selectCodeAction(%d, %q) = %d, %v, want %d", tt.index, tt.title, got, err, tt.want)
+		}
+	}
+}
+
+func TestBareCommand(t *testing.T) {
+	cmd, err := bareCommand(json.RawMessage(`{"title": "Run test", "command": "gopls.run_tests", "arguments": [{"URI": "file:///a_test.go"}]}`))
+	if err != nil || cmd == nil {
+		t.Fatalf("bareCommand = %v, %v", cmd, err)
+	}
+	if cmd.Command != "gopls.run_tests" || len(cmd.Arguments) != 1 {
+		t.Errorf("got %+v", cmd)
+	}
+
+	cmd, err = bareCommand(json.RawMessage(`{"title": "Fill struct", "command": {"title": "Fill struct", "command": "gopls.apply_fix"}}`))
+	if err != nil || cmd != nil {
+		t.Errorf("a code action with a command is not a bare command: got %v, %v", cmd, err)
+	}
+}
+
+func TestBridge_ApplyEditOnlyDuringExecution(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	uri := writeFile(t, path, "package a\n")
+	b := &Bridge{}
+
+	edit := lsp.ApplyWorkspaceEditParams{Edit: lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+		uri: {replace(0, 8, 9, "b")},
+	}}}
+
+	if result := b.ApplyEdit(context.Background(), "gopls", edit); result.Applied || result.FailureReason == "" {
+		t.Errorf("edit outside a command: %+v, want it refused", result)
+	}
+	if got := readFile(t, path); got != "package a\n" {
+		t.Errorf("a.go = %q, want it untouched", got)
+	}
+
+	b.collecting = true
+	if result := b.ApplyEdit(context.Background(), "gopls", edit); !result.Applied {
+		t.Fatalf("ApplyEdit: %+v", result)
+	}
+	if len(b.serverEdits) != 1 {
+		t.Errorf("collected %q, want one summary", b.serverEdits)
+	}
+	if got := readFile(t, path); got != "package b\n" {
+		t.Errorf("a.go = %q", got)
+	}
+
+	edit.Edit.Changes[uri] = []lsp.TextEdit{replace(0, 0, 3, "x"), replace(0, 1, 4, "y")}
+	if result := b.ApplyEdit(context.Background(), "gopls", edit); result.Applied || result.FailureReason == "" {
+		t.Errorf("overlapping edits: %+v, want a failure reason", result)
+	}
+	if got := readFile(t, path); got != "package b\n" {
+		t.Errorf("a.go = %q after a rejected edit", got)
+	}
+}
+
+// applyEditExecutor runs an in-memory LSP that supports one command, "fix".
+// While running it the server sends edit back as workspace/applyEdit and
+// answers the command once lux has replied.
+type applyEditExecutor struct {
+	edit lsp.WorkspaceEdit
+}
+
+func (e *applyEditExecutor) Build(ctx context.Context, flake, binary string) (string, error) {
+	return flake, nil
+}
+
+func (e *applyEditExecutor) BuildStorePath(ctx context.Context, flake string) (string, error) {
+	return flake, nil
+}
+
+func (e *applyEditExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*subprocess.Process, error) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	stream := jsonrpc.NewStream(serverR, serverW)
+
+	go func() {
+		var command *jsonrpc.ID
+		for {
+			msg, err := stream.Read()
+			if err != nil {
+				return
+			}
+			switch {
+			case msg.IsResponse():
+				resp, _ := jsonrpc.NewResponse(*command, nil)
+				stream.Write(resp)
+			case msg.Method == lsp.MethodWorkspaceExecuteCommand:
+				command = msg.ID
+				req, _ := jsonrpc.NewRequest(jsonrpc.NewStringID("apply"), lsp.MethodWorkspaceApplyEdit, lsp.ApplyWorkspaceEditParams{Edit: e.edit})
+				stream.Write(req)
+			case msg.IsRequest():
+				var result any
+				if msg.Method == lsp.MethodInitialize {
+					result = map[string]any{"capabilities": map[string]any{
+						"executeCommandProvider": map[string]any{"commands": []string{"fix"}},
+					}}
+				}
+				resp, _ := jsonrpc.NewResponse(*msg.ID, result)
+				stream.Write(resp)
+			}
+		}
+	}()
+
+	kill := sync.OnceFunc(func() {
+		serverW.Close()
+		clientW.Close()
+	})
+	return &subprocess.Process{
+		Stdin:  clientW,
+		Stdout: clientR,
+		Stderr: io.NopCloser(strings.NewReader("")),
+		Wait:   func() error { return nil },
+		Kill:   func() error { kill(); return nil },
+	}, nil
+}
+
+// poolTracker re-opens documents in their server the way the MCP document
+// manager does, by way of Pool.GetOrStart.
+type poolTracker struct {
+	fakeTracker
+	pool *subprocess.Pool
+}
+
+func (f *poolTracker) Open(ctx context.Context, uri lsp.DocumentURI) error {
+	if _, err := f.pool.GetOrStart(ctx, "gopls", nil); err != nil {
+		return err
+	}
+	return f.fakeTracker.Open(ctx, uri)
+}
+
+func TestBridge_ExecuteCommandSyncsEditedDocuments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	uri := writeFile(t, path, "package a\n")
+	executor := &applyEditExecutor{edit: lsp.WorkspaceEdit{Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+		uri: {replace(0, 8, 9, "b")},
+	}}}
+
+	b := &Bridge{}
+	pool := subprocess.NewPool(executor, func(string) jsonrpc.Handler {
+		return func(ctx context.Context, msg *jsonrpc.Message) (*jsonrpc.Message, error) {
+			var params lsp.ApplyWorkspaceEditParams
+			json.Unmarshal(msg.Params, &params)
+			return jsonrpc.NewResponse(*msg.ID, b.ApplyEdit(ctx, "gopls", params))
+		}
+	})
+	pool.Register(subprocess.LSPSpec{Name: "gopls", Flake: "gopls"})
+	defer pool.StopAll()
+
+	tracker := &poolTracker{fakeTracker: fakeTracker{open: map[lsp.DocumentURI]string{uri: "package a\n"}}, pool: pool}
+	b.pool, b.docMgr = pool, tracker
+
+	inst, err := pool.GetOrStart(context.Background(), "gopls", &lsp.InitializeParams{})
+	if err != nil {
+		t.Fatalf("GetOrStart: %v", err)
+	}
+
+	type outcome struct {
+		text string
+		err  error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		text, err := b.executeCommand(context.Background(), inst, lsp.Command{Command: "fix"})
+		done <- outcome{text, err}
+	}()
+
+	select {
+	case got := <-done:
+		if got.err != nil {
+			t.Fatalf("executeCommand: %v", got.err)
+		}
+		if !strings.Contains(got.text, "1 edit(s)") {
+			t.Errorf("result does not report the server's edit: %q", got.text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("executeCommand did not return")
+	}
+	if got := readFile(t, path); got != "package b\n" {
+		t.Errorf("a.go = %q", got)
+	}
+	if len(tracker.opened) != 1 || tracker.opened[0] != uri {
+		t.Errorf("re-opened %v, want a.go", tracker.opened)
+	}
+}
@@ -17,40 +17,65 @@ func RegisterAll(app *command.App, bridge *Bridge) {
 	registerURITools(app, bridge)
 	registerReferencesTool(app, bridge)
 	registerCodeActionTool(app, bridge)
+	registerExecuteCodeActionTool(app, bridge)
 	registerRenameTool(app, bridge)
 	registerWorkspaceSymbolsTool(app, bridge)
 }
 
-// positionParams returns the common (uri, line, character) param set.
+// positionParams returns the common (uri, line, character) param set, with
+// symbol as the alternative to line and character.
 func positionParams() []command.Param {
 	return []command.Param{
-		{Name: "uri", Type: command.String, Description: "File URI (e.g., file:///path/to/file.go)", Required: true},
-		{Name: "line", Type: command.Int, Description: "0-indexed line number", Required: true},
-		{Name: "character", Type: command.Int, Description: "0-indexed character offset", Required: true},
+		{Name: "uri", Type: command.String, Description: "File URI (e.g., file:///path/to/file.go); optional with symbol"},
+		{Name: "line", Type: command.Int, Description: "0-indexed line number; required unless symbol is given"},
+		{Name: "character", Type: command.Int, Description: "0-indexed character offset; required unless symbol is given"},
+		{Name: "symbol", Type: command.String, Description: "Symbol to use instead of line and character: file#path (e.g., server.go#Server.Run) for a symbol in a file, or a name such as Server.Run, looked up in uri and then in the workspace"},
 	}
 }
 
+// positionArgs are the arguments of position tools: uri, line and
+// character, or symbol. Line and character are pointers so that an omitted
+// position is not taken for the start of the file.
+type positionArgs struct {
+	URI       string `json:"uri"`
+	Line      *int   `json:"line"`
+	Character *int   `json:"character"`
+	Symbol    string `json:"symbol"`
+}
+
+// position returns the document and position a resolves to.
+func (a positionArgs) position(ctx context.Context, bridge *Bridge) (lsp.DocumentURI, lsp.Position, error) {
+	if a.Symbol != "" {
+		return bridge.ResolveSymbol(ctx, lsp.DocumentURI(a.URI), a.Symbol)
+	}
+	if a.URI == "" || a.Line == nil || a.Character == nil {
+		return "", lsp.Position{}, fmt.Errorf("pass uri with line and character, or symbol")
+	}
+	return lsp.DocumentURI(a.URI), lsp.Position{Line: *a.Line, Character: *a.Character}, nil
+}
+
 var errNoBridge = fmt.Errorf("no bridge configured (artifact-generation mode)")
 
 func stubHandler(_ context.Context, _ json.RawMessage, _ command.Prompter) (*command.Result, error) {
 	return nil, errNoBridge
 }
 
-// makePositionHandler creates a Run handler that parses (uri, line, character)
-// and delegates to the given bridge method.
+// makePositionHandler creates a Run handler that parses positionArgs and
+// delegates to the given bridge method.
 func makePositionHandler(
+	bridge *Bridge,
 	fn func(ctx context.Context, uri lsp.DocumentURI, line, character int) (*command.Result, error),
 ) func(ctx context.Context, args json.RawMessage, _ command.Prompter) (*command.Result, error) {
 	return func(ctx context.Context, args json.RawMessage, _ command.Prompter) (*command.Result, error) {
-		var a struct {
-			URI       string `json:"uri"`
-			Line      int    `json:"line"`
-			Character int    `json:"character"`
-		}
+		var a positionArgs
 		if err := json.Unmarshal(args, &a); err != nil {
 			return command.TextErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
 		}
-		return fn(ctx, lsp.DocumentURI(a.URI), a.Line, a.Character)
+		uri, pos, err := a.position(ctx, bridge)
+		if err != nil {
+			return command.TextErrorResult(err.Error()), nil
+		}
+		return fn(ctx, uri, pos.Line, pos.Character)
 	}
 }
 
@@ -75,9 +100,9 @@ func registerPositionTools(app *command.App, bridge *Bridge) {
 	definitionRun := stubHandler
 	completionRun := stubHandler
 	if bridge != nil {
-		hoverRun = makePositionHandler(bridge.Hover)
-		definitionRun = makePositionHandler(bridge.Definition)
-		completionRun = makePositionHandler(bridge.Completion)
+		hoverRun = makePositionHandler(bridge, bridge.Hover)
+		definitionRun = makePositionHandler(bridge, bridge.Definition)
+		completionRun = makePositionHandler(bridge, bridge.Completion)
 	}
 
 	app.AddCommand(&command.Command{
@@ -113,7 +138,16 @@ func registerURITools(app *command.App, bridge *Bridge) {
 	docSymbolsRun := stubHandler
 	diagnosticsRun := stubHandler
 	if bridge != nil {
-		formatRun = makeURIHandler(bridge.Format)
+		formatRun = func(ctx context.Context, args json.RawMessage, _ command.Prompter) (*command.Result, error) {
+			var a struct {
+				URI   string `json:"uri"`
+				Apply bool   `json:"apply"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return command.TextErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+			}
+			return bridge.Format(ctx, lsp.DocumentURI(a.URI), a.Apply)
+		}
 		docSymbolsRun = makeURIHandler(bridge.DocumentSymbols)
 		diagnosticsRun = makeURIHandler(bridge.Diagnostics)
 	}
@@ -121,10 +155,11 @@ func registerURITools(app *command.App, bridge *Bridge) {
 	app.AddCommand(&command.Command{
 		Name: "format",
 		Description: command.Description{
-			Short: "Get formatting edits for a document according to language-standard style. Agents should use this tool to get proper formatting instead of manually adjusting whitespace or running external formatters. Returns text edits needed to properly format the file. Note: returns edits but does not apply them - use Edit tool to apply the returned changes.",
+			Short: "Get formatting edits for a document according to language-standard style. Agents should use this tool to get proper formatting instead of manually adjusting whitespace or running external formatters. Returns text edits needed to properly format the file, or writes them to disk when apply is true.",
 		},
 		Params: []command.Param{
 			{Name: "uri", Type: command.String, Description: "File URI (e.g., file:///path/to/file.go)", Required: true},
+			{Name: "apply", Type: command.Bool, Description: "Write the formatting edits to disk instead of returning them", Default: false},
 		},
 		Run: formatRun,
 	})
@@ -157,21 +192,23 @@ func registerReferencesTool(app *command.App, bridge *Bridge) {
 	if bridge != nil {
 		run = func(ctx context.Context, args json.RawMessage, _ command.Prompter) (*command.Result, error) {
 			var a struct {
-				URI                string `json:"uri"`
-				Line               int    `json:"line"`
-				Character          int    `json:"character"`
-				IncludeDeclaration *bool  `json:"include_declaration"`
+				positionArgs
+				IncludeDeclaration *bool `json:"include_declaration"`
 			}
 			if err := json.Unmarshal(args, &a); err != nil {
 				return command.TextErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
 			}
+			uri, pos, err := a.position(ctx, bridge)
+			if err != nil {
+				return command.TextErrorResult(err.Error()), nil
+			}
 
 			includeDecl := true
 			if a.IncludeDeclaration != nil {
 				includeDecl = *a.IncludeDeclaration
 			}
 
-			return bridge.References(ctx, lsp.DocumentURI(a.URI), a.Line, a.Character, includeDecl)
+			return bridge.References(ctx, uri, pos.Line, pos.Character, includeDecl)
 		}
 	}
 
@@ -180,12 +217,9 @@ func registerReferencesTool(app *command.App, bridge *Bridge) {
 		Description: command.Description{
 			Short: "Find ALL usages of a symbol throughout the codebase. Agents MUST use this tool instead of grep/search for finding where functions/types/variables are used - it understands scope and semantics, finding actual references not just string matches. DO NOT use grep to find usages of symbols - grep finds false positives (comments, strings, similar names). Critical for impact analysis before refactoring, understanding how functions are called, tracing data flow.",
 		},
-		Params: []command.Param{
-			{Name: "uri", Type: command.String, Description: "File URI (e.g., file:///path/to/file.go)", Required: true},
-			{Name: "line", Type: command.Int, Description: "0-indexed line number", Required: true},
-			{Name: "character", Type: command.Int, Description: "0-indexed character offset", Required: true},
-			{Name: "include_declaration", Type: command.Bool, Description: "Include the declaration in results", Default: true},
-		},
+		Params: append(positionParams(),
+			command.Param{Name: "include_declaration", Type: command.Bool, Description: "Include the declaration in results", Default: true},
+		),
 		Run: run,
 	})
 }
@@ -200,18 +234,19 @@ func registerCodeActionTool(app *command.App, bridge *Bridge) {
 				StartCharacter int    `json:"start_character"`
 				EndLine        int    `json:"end_line"`
 				EndCharacter   int    `json:"end_character"`
+				Apply          bool   `json:"apply"`
 			}
 			if err := json.Unmarshal(args, &a); err != nil {
 				return command.TextErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
 			}
-			return bridge.CodeAction(ctx, lsp.DocumentURI(a.URI), a.StartLine, a.StartCharacter, a.EndLine, a.EndCharacter)
+			return bridge.CodeAction(ctx, lsp.DocumentURI(a.URI), a.StartLine, a.StartCharacter, a.EndLine, a.EndCharacter, a.Apply)
 		}
 	}
 
 	app.AddCommand(&command.Command{
 		Name: "code_action",
 		Description: command.Description{
-			Short: "Get suggested fixes, refactorings, and improvements for code at a range. Agents should use this tool to get language-server suggested fixes instead of manually writing fixes for common issues. Provides quick fixes for errors, refactoring operations (extract function, inline variable), import organization, and code generation (implement interface). Use after diagnostics to get fixes for reported issues.",
+			Short: "Get suggested fixes, refactorings, and improvements for code at a range. Agents should use this tool to get language-server suggested fixes instead of manually writing fixes for common issues. Provides quick fixes for errors, refactoring operations (extract function, inline variable), import organization, and code generation (implement interface). Use after diagnostics to get fixes for reported issues. With apply, writes the edit of the only or preferred action to disk.",
 		},
 		Params: []command.Param{
 			{Name: "uri", Type: command.String, Description: "File URI (e.g., file:///path/to/file.go)", Required: true},
@@ -219,39 +254,79 @@ func registerCodeActionTool(app *command.App, bridge *Bridge) {
 			{Name: "start_character", Type: command.Int, Description: "0-indexed start character", Required: true},
 			{Name: "end_line", Type: command.Int, Description: "0-indexed end line", Required: true},
 			{Name: "end_character", Type: command.Int, Description: "0-indexed end character", Required: true},
+			{Name: "apply", Type: command.Bool, Description: "Apply the only available action, or the preferred one, to disk", Default: false},
 		},
 		Run: run,
 	})
 }
 
-func registerRenameTool(app *command.App, bridge *Bridge) {
+func registerExecuteCodeActionTool(app *command.App, bridge *Bridge) {
 	run := stubHandler
 	if bridge != nil {
 		run = func(ctx context.Context, args json.RawMessage, _ command.Prompter) (*command.Result, error) {
 			var a struct {
-				URI       string `json:"uri"`
-				Line      int    `json:"line"`
-				Character int    `json:"character"`
-				NewName   string `json:"new_name"`
+				URI            string `json:"uri"`
+				StartLine      int    `json:"start_line"`
+				StartCharacter int    `json:"start_character"`
+				EndLine        int    `json:"end_line"`
+				EndCharacter   int    `json:"end_character"`
+				Index          int    `json:"index"`
+				Title          string `json:"title"`
 			}
 			if err := json.Unmarshal(args, &a); err != nil {
 				return command.TextErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
 			}
-			return bridge.Rename(ctx, lsp.DocumentURI(a.URI), a.Line, a.Character, a.NewName)
+			return bridge.ExecuteCodeAction(ctx, lsp.DocumentURI(a.URI), a.StartLine, a.StartCharacter, a.EndLine, a.EndCharacter, a.Index, a.Title)
 		}
 	}
 
 	app.AddCommand(&command.Command{
-		Name: "rename",
+		Name: "execute_code_action",
 		Description: command.Description{
-			Short: "Rename a symbol across the entire codebase with semantic accuracy. Agents MUST use this tool instead of find-and-replace or manual editing when renaming functions, types, variables, or other symbols. Only renames actual references (not comments, strings, or similar names), handles scoping correctly, and updates imports appropriately. DO NOT use grep+edit or find-and-replace for renaming - it will miss references or change unrelated text.",
+			Short: "Run one of the code actions code_action lists for a range, picked by its number in that list or by title. Resolves the action with the language server, applies its edit to disk and executes its command, including any workspace edits the server makes while the command runs. Agents should use this tool to carry out a suggested fix or refactoring instead of reproducing it by hand.",
 		},
 		Params: []command.Param{
 			{Name: "uri", Type: command.String, Description: "File URI (e.g., file:///path/to/file.go)", Required: true},
-			{Name: "line", Type: command.Int, Description: "0-indexed line number", Required: true},
-			{Name: "character", Type: command.Int, Description: "0-indexed character offset", Required: true},
-			{Name: "new_name", Type: command.String, Description: "New name for the symbol", Required: true},
+			{Name: "start_line", Type: command.Int, Description: "0-indexed start line", Required: true},
+			{Name: "start_character", Type: command.Int, Description: "0-indexed start character", Required: true},
+			{Name: "end_line", Type: command.Int, Description: "0-indexed end line", Required: true},
+			{Name: "end_character", Type: command.Int, Description: "0-indexed end character", Required: true},
+			{Name: "index", Type: command.Int, Description: "1-based number of the action in the code_action listing"},
+			{Name: "title", Type: command.String, Description: "Title of the action, or a part of it that matches only one action"},
+		},
+		Run: run,
+	})
+}
+
+func registerRenameTool(app *command.App, bridge *Bridge) {
+	run := stubHandler
+	if bridge != nil {
+		run = func(ctx context.Context, args json.RawMessage, _ command.Prompter) (*command.Result, error) {
+			var a struct {
+				positionArgs
+				NewName string `json:"new_name"`
+				Apply   bool   `json:"apply"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return command.TextErrorResult(fmt.Sprintf("invalid arguments: %v", err)), nil
+			}
+			uri, pos, err := a.position(ctx, bridge)
+			if err != nil {
+				return command.TextErrorResult(err.Error()), nil
+			}
+			return bridge.Rename(ctx, uri, pos.Line, pos.Character, a.NewName, a.Apply)
+		}
+	}
+
+	app.AddCommand(&command.Command{
+		Name: "rename",
+		Description: command.Description{
+			Short: "Rename a symbol across the entire codebase with semantic accuracy. Agents MUST use this tool instead of find-and-replace or manual editing when renaming functions, types, variables, or other symbols. Only renames actual references (not comments, strings, or similar names), handles scoping correctly, and updates imports appropriately. DO NOT use grep+edit or find-and-replace for renaming - it will miss references or change unrelated text. Returns the planned edits, or writes them to disk when apply is true.",
 		},
+		Params: append(positionParams(),
+			command.Param{Name: "new_name", Type: command.String, Description: "New name for the symbol", Required: true},
+			command.Param{Name: "apply", Type: command.Bool, Description: "Write the rename to disk instead of returning the planned edits", Default: false},
+		),
 		Run: run,
 	})
 }
@@ -0,0 +1,255 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+	"github.com/amarbel-llc/lux/internal/subprocess"
+)
+
+// symbolMatch is a symbol found for a name the caller gave instead of a
+// position.
+type symbolMatch struct {
+	kind int
+	name string
+	uri  lsp.DocumentURI
+
+	// rng is the symbol's name when exact is set, and otherwise a range
+	// that starts at or before it.
+	rng   lsp.Range
+	exact bool
+}
+
+func (m symbolMatch) String() string {
+	return fmt.Sprintf("%s %s - %s:%d", symbolKindName(m.kind), m.name, m.uri.Path(), m.rng.Start.Line+1)
+}
+
+// ResolveSymbol finds the position of a symbol given by name instead of by
+// line and character. symbol is either "<file>#<path>", a dot-separated path
+// such as Server.Run through the document symbols of file, or a name looked
+// up in the document at uri, if given, and then through workspace/symbol.
+// Relative files are resolved against the working directory.
+func (b *Bridge) ResolveSymbol(ctx context.Context, uri lsp.DocumentURI, symbol string) (lsp.DocumentURI, lsp.Position, error) {
+	var matches []symbolMatch
+	if file, path, ok := strings.Cut(symbol, "#"); ok {
+		fileURI := lsp.DocumentURI(file)
+		if !fileURI.IsFile() {
+			fileURI = lsp.URIFromPath(file)
+		}
+		symbols, err := b.DocumentSymbolsRaw(ctx, fileURI)
+		if err != nil {
+			return "", lsp.Position{}, err
+		}
+		matches = matchDocumentSymbols(fileURI, symbols, path)
+	} else {
+		if uri != "" {
+			symbols, err := b.DocumentSymbolsRaw(ctx, uri)
+			if err != nil {
+				return "", lsp.Position{}, err
+			}
+			matches = matchDocumentSymbols(uri, symbols, symbol)
+		}
+		if len(matches) == 0 {
+			var err error
+			if matches, err = b.findWorkspaceSymbol(ctx, uri, symbol); err != nil {
+				return "", lsp.Position{}, err
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", lsp.Position{}, fmt.Errorf("no symbol matches %q", symbol)
+	case 1:
+		return matches[0].uri, b.symbolPosition(matches[0]), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%q matches %d symbols; qualify it (Type.Method) or name its file (file.go#Type.Method):", symbol, len(matches)))
+	for _, m := range matches {
+		sb.WriteString("\n")
+		sb.WriteString(m.String())
+	}
+	return "", lsp.Position{}, fmt.Errorf("%s", sb.String())
+}
+
+// symbolPosition returns the position of m's name, looking it up in the
+// file when the server gave only the range of the whole symbol.
+func (b *Bridge) symbolPosition(m symbolMatch) lsp.Position {
+	if m.exact {
+		return m.rng.Start
+	}
+	content, err := b.readFile(m.uri)
+	if err != nil {
+		return m.rng.Start
+	}
+
+	name := m.name
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	start, end := lsp.OffsetAt(content, m.rng.Start), lsp.OffsetAt(content, m.rng.End)
+	if end <= start {
+		end = len(content)
+	}
+	if i := strings.Index(content[start:end], name); i >= 0 {
+		return lsp.PositionAt(content, start+i)
+	}
+	return m.rng.Start
+}
+
+func (b *Bridge) findWorkspaceSymbol(ctx context.Context, uri lsp.DocumentURI, symbol string) ([]symbolMatch, error) {
+	// Not every server matches qualified queries, so a qualified name is
+	// also searched for by its last part.
+	queries := []string{symbol}
+	if i := strings.LastIndexByte(symbol, '.'); i >= 0 {
+		queries = append(queries, symbol[i+1:])
+	}
+
+	for _, query := range queries {
+		symbols, err := b.workspaceSymbols(ctx, uri, query)
+		if err != nil {
+			return nil, err
+		}
+		if matches := matchWorkspaceSymbols(symbols, symbol); len(matches) > 0 {
+			return matches, nil
+		}
+	}
+	return nil, nil
+}
+
+// workspaceSymbols runs workspace/symbol in the servers of uri or, without
+// one, in every running server.
+func (b *Bridge) workspaceSymbols(ctx context.Context, uri lsp.DocumentURI, query string) ([]WorkspaceSymbol, error) {
+	call := func(ctx context.Context, inst *subprocess.LSPInstance) (json.RawMessage, error) {
+		return inst.Call(ctx, lsp.MethodWorkspaceSymbol, map[string]any{
+			"query": query,
+		})
+	}
+
+	if uri != "" {
+		result, err := b.withDocument(ctx, uri, lsp.MethodWorkspaceSymbol, func(inst *subprocess.LSPInstance) (json.RawMessage, error) {
+			return call(ctx, inst)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return parseWorkspaceSymbols(result), nil
+	}
+
+	var targets []*subprocess.LSPInstance
+	for _, inst := range b.pool.Running() {
+		if inst.SupportsMethod(lsp.MethodWorkspaceSymbol) {
+			targets = append(targets, inst)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no running LSP can search the workspace; pass uri to start one")
+	}
+	results, err := subprocess.CallAll(ctx, targets, call)
+	if err != nil {
+		return nil, callError(ctx, lsp.MethodWorkspaceSymbol, err)
+	}
+	return parseWorkspaceSymbols(lsp.MergeResults(lsp.MethodWorkspaceSymbol, results)), nil
+}
+
+// matchDocumentSymbols finds the symbols of uri named path: a
+// dot-separated path through the symbol tree, either from its root or
+// ending at the symbol.
+func matchDocumentSymbols(uri lsp.DocumentURI, symbols []Symbol, path string) []symbolMatch {
+	var exact, suffix []symbolMatch
+	var walk func(symbols []Symbol, parent string)
+	walk = func(symbols []Symbol, parent string) {
+		for _, sym := range symbols {
+			qualified := symbolPathName(sym.Name)
+			if sym.ContainerName != "" {
+				qualified = symbolPathName(sym.ContainerName) + "." + qualified
+			}
+			if parent != "" {
+				qualified = parent + "." + qualified
+			}
+
+			if endsWithPath(qualified, path) {
+				m := symbolMatch{kind: sym.Kind, name: sym.Name, uri: uri, rng: sym.Range}
+				switch {
+				case sym.SelectionRange != nil:
+					m.rng, m.exact = *sym.SelectionRange, true
+				case sym.Location != nil:
+					m.uri, m.rng = sym.Location.URI, sym.Location.Range
+				}
+				if qualified == path {
+					exact = append(exact, m)
+				} else {
+					suffix = append(suffix, m)
+				}
+			}
+			walk(sym.Children, qualified)
+		}
+	}
+	walk(symbols, "")
+
+	if len(exact) > 0 {
+		return exact
+	}
+	return suffix
+}
+
+// matchWorkspaceSymbols keeps the symbols named path, by their own name or
+// qualified by their container; workspace/symbol matches loosely. Merged
+// results may repeat a symbol.
+func matchWorkspaceSymbols(symbols []WorkspaceSymbol, path string) []symbolMatch {
+	var exact, suffix []symbolMatch
+	seen := make(map[lsp.Location]bool)
+	for _, sym := range symbols {
+		name := symbolPathName(sym.Name)
+		qualified := name
+		if sym.ContainerName != "" {
+			qualified = symbolPathName(sym.ContainerName) + "." + name
+		}
+		if seen[sym.Location] || !endsWithPath(qualified, path) {
+			continue
+		}
+		seen[sym.Location] = true
+
+		m := symbolMatch{kind: sym.Kind, name: sym.Name, uri: sym.Location.URI, rng: sym.Location.Range}
+		if name == path || qualified == path {
+			exact = append(exact, m)
+		} else {
+			suffix = append(suffix, m)
+		}
+	}
+
+	if len(exact) > 0 {
+		return exact
+	}
+	return suffix
+}
+
+// endsWithPath reports whether path names qualified or its last parts.
+// Containers such as Go package paths separate their own parts with slashes.
+func endsWithPath(qualified, path string) bool {
+	return qualified == path || strings.HasSuffix(qualified, "."+path) || strings.HasSuffix(qualified, "/"+path)
+}
+
+// symbolPathName drops the receiver decorations and type parameters some
+// servers put in symbol names, so gopls's "(*Server[T]).Run" is addressed as
+// Server.Run.
+func symbolPathName(name string) string {
+	var sb strings.Builder
+	depth := 0
+	for _, r := range name {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case depth > 0, r == '(', r == ')', r == '*':
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
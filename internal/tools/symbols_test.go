@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/amarbel-llc/lux/internal/lsp"
+)
+
+func TestSymbolPathName(t *testing.T) {
+	tests := map[string]string{
+		"Server":             "Server",
+		"(*Server).Run":      "Server.Run",
+		"(Server).Stop":      "Server.Stop",
+		"(*List[T]).Push":    "List.Push",
+		"Map[K, V]":          "Map",
+		"pkg/server.Handler": "pkg/server.Handler",
+	}
+	for name, want := range tests {
+		if got := symbolPathName(name); got != want {
+			t.Errorf("symbolPathName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func nameRange(line, start, end int) *lsp.Range {
+	return &lsp.Range{Start: lsp.Position{Line: line, Character: start}, End: lsp.Position{Line: line, Character: end}}
+}
+
+func TestMatchDocumentSymbols(t *testing.T) {
+	uri := lsp.DocumentURI("file:///server.go")
+	symbols := []Symbol{
+		{Name: "Server", Kind: 23, SelectionRange: nameRange(2, 5, 11), Children: []Symbol{
+			{Name: "pool", Kind: 8, SelectionRange: nameRange(3, 1, 5)},
+		}},
+		{Name: "(*Server).Run", Kind: 6, SelectionRange: nameRange(6, 18, 21)},
+		{Name: "Config", Kind: 23, SelectionRange: nameRange(10, 5, 11), Children: []Symbol{
+			{Name: "Server", Kind: 8, SelectionRange: nameRange(11, 1, 7)},
+		}},
+		{Name: "(*Client).Run", Kind: 6, SelectionRange: nameRange(14, 18, 21)},
+	}
+
+	tests := []struct {
+		path  string
+		lines []int
+	}{
+		{"Server.Run", []int{6}},
+		{"Server.pool", []int{3}},
+		{"pool", []int{3}},
+		{"Server", []int{2}},
+		{"Config.Server", []int{11}},
+		{"Run", []int{6, 14}},
+		{"Missing", nil},
+	}
+
+	for _, tt := range tests {
+		matches := matchDocumentSymbols(uri, symbols, tt.path)
+		if len(matches) != len(tt.lines) {
+			t.Errorf("%s: got %d matches, want %d", tt.path, len(matches), len(tt.lines))
+			continue
+		}
+		for i, m := range matches {
+			if m.rng.Start.Line != tt.lines[i] || !m.exact {
+				t.Errorf("%s: match %d = %+v, want line %d", tt.path, i, m, tt.lines[i])
+			}
+		}
+	}
+}
+
+func TestMatchDocumentSymbols_Flat(t *testing.T) {
+	uri := lsp.DocumentURI("file:///app.py")
+	symbols := []Symbol{
+		{Name: "App", Kind: 5, Location: &lsp.Location{URI: uri, Range: *nameRange(0, 0, 20)}},
+		{Name: "run", Kind: 6, ContainerName: "App", Location: &lsp.Location{URI: uri, Range: *nameRange(3, 4, 30)}},
+	}
+
+	matches := matchDocumentSymbols(uri, symbols, "App.run")
+	if len(matches) != 1 || matches[0].rng.Start.Line != 3 || matches[0].exact {
+		t.Errorf("got %+v, want the run method's location", matches)
+	}
+}
+
+func TestMatchWorkspaceSymbols(t *testing.T) {
+	loc := func(path string, line int) lsp.Location {
+		return lsp.Location{URI: lsp.DocumentURI("file://" + path), Range: *nameRange(line, 0, 3)}
+	}
+	symbols := []WorkspaceSymbol{
+		{Name: "Server.Run", Kind: 6, ContainerName: "example.com/app/server", Location: loc("/app/server/server.go", 10)},
+		{Name: "Server.Run", Kind: 6, ContainerName: "example.com/app/server", Location: loc("/app/server/server.go", 10)},
+		{Name: "Client.Run", Kind: 6, ContainerName: "example.com/app/client", Location: loc("/app/client/client.go", 4)},
+		{Name: "RunAll", Kind: 12, ContainerName: "example.com/app", Location: loc("/app/run.go", 1)},
+		{Name: "run", Kind: 6, ContainerName: "Worker", Location: loc("/app/worker.py", 7)},
+	}
+
+	if matches := matchWorkspaceSymbols(symbols, "Server.Run"); len(matches) != 1 || matches[0].uri.Path() != "/app/server/server.go" {
+		t.Errorf("Server.Run: got %+v", matches)
+	}
+	if matches := matchWorkspaceSymbols(symbols, "Run"); len(matches) != 2 {
+		t.Errorf("Run: got %d matches, want Server.Run and Client.Run", len(matches))
+	}
+	if matches := matchWorkspaceSymbols(symbols, "Worker.run"); len(matches) != 1 {
+		t.Errorf("Worker.run: got %+v", matches)
+	}
+	if matches := matchWorkspaceSymbols(symbols, "server.Server.Run"); len(matches) != 1 {
+		t.Errorf("server.Server.Run: got %+v", matches)
+	}
+}
+
+func TestBridge_SymbolPosition(t *testing.T) {
+	uri := writeFile(t, filepath.Join(t.TempDir(), "app.py"), "class App:\n    def run(self):\n        pass\n")
+	b := &Bridge{}
+
+	got := b.symbolPosition(symbolMatch{name: "App.run", uri: uri, rng: lsp.Range{
+		Start: lsp.Position{Line: 1, Character: 4},
+		End:   lsp.Position{Line: 2, Character: 12},
+	}})
+	if want := (lsp.Position{Line: 1, Character: 8}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	exact := lsp.Position{Line: 9, Character: 9}
+	if got := b.symbolPosition(symbolMatch{uri: uri, rng: lsp.Range{Start: exact}, exact: true}); got != exact {
+		t.Errorf("exact match: got %+v", got)
+	}
+}
+
+func TestPositionArgs_RequireLineAndCharacter(t *testing.T) {
+	for _, args := range []string{
+		`{"uri":"file:///a.go"}`,
+		`{"uri":"file:///a.go","line":3}`,
+		`{"uri":"file:///a.go","character":3}`,
+		`{"line":0,"character":0}`,
+	} {
+		var a positionArgs
+		if err := json.Unmarshal([]byte(args), &a); err != nil {
+			t.Fatalf("%s: %v", args, err)
+		}
+		if _, _, err := a.position(context.Background(), &Bridge{}); err == nil {
+			t.Errorf("%s: expected an error", args)
+		}
+	}
+
+	var a positionArgs
+	if err := json.Unmarshal([]byte(`{"uri":"file:///a.go","line":0,"character":0}`), &a); err != nil {
+		t.Fatal(err)
+	}
+	uri, pos, err := a.position(context.Background(), &Bridge{})
+	if err != nil || uri != "file:///a.go" || pos != (lsp.Position{}) {
+		t.Errorf("got %s %+v %v", uri, pos, err)
+	}
+}
@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+)
+
+// ServerMessages returns the messages lux sent to the named LSP, in order.
+// Per-project instances are recorded as name@root; only the first instance
+// of the LSP that appears in the trace is replayed.
+func ServerMessages(entries []Entry, lspName string) []Entry {
+	var peer string
+	var msgs []Entry
+	for _, e := range entries {
+		if e.Direction != LuxToServer {
+			continue
+		}
+		if peer == "" && (e.Peer == lspName || strings.HasPrefix(e.Peer, lspName+"@")) {
+			peer = e.Peer
+		}
+		if peer != "" && e.Peer == peer {
+			msgs = append(msgs, e)
+		}
+	}
+	return msgs
+}
+
+// ServerPeers returns the distinct LSP peers that appear in a trace.
+func ServerPeers(entries []Entry) []string {
+	seen := make(map[string]bool)
+	var peers []string
+	for _, e := range entries {
+		if e.Direction != LuxToServer || seen[e.Peer] {
+			continue
+		}
+		seen[e.Peer] = true
+		peers = append(peers, e.Peer)
+	}
+	return peers
+}
+
+// Replay sends recorded messages to a server over r and w, waiting up to
+// timeout for the response to each request before sending the next
+// message. Everything sent and received is written to out.
+func Replay(ctx context.Context, msgs []Entry, r io.Reader, w io.Writer, out *Recorder, timeout time.Duration) error {
+	stream := jsonrpc.NewStream(r, w)
+
+	var peer string
+	if len(msgs) > 0 {
+		peer = msgs[0].Peer
+	}
+
+	var mu sync.Mutex
+	waiting := make(map[string]chan struct{})
+
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Read()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			out.RecordMessage(ServerToLux, peer, msg)
+			if !msg.IsResponse() || msg.ID == nil {
+				continue
+			}
+			mu.Lock()
+			if done, ok := waiting[msg.ID.String()]; ok {
+				close(done)
+				delete(waiting, msg.ID.String())
+			}
+			mu.Unlock()
+		}
+	}()
+
+	for i, e := range msgs {
+		var msg jsonrpc.Message
+		if err := json.Unmarshal(e.Message, &msg); err != nil {
+			return fmt.Errorf("message %d: %w", i+1, err)
+		}
+
+		var done chan struct{}
+		if msg.IsRequest() {
+			done = make(chan struct{})
+			mu.Lock()
+			waiting[msg.ID.String()] = done
+			mu.Unlock()
+		}
+
+		out.RecordMessage(LuxToServer, peer, &msg)
+		if err := stream.Write(&msg); err != nil {
+			return fmt.Errorf("sending message %d (%s): %w", i+1, msg.Method, err)
+		}
+
+		if done == nil {
+			continue
+		}
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			fmt.Fprintf(os.Stderr, "[lux] replay: no response to %s (id %s) after %s\n", msg.Method, msg.ID, timeout)
+		case err := <-readErr:
+			return fmt.Errorf("server closed the connection during %s: %w", msg.Method, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// Give the server a chance to finish, e.g. after a recorded exit.
+	select {
+	case <-readErr:
+	case <-time.After(timeout):
+	case <-ctx.Done():
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package trace records the JSON-RPC traffic lux relays as JSON lines and
+// feeds recordings back to a language server.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/transport"
+)
+
+type Direction string
+
+const (
+	ClientToLux Direction = "client->lux"
+	LuxToClient Direction = "lux->client"
+	LuxToServer Direction = "lux->server"
+	ServerToLux Direction = "server->lux"
+)
+
+// ClientPeer is the peer recorded for traffic with the editor or MCP client.
+const ClientPeer = "client"
+
+// Entry is one line of a trace file.
+type Entry struct {
+	Time      time.Time       `json:"time"`
+	Direction Direction       `json:"direction"`
+	Peer      string          `json:"peer"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// Recorder writes trace entries. A nil Recorder records nothing, so callers
+// can pass one around unconditionally.
+type Recorder struct {
+	w   io.Writer
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, enc: json.NewEncoder(w)}
+}
+
+// Create opens path for writing, truncating any previous trace.
+func Create(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating trace file: %w", err)
+	}
+	return NewRecorder(f), nil
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	if c, ok := r.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Record writes a raw message. Bodies that are not valid JSON are recorded
+// as strings so a corrupt frame still shows up in the trace.
+func (r *Recorder) Record(dir Direction, peer string, body []byte) {
+	if r == nil {
+		return
+	}
+
+	msg := json.RawMessage(body)
+	if !json.Valid(body) {
+		msg, _ = json.Marshal(string(body))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(Entry{
+		Time:      time.Now(),
+		Direction: dir,
+		Peer:      peer,
+		Message:   msg,
+	})
+}
+
+func (r *Recorder) RecordMessage(dir Direction, peer string, msg *jsonrpc.Message) {
+	if r == nil {
+		return
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	r.Record(dir, peer, body)
+}
+
+// TapReader returns a reader that passes src through unchanged while
+// recording every Content-Length framed message read from it.
+func (r *Recorder) TapReader(src io.Reader, dir Direction, peer string) io.Reader {
+	if r == nil {
+		return src
+	}
+	pr, pw := io.Pipe()
+	go r.recordFrames(pr, dir, peer)
+	return io.TeeReader(src, pw)
+}
+
+// TapWriter returns a writer that passes writes to dst unchanged while
+// recording every Content-Length framed message written to it.
+func (r *Recorder) TapWriter(dst io.Writer, dir Direction, peer string) io.Writer {
+	if r == nil {
+		return dst
+	}
+	pr, pw := io.Pipe()
+	go r.recordFrames(pr, dir, peer)
+	return io.MultiWriter(dst, pw)
+}
+
+func (r *Recorder) recordFrames(pr *io.PipeReader, dir Direction, peer string) {
+	br := bufio.NewReader(pr)
+	for {
+		body, err := readFrame(br)
+		if err != nil {
+			// Keep draining so the tapped stream never blocks on us.
+			io.Copy(io.Discard, br)
+			return
+		}
+		r.Record(dir, peer, body)
+	}
+}
+
+func readFrame(br *bufio.Reader) ([]byte, error) {
+	contentLength := -1
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("parsing Content-Length: %w", err)
+			}
+			contentLength = n
+		}
+	}
+	if contentLength < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	body := make([]byte, contentLength)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// TapTransport wraps an MCP transport so every message read from or written
+// to the client is recorded.
+func (r *Recorder) TapTransport(t transport.Transport) transport.Transport {
+	if r == nil {
+		return t
+	}
+	return &tracedTransport{Transport: t, rec: r}
+}
+
+type tracedTransport struct {
+	transport.Transport
+	rec *Recorder
+}
+
+func (t *tracedTransport) Read() (*jsonrpc.Message, error) {
+	msg, err := t.Transport.Read()
+	if err == nil {
+		t.rec.RecordMessage(ClientToLux, ClientPeer, msg)
+	}
+	return msg, err
+}
+
+func (t *tracedTransport) Write(msg *jsonrpc.Message) error {
+	t.rec.RecordMessage(LuxToClient, ClientPeer, msg)
+	return t.Transport.Write(msg)
+}
+
+// ReadEntries parses a trace file.
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	dec := json.NewDecoder(r)
+	for {
+		var e Entry
+		if err := dec.Decode(&e); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading trace entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+}
@@ -0,0 +1,136 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amarbel-llc/purse-first/libs/go-mcp/jsonrpc"
+)
+
+func TestRecorder_TapWriterAndReader(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+
+	var wire bytes.Buffer
+	w := rec.TapWriter(&wire, LuxToServer, "gopls")
+	msg, _ := jsonrpc.NewNotification("initialized", struct{}{})
+	if err := jsonrpc.NewStream(nil, w).Write(msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	r := rec.TapReader(bytes.NewReader(wire.Bytes()), ServerToLux, "gopls")
+	if _, err := jsonrpc.NewStream(r, nil).Read(); err != nil {
+		t.Fatalf("read through tap: %v", err)
+	}
+
+	// Recording happens asynchronously.
+	var entries []Entry
+	deadline := time.Now().Add(2 * time.Second)
+	for len(entries) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		rec.mu.Lock()
+		entries, _ = ReadEntries(bytes.NewReader(buf.Bytes()))
+		rec.mu.Unlock()
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %s", len(entries), buf.String())
+	}
+	directions := map[Direction]bool{entries[0].Direction: true, entries[1].Direction: true}
+	if !directions[LuxToServer] || !directions[ServerToLux] {
+		t.Errorf("unexpected directions: %+v", entries)
+	}
+	if entries[0].Peer != "gopls" || !strings.Contains(string(entries[0].Message), `"initialized"`) {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+}
+
+func TestRecorder_NilIsNoop(t *testing.T) {
+	var rec *Recorder
+	src := strings.NewReader("x")
+	if rec.TapReader(src, ClientToLux, ClientPeer) != io.Reader(src) {
+		t.Error("nil recorder should return the reader unchanged")
+	}
+	rec.Record(ClientToLux, ClientPeer, []byte("{}"))
+	if err := rec.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestServerMessages(t *testing.T) {
+	entries := []Entry{
+		{Direction: LuxToServer, Peer: "rust-analyzer@/a", Message: json.RawMessage(`{"id":1}`)},
+		{Direction: ServerToLux, Peer: "rust-analyzer@/a", Message: json.RawMessage(`{"id":1}`)},
+		{Direction: LuxToServer, Peer: "gopls", Message: json.RawMessage(`{"id":2}`)},
+		{Direction: LuxToServer, Peer: "rust-analyzer@/b", Message: json.RawMessage(`{"id":3}`)},
+		{Direction: LuxToServer, Peer: "rust-analyzer@/a", Message: json.RawMessage(`{"id":4}`)},
+	}
+
+	msgs := ServerMessages(entries, "rust-analyzer")
+	if len(msgs) != 2 || string(msgs[1].Message) != `{"id":4}` {
+		t.Errorf("expected messages of the first rust-analyzer instance only, got %+v", msgs)
+	}
+
+	if peers := ServerPeers(entries); len(peers) != 3 {
+		t.Errorf("expected 3 peers, got %v", peers)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	// Echo server: answers every request with its method name.
+	go func() {
+		stream := jsonrpc.NewStream(serverR, serverW)
+		for {
+			msg, err := stream.Read()
+			if err != nil {
+				return
+			}
+			if msg.Method == "exit" {
+				serverW.Close()
+				return
+			}
+			if msg.IsRequest() {
+				resp, _ := jsonrpc.NewResponse(*msg.ID, msg.Method)
+				stream.Write(resp)
+			}
+		}
+	}()
+
+	msgs := []Entry{
+		{Direction: LuxToServer, Peer: "gopls", Message: json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)},
+		{Direction: LuxToServer, Peer: "gopls", Message: json.RawMessage(`{"jsonrpc":"2.0","method":"initialized","params":{}}`)},
+		{Direction: LuxToServer, Peer: "gopls", Message: json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`)},
+		{Direction: LuxToServer, Peer: "gopls", Message: json.RawMessage(`{"jsonrpc":"2.0","method":"exit"}`)},
+	}
+
+	var out bytes.Buffer
+	if err := Replay(context.Background(), msgs, clientR, clientW, NewRecorder(&out), time.Second); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	entries, err := ReadEntries(&out)
+	if err != nil {
+		t.Fatalf("ReadEntries: %v", err)
+	}
+
+	var sent, received int
+	for _, e := range entries {
+		switch e.Direction {
+		case LuxToServer:
+			sent++
+		case ServerToLux:
+			received++
+		}
+	}
+	if sent != 4 || received != 2 {
+		t.Errorf("expected 4 sent and 2 received, got %d and %d", sent, received)
+	}
+}
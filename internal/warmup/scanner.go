@@ -32,21 +32,22 @@ type ScanResult struct {
 type Scanner struct {
 	cfg       *config.Config
 	matchers  *filematch.MatcherSet
-	lspByName map[string]string // filetype name -> LSP name
+	lspByName map[string][]string // filetype name -> LSP names
 }
 
 func NewScanner(cfg *config.Config, filetypes []*filetype.Config) *Scanner {
 	matchers := filematch.NewMatcherSet()
-	lspByName := make(map[string]string)
+	lspByName := make(map[string][]string)
 
 	for _, ft := range filetypes {
-		if ft.LSP == "" {
+		lspNames := ft.LSPNames()
+		if len(lspNames) == 0 {
 			continue
 		}
 		if err := matchers.Add(ft.Name, ft.Extensions, ft.Patterns, ft.LanguageIDs); err != nil {
 			continue
 		}
-		lspByName[ft.Name] = ft.LSP
+		lspByName[ft.Name] = lspNames
 	}
 
 	return &Scanner{
@@ -94,11 +95,11 @@ func (s *Scanner) ScanDirectories(dirs []string) ScanResult {
 			ext := filepath.Ext(path)
 			name := s.matchers.Match(path, ext, "")
 			if name != "" {
-				if lspName, ok := s.lspByName[name]; ok {
+				for _, lspName := range s.lspByName[name] {
 					result.LSPNames[lspName] = true
-					if len(result.LSPNames) >= total {
-						return fs.SkipAll
-					}
+				}
+				if len(result.LSPNames) >= total {
+					return fs.SkipAll
 				}
 			}
 
@@ -5,26 +5,81 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/lsp"
 	"github.com/amarbel-llc/lux/internal/subprocess"
 )
 
+// RecentUseWindow is how recently an LSP must have been started to be
+// prebuilt under the used-recently policy.
+const RecentUseWindow = 7 * 24 * time.Hour
+
+// PreBuildAll builds LSP flakes and their runtime deps in the background so
+// the first request does not wait on nix. Which LSPs are built follows the
+// config's prebuild policy.
 func PreBuildAll(ctx context.Context, cfg *config.Config, executor subprocess.Executor) {
+	ctx = subprocess.PrebuildContext(ctx)
+	policy := cfg.PrebuildPolicy()
+	if policy == config.PrebuildNone {
+		return
+	}
+
 	var wg sync.WaitGroup
 	for _, l := range cfg.LSPs {
-		wg.Add(1)
-		go func(flake, binary, name string) {
-			defer wg.Done()
-			if _, err := executor.Build(ctx, flake, binary); err != nil {
-				fmt.Fprintf(os.Stderr, "[lux] pre-build %s: %v\n", name, err)
-			}
-		}(l.Flake, l.Binary, l.Name)
+		if policy == config.PrebuildUsedRecently && !usedRecently(executor, l) {
+			continue
+		}
+
+		// Servers run from a command have no flake to build, but their
+		// runtime deps still do.
+		if l.Flake != "" {
+			wg.Add(1)
+			go func(flake, binary, name string) {
+				defer wg.Done()
+				if _, err := executor.Build(ctx, flake, binary); err != nil {
+					fmt.Fprintf(os.Stderr, "[lux] pre-build %s: %v\n", name, err)
+				}
+			}(l.Flake, l.Binary, l.Name)
+		}
+
+		for _, dep := range l.RuntimeDeps {
+			wg.Add(1)
+			go func(flake, name string) {
+				defer wg.Done()
+				if _, err := executor.BuildStorePath(ctx, flake); err != nil {
+					fmt.Fprintf(os.Stderr, "[lux] pre-build runtime dep %s for %s: %v\n", flake, name, err)
+				}
+			}(dep, l.Name)
+		}
 	}
 	wg.Wait()
 }
 
+func usedRecently(executor subprocess.Executor, l config.LSP) bool {
+	usage, ok := executor.(interface {
+		LastUsed(flake, binarySpec string) (time.Time, bool)
+	})
+	if !ok {
+		return false
+	}
+	recent := func(flake, binary string) bool {
+		last, ok := usage.LastUsed(flake, binary)
+		return ok && time.Since(last) < RecentUseWindow
+	}
+
+	if l.Flake != "" {
+		return recent(l.Flake, l.Binary)
+	}
+	for _, dep := range l.RuntimeDeps {
+		if recent(dep, "") {
+			return true
+		}
+	}
+	return false
+}
+
 func StartRelevantLSPs(ctx context.Context, pool *subprocess.Pool, scanner *Scanner,
 	dirs []string, initParams *lsp.InitializeParams, cfg *config.Config) {
 	result := scanner.ScanDirectories(dirs)
@@ -4,18 +4,20 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/amarbel-llc/lux/internal/config"
 	"github.com/amarbel-llc/lux/internal/subprocess"
 )
 
 type mockExecutor struct {
-	mu     sync.Mutex
-	builds map[string]int
+	mu          sync.Mutex
+	builds      map[string]int
+	storeBuilds map[string]int
 }
 
 func newMockExecutor() *mockExecutor {
-	return &mockExecutor{builds: make(map[string]int)}
+	return &mockExecutor{builds: make(map[string]int), storeBuilds: make(map[string]int)}
 }
 
 func (m *mockExecutor) Build(ctx context.Context, flake, binary string) (string, error) {
@@ -25,6 +27,13 @@ func (m *mockExecutor) Build(ctx context.Context, flake, binary string) (string,
 	return "/nix/store/fake-" + flake, nil
 }
 
+func (m *mockExecutor) BuildStorePath(ctx context.Context, flake string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storeBuilds[flake]++
+	return "/nix/store/fake-" + flake, nil
+}
+
 func (m *mockExecutor) Execute(ctx context.Context, path string, args []string, env map[string]string, workDir string) (*subprocess.Process, error) {
 	return nil, nil
 }
@@ -54,6 +63,48 @@ func TestPreBuildAll(t *testing.T) {
 	}
 }
 
+func TestPreBuildAll_IncludesRuntimeDeps(t *testing.T) {
+	cfg := &config.Config{
+		LSPs: []config.LSP{
+			{Name: "gopls", Flake: "nixpkgs#gopls", RuntimeDeps: []string{"nixpkgs#go"}},
+		},
+	}
+
+	executor := newMockExecutor()
+	PreBuildAll(context.Background(), cfg, executor)
+
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+
+	if executor.builds["nixpkgs#gopls"] != 1 {
+		t.Errorf("expected 1 build for gopls, got %d", executor.builds["nixpkgs#gopls"])
+	}
+	if executor.storeBuilds["nixpkgs#go"] != 1 {
+		t.Errorf("expected 1 store build for go, got %d", executor.storeBuilds["nixpkgs#go"])
+	}
+}
+
+func TestPreBuildAll_CommandServerRuntimeDeps(t *testing.T) {
+	cfg := &config.Config{
+		LSPs: []config.LSP{
+			{Name: "clangd", Command: "clangd", RuntimeDeps: []string{"nixpkgs#clang-tools"}},
+		},
+	}
+
+	executor := newMockExecutor()
+	PreBuildAll(context.Background(), cfg, executor)
+
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+
+	if len(executor.builds) != 0 {
+		t.Errorf("expected no server build for a command, got %v", executor.builds)
+	}
+	if executor.storeBuilds["nixpkgs#clang-tools"] != 1 {
+		t.Errorf("expected 1 store build for clang-tools, got %v", executor.storeBuilds)
+	}
+}
+
 func TestPreBuildAll_EmptyConfig(t *testing.T) {
 	cfg := &config.Config{}
 	executor := newMockExecutor()
@@ -66,3 +117,39 @@ func TestPreBuildAll_EmptyConfig(t *testing.T) {
 		t.Errorf("expected 0 builds, got %d", len(executor.builds))
 	}
 }
+
+type usageExecutor struct {
+	*mockExecutor
+	used map[string]time.Time
+}
+
+func (u *usageExecutor) LastUsed(flake, binary string) (time.Time, bool) {
+	t, ok := u.used[flake]
+	return t, ok
+}
+
+func TestPreBuildAll_Policies(t *testing.T) {
+	lsps := []config.LSP{
+		{Name: "gopls", Flake: "nixpkgs#gopls"},
+		{Name: "pyright", Flake: "nixpkgs#pyright"},
+		{Name: "nil", Flake: "nixpkgs#nil"},
+	}
+
+	none := newMockExecutor()
+	PreBuildAll(context.Background(), &config.Config{Prebuild: config.PrebuildNone, LSPs: lsps}, none)
+	if len(none.builds) != 0 {
+		t.Errorf("expected no builds with prebuild = none, got %v", none.builds)
+	}
+
+	recent := &usageExecutor{
+		mockExecutor: newMockExecutor(),
+		used: map[string]time.Time{
+			"nixpkgs#gopls":   time.Now().Add(-time.Hour),
+			"nixpkgs#pyright": time.Now().Add(-30 * 24 * time.Hour),
+		},
+	}
+	PreBuildAll(context.Background(), &config.Config{Prebuild: config.PrebuildUsedRecently, LSPs: lsps}, recent)
+	if len(recent.builds) != 1 || recent.builds["nixpkgs#gopls"] != 1 {
+		t.Errorf("expected only gopls to be prebuilt, got %v", recent.builds)
+	}
+}